@@ -176,6 +176,31 @@ const (
 	HighestCapabilityVersion = LINUX_CAPABILITY_VERSION_3
 )
 
+// File capability constants, defined in Linux's
+// include/uapi/linux/capability.h. File capabilities are stored in the
+// security.capability extended attribute as a struct vfs_cap_data.
+const (
+	VFS_CAP_REVISION_MASK   = 0xFF000000
+	VFS_CAP_REVISION_SHIFT  = 24
+	VFS_CAP_FLAGS_MASK      = 0x00FFFFFF
+	VFS_CAP_FLAGS_EFFECTIVE = 0x000001
+
+	VFS_CAP_REVISION_1 = 0x01000000
+	VFS_CAP_U32_1      = 1
+	XATTR_CAPS_SZ_1    = 4 * (1 + 2*VFS_CAP_U32_1)
+
+	VFS_CAP_REVISION_2 = 0x02000000
+	VFS_CAP_U32_2      = 2
+	XATTR_CAPS_SZ_2    = 4 * (1 + 2*VFS_CAP_U32_2)
+
+	// Revision 3 (struct vfs_ns_cap_data) adds a rootid field, following the
+	// revision 2 fields, that scopes the capabilities to user namespaces in
+	// which rootid is root.
+	VFS_CAP_REVISION_3 = 0x03000000
+	VFS_CAP_U32_3      = 2
+	XATTR_CAPS_SZ_3    = 4 * (2 + 2*VFS_CAP_U32_3)
+)
+
 // CapUserHeader is equivalent to Linux's cap_user_header_t.
 //
 // +marshal
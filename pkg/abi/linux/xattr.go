@@ -23,9 +23,50 @@ const (
 	XATTR_CREATE  = 1
 	XATTR_REPLACE = 2
 
+	XATTR_SECURITY_PREFIX     = "security."
+	XATTR_SECURITY_PREFIX_LEN = len(XATTR_SECURITY_PREFIX)
+
 	XATTR_TRUSTED_PREFIX     = "trusted."
 	XATTR_TRUSTED_PREFIX_LEN = len(XATTR_TRUSTED_PREFIX)
 
 	XATTR_USER_PREFIX     = "user."
 	XATTR_USER_PREFIX_LEN = len(XATTR_USER_PREFIX)
+
+	XATTR_SYSTEM_PREFIX     = "system."
+	XATTR_SYSTEM_PREFIX_LEN = len(XATTR_SYSTEM_PREFIX)
+
+	XATTR_NAME_POSIX_ACL_ACCESS  = XATTR_SYSTEM_PREFIX + "posix_acl_access"
+	XATTR_NAME_POSIX_ACL_DEFAULT = XATTR_SYSTEM_PREFIX + "posix_acl_default"
+
+	XATTR_NAME_CAPS = XATTR_SECURITY_PREFIX + "capability"
+
+	XATTR_NAME_SELINUX = XATTR_SECURITY_PREFIX + "selinux"
+)
+
+// Constants for POSIX ACLs, from include/uapi/linux/posix_acl.h and
+// include/uapi/linux/posix_acl_xattr.h.
+const (
+	// POSIX_ACL_XATTR_VERSION is the version of the extended attribute
+	// representation of ACLs, which consists of a 4-byte header holding the
+	// version followed by any number of 8-byte entries.
+	POSIX_ACL_XATTR_VERSION     = 0x0002
+	POSIX_ACL_XATTR_HEADER_SIZE = 4
+	POSIX_ACL_XATTR_ENTRY_SIZE  = 8
+
+	// ACL entry tags.
+	ACL_USER_OBJ  = 0x01
+	ACL_USER      = 0x02
+	ACL_GROUP_OBJ = 0x04
+	ACL_GROUP     = 0x08
+	ACL_MASK      = 0x10
+	ACL_OTHER     = 0x20
+
+	// ACL entry permissions.
+	ACL_READ    = 0x04
+	ACL_WRITE   = 0x02
+	ACL_EXECUTE = 0x01
+
+	// ACL_UNDEFINED_ID is the ID of entries other than ACL_USER and
+	// ACL_GROUP.
+	ACL_UNDEFINED_ID = 0xffffffff
 )
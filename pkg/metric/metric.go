@@ -134,6 +134,11 @@ type Field struct {
 	allowedValues []string
 }
 
+// NewField returns a metric field with the given name and allowed values.
+func NewField(name string, allowedValues []string) Field {
+	return Field{name: name, allowedValues: allowedValues}
+}
+
 // RegisterCustomUint64Metric registers a metric with the given name.
 //
 // Register must only be called at init and will return and error if called
@@ -171,16 +171,11 @@ func (b *buffer) ReadMsgType() MsgType {
 // ReadString deserializes a string.
 func (b *buffer) ReadString() string {
 	l := b.Read16()
-	if !b.has(int(l)) {
-		// Mark the buffer as corrupted.
-		b.markOverrun()
+	bs, ok := b.consume(int(l))
+	if !ok {
+		// The buffer has been marked as corrupted.
 		return ""
 	}
-
-	bs := make([]byte, l)
-	for i := 0; i < int(l); i++ {
-		bs[i] = byte(b.Read8())
-	}
 	return string(bs)
 }
 
@@ -257,7 +252,7 @@ func (b *buffer) WriteMsgType(t MsgType) {
 // WriteString serializes the given string.
 func (b *buffer) WriteString(s string) {
 	b.Write16(uint16(len(s)))
-	for i := 0; i < len(s); i++ {
-		b.Write8(byte(s[i]))
-	}
+	// Grow the buffer once for the whole string, which may be as large as an
+	// extended attribute value.
+	copy(b.append(len(s)), s)
 }
@@ -29,3 +29,36 @@ func TestBufferOverrun(t *testing.T) {
 		t.Errorf("overrun read got %s, want empty", s)
 	}
 }
+
+func TestBufferString(t *testing.T) {
+	for _, s := range []string{"", "a", string(make([]byte, 1<<16-1))} {
+		var buf buffer
+		buf.WriteString(s)
+		if got, want := len(buf.data), 2+len(s); got != want {
+			t.Errorf("WriteString wrote %d bytes, want %d", got, want)
+		}
+		if got := buf.ReadString(); got != s {
+			t.Errorf("ReadString got a string of length %d, want %d", len(got), len(s))
+		}
+		if buf.isOverrun() || len(buf.data) != 0 {
+			t.Errorf("ReadString left %d bytes, overrun %t", len(buf.data), buf.isOverrun())
+		}
+	}
+}
+
+// BenchmarkEncodeTsetxattr measures the cost of encoding the largest extended
+// attribute value that fits in a 9P string.
+func BenchmarkEncodeTsetxattr(b *testing.B) {
+	m := &Tsetxattr{
+		FID:   1,
+		Name:  "user.test",
+		Value: string(make([]byte, 1<<16-1)),
+	}
+	data := make([]byte, 0, initialBufferLength)
+	b.SetBytes(int64(len(m.Value)))
+	for i := 0; i < b.N; i++ {
+		buf := buffer{data: data[:0]}
+		m.encode(&buf)
+		data = buf.data
+	}
+}
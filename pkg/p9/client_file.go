@@ -17,6 +17,7 @@ package p9
 import (
 	"fmt"
 	"io"
+	"math"
 	"sync/atomic"
 
 	"golang.org/x/sys/unix"
@@ -208,6 +209,11 @@ func (c *clientFile) SetXattr(name, value string, flags uint32) error {
 	if !versionSupportsGetSetXattr(c.client.version) {
 		return unix.EOPNOTSUPP
 	}
+	// Values are encoded as 9P strings, whose lengths are 16 bits, so the
+	// largest values Linux allows can't be sent.
+	if len(value) > math.MaxUint16 {
+		return unix.E2BIG
+	}
 
 	return c.client.sendRecv(&Tsetxattr{FID: c.fid, Name: name, Value: value, Flags: flags}, &Rsetxattr{})
 }
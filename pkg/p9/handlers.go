@@ -17,6 +17,7 @@ package p9
 import (
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path"
 	"strings"
@@ -958,6 +959,11 @@ func (t *Tgetxattr) handle(cs *connState) message {
 	}); err != nil {
 		return newErr(err)
 	}
+	// As in clientFile.SetXattr, values too long for a 9P string can't be
+	// sent; the length would be silently truncated.
+	if len(val) > math.MaxUint16 {
+		return newErr(unix.E2BIG)
+	}
 	return &Rgetxattr{Value: val}
 }
 
@@ -1771,7 +1771,8 @@ func (t *Tgetxattr) String() string {
 
 // Rgetxattr is a getxattr response.
 type Rgetxattr struct {
-	// Value is the extended attribute value.
+	// Value is the extended attribute value. It is opaque: it is encoded
+	// with an explicit length, so it may contain NUL bytes.
 	Value string
 }
 
@@ -944,6 +944,64 @@ func TestReadlink(t *testing.T) {
 	}
 }
 
+func TestXattr(t *testing.T) {
+	h, c := NewHarness(t)
+	defer h.Finish()
+
+	_, root := newRoot(h, c)
+	defer root.Close()
+
+	_, f, err := root.Walk([]string{"file"})
+	if err != nil {
+		t.Fatalf("walk failed: got %v, wanted nil", err)
+	}
+	defer f.Close()
+	backend := h.Pop(f)
+
+	const (
+		name  = "user.test"
+		value = "value\x00with\x00nuls"
+	)
+
+	// Values round-trip to the backend unmodified.
+	backend.EXPECT().SetXattr(name, value, uint32(0)).Return(nil)
+	if err := f.SetXattr(name, value, 0); err != nil {
+		t.Errorf("setxattr got %v, wanted nil", err)
+	}
+	backend.EXPECT().GetXattr(name, uint64(len(value))).Return(value, nil)
+	if got, err := f.GetXattr(name, uint64(len(value))); err != nil || got != value {
+		t.Errorf("getxattr got (%q, %v), wanted (%q, nil)", got, err, value)
+	}
+	backend.EXPECT().ListXattr(uint64(0)).Return(map[string]struct{}{name: {}}, nil)
+	if got, err := f.ListXattr(0); err != nil || !reflect.DeepEqual(got, map[string]struct{}{name: {}}) {
+		t.Errorf("listxattr got (%v, %v), wanted ([%s], nil)", got, err, name)
+	}
+	backend.EXPECT().RemoveXattr(name).Return(nil)
+	if err := f.RemoveXattr(name); err != nil {
+		t.Errorf("removexattr got %v, wanted nil", err)
+	}
+
+	// Errors from a backend without xattr support are passed through.
+	backend.EXPECT().GetXattr(name, uint64(0)).Return("", unix.EOPNOTSUPP)
+	if _, err := f.GetXattr(name, 0); err != unix.EOPNOTSUPP {
+		t.Errorf("getxattr got %v, wanted EOPNOTSUPP", err)
+	}
+	backend.EXPECT().RemoveXattr(name).Return(unix.ENODATA)
+	if err := f.RemoveXattr(name); err != unix.ENODATA {
+		t.Errorf("removexattr got %v, wanted ENODATA", err)
+	}
+
+	// Values too long for a 9P string fail rather than being truncated.
+	long := strings.Repeat("\x00", 1<<16)
+	backend.EXPECT().GetXattr(name, uint64(len(long))).Return(long, nil)
+	if _, err := f.GetXattr(name, uint64(len(long))); err != unix.E2BIG {
+		t.Errorf("getxattr of %d byte value got %v, wanted E2BIG", len(long), err)
+	}
+	if err := f.SetXattr(name, long, 0); err != unix.E2BIG {
+		t.Errorf("setxattr of %d byte value got %v, wanted E2BIG", len(long), err)
+	}
+}
+
 // fdTest is a wrapper around operations that may send file descriptors. This
 // asserts that the file descriptors are working as intended.
 func fdTest(t *testing.T, sendFn func(*fd.FD) *fd.FD) {
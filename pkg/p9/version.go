@@ -174,6 +174,12 @@ func versionSupportsListRemoveXattr(v uint32) bool {
 	return v >= 11
 }
 
+// VersionSupportsXattr returns true if version v supports all of the extended
+// attribute messages: Tgetxattr, Tsetxattr, Tlistxattr and Tremovexattr.
+func VersionSupportsXattr(v uint32) bool {
+	return versionSupportsGetSetXattr(v) && versionSupportsListRemoveXattr(v)
+}
+
 // versionSupportsTsetattrclunk returns true if version v supports
 // the Tsetattrclunk message.
 func versionSupportsTsetattrclunk(v uint32) bool {
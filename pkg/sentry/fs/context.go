@@ -42,9 +42,13 @@ func ContextCanAccessFile(ctx context.Context, inode *Inode, reqPerms PermMask)
 	}
 
 	p := uattr.Perms.Other
-	// Are we owner or in group?
+	// Are we owner or in group? If the file has an access ACL, it
+	// determines the permissions of everyone but the owner.
+	var acl POSIXACL
 	if uattr.Owner.UID == creds.EffectiveKUID {
 		p = uattr.Perms.User
+	} else if a, ok := accessACL(ctx, inode, uattr); ok {
+		acl = a
 	} else if creds.InGroup(uattr.Owner.GID) {
 		p = uattr.Perms.Group
 	}
@@ -55,7 +59,11 @@ func ContextCanAccessFile(ctx context.Context, inode *Inode, reqPerms PermMask)
 	}
 
 	// Are permissions satisfied without capability checks?
-	if p.SupersetOf(reqPerms) {
+	if acl != nil {
+		if acl.Permits(creds, uattr.Owner, reqPerms) {
+			return true
+		}
+	} else if p.SupersetOf(reqPerms) {
 		return true
 	}
 
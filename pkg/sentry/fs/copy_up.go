@@ -18,7 +18,6 @@ import (
 	"fmt"
 	"io"
 
-	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/log"
@@ -409,10 +408,16 @@ func copyAttributesLocked(ctx context.Context, upper *Inode, lower *Inode) error
 	if err != nil {
 		return err
 	}
-	lowerXattr, err := lower.ListXattr(ctx, linux.XATTR_SIZE_MAX)
+	lowerXattr, err := lower.GetAllXattrs(ctx)
 	if err != nil && err != syserror.EOPNOTSUPP {
 		return err
 	}
+	// Don't copy-up attributes that configure an overlay in the lower.
+	for name := range lowerXattr {
+		if isXattrOverlay(name) {
+			delete(lowerXattr, name)
+		}
+	}
 
 	// Set the attributes on the upper filesystem.
 	if err := upper.InodeOperations.SetOwner(ctx, upper, lowerAttr.Owner); err != nil {
@@ -424,19 +429,5 @@ func copyAttributesLocked(ctx context.Context, upper *Inode, lower *Inode) error
 	}); err != nil {
 		return err
 	}
-	for name := range lowerXattr {
-		// Don't copy-up attributes that configure an overlay in the
-		// lower.
-		if isXattrOverlay(name) {
-			continue
-		}
-		value, err := lower.GetXattr(ctx, name, linux.XATTR_SIZE_MAX)
-		if err != nil {
-			return err
-		}
-		if err := upper.InodeOperations.SetXattr(ctx, upper, name, value, 0 /* flags */); err != nil {
-			return err
-		}
-	}
-	return nil
+	return upper.SetAllXattrs(ctx, nil /* d */, lowerXattr)
 }
@@ -19,12 +19,14 @@ import (
 	"crypto/rand"
 	"fmt"
 	"io"
+	"reflect"
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	_ "gvisor.dev/gvisor/pkg/sentry/fs/tmpfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/contexttest"
 	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserror"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
@@ -87,6 +89,148 @@ func TestConcurrentCopyUp(t *testing.T) {
 	}
 }
 
+// makeOverlayXattrTestFile creates a file with the given xattrs in a lower
+// tmpfs, and returns its Dirents in the lower filesystem and in an overlay
+// with an empty upper tmpfs.
+func makeOverlayXattrTestFile(t *testing.T, xattrs map[string]string) (lowerFile, overlayFile *fs.Dirent) {
+	ctx := contexttest.Context(t)
+
+	fsys, _ := fs.FindFilesystem("tmpfs")
+	lower, err := fsys.Mount(ctx, "", fs.MountSourceFlags{}, "", nil)
+	if err != nil {
+		t.Fatalf("failed to mount tmpfs: %v", err)
+	}
+	lowerRoot := fs.NewDirent(ctx, lower, "")
+	t.Cleanup(func() { lowerRoot.DecRef(ctx) })
+
+	f, err := lowerRoot.Create(ctx, lowerRoot, "file", fs.FileFlags{Read: true}, fs.FilePermsFromMode(0666))
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	t.Cleanup(func() { f.DecRef(ctx) })
+	lowerFile = f.Dirent
+	for name, value := range xattrs {
+		if err := lowerFile.Inode.SetXattr(ctx, lowerFile, name, value, 0 /* flags */); err != nil {
+			t.Fatalf("failed to set xattr %q on lower file: %v", name, err)
+		}
+	}
+
+	upper, err := fsys.Mount(ctx, "", fs.MountSourceFlags{}, "", nil)
+	if err != nil {
+		t.Fatalf("failed to mount tmpfs: %v", err)
+	}
+	overlay, err := fs.NewOverlayRoot(ctx, upper, lower, fs.MountSourceFlags{})
+	if err != nil {
+		t.Fatalf("failed to construct overlay root: %v", err)
+	}
+	mns, err := fs.NewMountNamespace(ctx, overlay)
+	if err != nil {
+		t.Fatalf("failed to construct mount manager: %v", err)
+	}
+	root := mns.Root()
+	t.Cleanup(func() { root.DecRef(ctx) })
+	maxTraversals := uint(0)
+	overlayFile, err = mns.FindInode(ctx, root, root, "file", &maxTraversals)
+	if err != nil {
+		t.Fatalf("failed to find file: %v", err)
+	}
+	t.Cleanup(func() { overlayFile.DecRef(ctx) })
+	return lowerFile, overlayFile
+}
+
+// TestCopyUpXattr checks that xattrs are read from the lower filesystem until
+// a file is copied up, and that setting an xattr copies up the file, including
+// its existing xattrs, without modifying the lower file.
+func TestCopyUpXattr(t *testing.T) {
+	ctx := contexttest.Context(t)
+	lowerFile, d := makeOverlayXattrTestFile(t, map[string]string{"user.lower": "l"})
+
+	// Before copy up, the lower file's xattrs are visible.
+	if got, err := d.Inode.GetXattr(ctx, "user.lower", 1); err != nil || got != "l" {
+		t.Errorf("GetXattr(user.lower) before copy up got (%q, %v) want (\"l\", nil)", got, err)
+	}
+
+	// Setting an xattr copies up the file.
+	if err := d.Inode.SetXattr(ctx, d, "user.upper", "u", 0 /* flags */); err != nil {
+		t.Fatalf("SetXattr(user.upper) failed: %v", err)
+	}
+	for name, want := range map[string]string{"user.lower": "l", "user.upper": "u"} {
+		if got, err := d.Inode.GetXattr(ctx, name, 1); err != nil || got != want {
+			t.Errorf("GetXattr(%s) after copy up got (%q, %v) want (%q, nil)", name, got, err, want)
+		}
+	}
+
+	// The lower file is unchanged.
+	if _, err := lowerFile.Inode.GetXattr(ctx, "user.upper", 1); err != syserror.ENOATTR {
+		t.Errorf("GetXattr(user.upper) on lower file got err %v want %v", err, syserror.ENOATTR)
+	}
+}
+
+// TestCopyUpAllXattrs checks that copy up preserves all xattrs other than
+// those that configure an overlay, including security.capability.
+func TestCopyUpAllXattrs(t *testing.T) {
+	ctx := contexttest.Context(t)
+	caps := "\x01\x00\x00\x02\x00\x04\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+	_, d := makeOverlayXattrTestFile(t, map[string]string{
+		"user.lower":             "l",
+		"trusted.lower":          "t",
+		"security.capability":    caps,
+		"trusted.overlay.opaque": "y",
+	})
+
+	// Setting an xattr copies up the file.
+	if err := d.Inode.SetXattr(ctx, d, "user.upper", "u", 0 /* flags */); err != nil {
+		t.Fatalf("SetXattr(user.upper) failed: %v", err)
+	}
+	got, err := d.Inode.GetAllXattrs(ctx)
+	if err != nil {
+		t.Fatalf("GetAllXattrs failed: %v", err)
+	}
+	want := map[string]string{
+		"user.lower":          "l",
+		"user.upper":          "u",
+		"trusted.lower":       "t",
+		"security.capability": caps,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("xattrs after copy up got %q want %q", got, want)
+	}
+}
+
+// TestCopyXattrs checks that CopyXattrs preserves user.* and trusted.*
+// attributes exactly, and skips all others.
+func TestCopyXattrs(t *testing.T) {
+	ctx := contexttest.Context(t)
+	src, _ := makeOverlayXattrTestFile(t, map[string]string{
+		"user.a":                 "1",
+		"user.empty":             "",
+		"trusted.nul":            "a\x00b\x00",
+		"trusted.overlay.opaque": "y",
+		"security.test":          "s",
+	})
+	dst, _ := makeOverlayXattrTestFile(t, map[string]string{
+		"user.a":    "old",
+		"user.keep": "k",
+	})
+
+	if err := fs.CopyXattrs(ctx, dst.Inode, dst, src.Inode); err != nil {
+		t.Fatalf("CopyXattrs failed: %v", err)
+	}
+	got, err := dst.Inode.GetAllXattrs(ctx)
+	if err != nil {
+		t.Fatalf("GetAllXattrs failed: %v", err)
+	}
+	want := map[string]string{
+		"user.a":      "1",
+		"user.empty":  "",
+		"trusted.nul": "a\x00b\x00",
+		"user.keep":   "k",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("xattrs after CopyXattrs got %q want %q", got, want)
+	}
+}
+
 type overlayTestFile struct {
 	File    *fs.File
 	name    string
@@ -15,6 +15,9 @@
 package fsutil
 
 import (
+	"strings"
+	"sync/atomic"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
@@ -207,9 +210,96 @@ func (i *InodeSimpleAttributes) NotifyModificationAndStatusChange(ctx context.Co
 //
 // +stateify savable
 type InodeSimpleExtendedAttributes struct {
-	// mu protects xattrs.
-	mu     sync.RWMutex `state:"nosave"`
-	xattrs map[string]string
+	// mu protects the following fields.
+	mu     sync.RWMutex      `state:"nosave"`
+	xattrs map[string]string `state:".(map[string]string)"`
+
+	// usage, if not nil, is charged for the names and values in xattrs. See
+	// SetXattrUsage.
+	usage *XattrUsage
+}
+
+// XattrUsage counts the bytes used by the extended attributes of a set of
+// inodes, e.g. all inodes in a filesystem, as the total length of their names
+// and values.
+//
+// +stateify savable
+type XattrUsage struct {
+	// bytes is accessed using atomic memory operations.
+	bytes int64
+}
+
+// Bytes returns the number of bytes counted by u.
+func (u *XattrUsage) Bytes() uint64 {
+	return uint64(atomic.LoadInt64(&u.bytes))
+}
+
+// SetXattrUsage makes u count the bytes used by i's extended attributes, until
+// ReleaseXattrUsage is called.
+//
+// Preconditions: i has no extended attributes, and is not yet accessible to
+// other goroutines.
+func (i *InodeSimpleExtendedAttributes) SetXattrUsage(u *XattrUsage) {
+	i.usage = u
+}
+
+// XattrUsageCounter returns the XattrUsage set by SetXattrUsage, or nil.
+func (i *InodeSimpleExtendedAttributes) XattrUsageCounter() *XattrUsage {
+	return i.usage
+}
+
+// ReleaseXattrUsage uncharges i's extended attributes from its XattrUsage. It
+// should be called when the inode is released.
+func (i *InodeSimpleExtendedAttributes) ReleaseXattrUsage() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.chargeLocked(-xattrsSize(i.xattrs))
+	i.usage = nil
+}
+
+// XattrUsage implements fs.InodeXattrUsageOperations.XattrUsage.
+func (i *InodeSimpleExtendedAttributes) XattrUsage(*fs.Inode) uint64 {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return uint64(xattrsSize(i.xattrs))
+}
+
+// xattrsSize returns the total length of the names and values in xattrs.
+func xattrsSize(xattrs map[string]string) int {
+	size := 0
+	for name, value := range xattrs {
+		size += len(name) + len(value)
+	}
+	return size
+}
+
+// chargeLocked adds delta bytes to i's XattrUsage, if any.
+//
+// Preconditions: i.mu is locked for writing.
+func (i *InodeSimpleExtendedAttributes) chargeLocked(delta int) {
+	if i.usage != nil && delta != 0 {
+		atomic.AddInt64(&i.usage.bytes, int64(delta))
+	}
+}
+
+// setLocked sets name to value, charging the change in size.
+//
+// Preconditions: i.mu is locked for writing. i.xattrs is not nil.
+func (i *InodeSimpleExtendedAttributes) setLocked(name, value string) {
+	if old, ok := i.xattrs[name]; ok {
+		i.chargeLocked(len(value) - len(old))
+	} else {
+		i.chargeLocked(len(name) + len(value))
+	}
+	i.xattrs[name] = value
+}
+
+// removeLocked removes name, which must be set, uncharging its size.
+//
+// Preconditions: i.mu is locked for writing.
+func (i *InodeSimpleExtendedAttributes) removeLocked(name string) {
+	i.chargeLocked(-(len(name) + len(i.xattrs[name])))
+	delete(i.xattrs, name)
 }
 
 // GetXattr implements fs.InodeOperations.GetXattr.
@@ -225,6 +315,26 @@ func (i *InodeSimpleExtendedAttributes) GetXattr(_ context.Context, _ *fs.Inode,
 
 // SetXattr implements fs.InodeOperations.SetXattr.
 func (i *InodeSimpleExtendedAttributes) SetXattr(_ context.Context, _ *fs.Inode, name, value string, flags uint32) error {
+	return i.SetXattrWithQuota(name, value, flags, XattrQuota{})
+}
+
+// XattrQuota limits an inode's extended attributes. A zero field means no
+// limit.
+//
+// +stateify savable
+type XattrQuota struct {
+	// Size is the maximum total length, in bytes, of all extended attribute
+	// names and values. Exceeding it fails with EDQUOT.
+	Size int
+
+	// Count is the maximum number of extended attributes. Exceeding it fails
+	// with ENOSPC.
+	Count int
+}
+
+// SetXattrWithQuota is equivalent to SetXattr, but fails if the inode's
+// extended attributes would exceed quota.
+func (i *InodeSimpleExtendedAttributes) SetXattrWithQuota(name, value string, flags uint32, quota XattrQuota) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 	if i.xattrs == nil {
@@ -242,10 +352,113 @@ func (i *InodeSimpleExtendedAttributes) SetXattr(_ context.Context, _ *fs.Inode,
 		return syserror.ENODATA
 	}
 
-	i.xattrs[name] = value
+	if err := i.checkQuotaLocked(name, value, ok, quota); err != nil {
+		return err
+	}
+
+	i.setLocked(name, value)
+	return nil
+}
+
+// checkQuotaLocked returns an error if setting name to value would make the
+// inode's extended attributes exceed quota. exists is whether name is already
+// set.
+//
+// Preconditions: i.mu is locked.
+func (i *InodeSimpleExtendedAttributes) checkQuotaLocked(name, value string, exists bool, quota XattrQuota) error {
+	if !exists && quota.Count > 0 && len(i.xattrs) >= quota.Count {
+		return syserror.ENOSPC
+	}
+	if quota.Size <= 0 {
+		return nil
+	}
+	total := len(name) + len(value)
+	for n, v := range i.xattrs {
+		if n != name {
+			total += len(n) + len(v)
+		}
+	}
+	if total > quota.Size {
+		return syserror.EDQUOT
+	}
 	return nil
 }
 
+// GetAndSetXattr implements fs.InodeXattrGetAndSetOperations.GetAndSetXattr.
+func (i *InodeSimpleExtendedAttributes) GetAndSetXattr(_ context.Context, _ *fs.Inode, name, value string, cond func(old string, exists bool) bool) (string, bool, error) {
+	return i.GetAndSetXattrWithQuota(name, value, cond, XattrQuota{})
+}
+
+// GetAndSetXattrWithQuota is equivalent to GetAndSetXattr, but fails if
+// setting the value would exceed quota, as for SetXattrWithQuota.
+func (i *InodeSimpleExtendedAttributes) GetAndSetXattrWithQuota(name, value string, cond func(old string, exists bool) bool, quota XattrQuota) (string, bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	old, ok := i.xattrs[name]
+	if !cond(old, ok) {
+		return old, false, nil
+	}
+	if err := i.checkQuotaLocked(name, value, ok, quota); err != nil {
+		return old, false, err
+	}
+	if i.xattrs == nil {
+		i.xattrs = make(map[string]string)
+	}
+	i.setLocked(name, value)
+	return old, true, nil
+}
+
+// RenameXattr implements fs.InodeXattrRenameOperations.RenameXattr.
+func (i *InodeSimpleExtendedAttributes) RenameXattr(_ context.Context, _ *fs.Inode, oldName, newName string) error {
+	return i.RenameXattrWithQuota(oldName, newName, XattrQuota{})
+}
+
+// RenameXattrWithQuota is equivalent to RenameXattr, but fails with EDQUOT if
+// the new name would make the inode's extended attributes exceed quota. A
+// rename never increases the number of extended attributes.
+func (i *InodeSimpleExtendedAttributes) RenameXattrWithQuota(oldName, newName string, quota XattrQuota) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	value, ok := i.xattrs[oldName]
+	if !ok {
+		return syserror.ENOATTR
+	}
+	if oldName == newName {
+		return nil
+	}
+	if quota.Size > 0 {
+		total := len(newName) + len(value)
+		for n, v := range i.xattrs {
+			if n != oldName && n != newName {
+				total += len(n) + len(v)
+			}
+		}
+		if total > quota.Size {
+			return syserror.EDQUOT
+		}
+	}
+	i.setLocked(newName, value)
+	i.removeLocked(oldName)
+	return nil
+}
+
+// ClearXattrs implements fs.InodeXattrClearOperations.ClearXattrs.
+func (i *InodeSimpleExtendedAttributes) ClearXattrs(context.Context, *fs.Inode) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for name := range i.xattrs {
+		if strings.HasPrefix(name, linux.XATTR_USER_PREFIX) {
+			i.removeLocked(name)
+		}
+	}
+	return nil
+}
+
+// SupportsXattrs implements fs.InodeXattrSupportOperations.SupportsXattrs.
+func (*InodeSimpleExtendedAttributes) SupportsXattrs(*fs.Inode) bool {
+	return true
+}
+
 // ListXattr implements fs.InodeOperations.ListXattr.
 func (i *InodeSimpleExtendedAttributes) ListXattr(context.Context, *fs.Inode, uint64) (map[string]struct{}, error) {
 	i.mu.RLock()
@@ -257,17 +470,82 @@ func (i *InodeSimpleExtendedAttributes) ListXattr(context.Context, *fs.Inode, ui
 	return names, nil
 }
 
+// WalkXattrs implements fs.InodeXattrWalkOperations.WalkXattrs.
+func (i *InodeSimpleExtendedAttributes) WalkXattrs(_ context.Context, _ *fs.Inode, fn func(name string)) error {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for name := range i.xattrs {
+		fn(name)
+	}
+	return nil
+}
+
 // RemoveXattr implements fs.InodeOperations.RemoveXattr.
 func (i *InodeSimpleExtendedAttributes) RemoveXattr(_ context.Context, _ *fs.Inode, name string) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 	if _, ok := i.xattrs[name]; ok {
-		delete(i.xattrs, name)
+		i.removeLocked(name)
 		return nil
 	}
 	return syserror.ENOATTR
 }
 
+// GetAllXattrs implements fs.InodeBulkXattrOperations.GetAllXattrs.
+func (i *InodeSimpleExtendedAttributes) GetAllXattrs(context.Context, *fs.Inode) (map[string]string, error) {
+	i.mu.RLock()
+	xattrs := make(map[string]string, len(i.xattrs))
+	for name, value := range i.xattrs {
+		xattrs[name] = value
+	}
+	i.mu.RUnlock()
+	return xattrs, nil
+}
+
+// SetAllXattrs implements fs.InodeBulkXattrOperations.SetAllXattrs.
+func (i *InodeSimpleExtendedAttributes) SetAllXattrs(_ context.Context, _ *fs.Inode, xattrs map[string]string) error {
+	return i.SetAllXattrsWithQuota(xattrs, XattrQuota{})
+}
+
+// SetAllXattrsWithQuota is equivalent to SetAllXattrs, but fails without
+// setting any of xattrs if the inode's extended attributes would then exceed
+// quota, as for SetXattrWithQuota.
+func (i *InodeSimpleExtendedAttributes) SetAllXattrsWithQuota(xattrs map[string]string, quota XattrQuota) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if quota.Count > 0 {
+		count := len(i.xattrs)
+		for n := range xattrs {
+			if _, ok := i.xattrs[n]; !ok {
+				count++
+			}
+		}
+		// As in checkQuotaLocked, replacing existing attributes never
+		// fails, even if the inode is already over the limit.
+		if count > quota.Count && count > len(i.xattrs) {
+			return syserror.ENOSPC
+		}
+	}
+	if quota.Size > 0 {
+		total := xattrsSize(xattrs)
+		for n, v := range i.xattrs {
+			if _, ok := xattrs[n]; !ok {
+				total += len(n) + len(v)
+			}
+		}
+		if total > quota.Size {
+			return syserror.EDQUOT
+		}
+	}
+	if i.xattrs == nil {
+		i.xattrs = make(map[string]string, len(xattrs))
+	}
+	for name, value := range xattrs {
+		i.setLocked(name, value)
+	}
+	return nil
+}
+
 // staticFile is a file with static contents. It is returned by
 // InodeStaticFileGetter.GetFile.
 //
@@ -480,6 +758,11 @@ func (InodeNoExtendedAttributes) RemoveXattr(context.Context, *fs.Inode, string)
 	return syserror.EOPNOTSUPP
 }
 
+// SupportsXattrs implements fs.InodeXattrSupportOperations.SupportsXattrs.
+func (InodeNoExtendedAttributes) SupportsXattrs(*fs.Inode) bool {
+	return false
+}
+
 // InodeNoopRelease implements fs.InodeOperations.Release as a noop.
 type InodeNoopRelease struct{}
 
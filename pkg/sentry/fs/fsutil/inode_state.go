@@ -0,0 +1,39 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsutil
+
+import "gvisor.dev/gvisor/pkg/context"
+
+// saveXattrs is invoked by stateify.
+//
+// Tasks are stopped while the kernel is saved, so normally nothing modifies
+// i.xattrs concurrently. Copying it with GetAllXattrs, which holds i.mu,
+// guarantees that the saved map is consistent even if something does, e.g. a
+// goroutine outside of any task.
+func (i *InodeSimpleExtendedAttributes) saveXattrs() map[string]string {
+	xattrs, _ := i.GetAllXattrs(context.Background(), nil /* inode */)
+	if len(xattrs) == 0 {
+		return nil
+	}
+	return xattrs
+}
+
+// loadXattrs is invoked by stateify.
+//
+// xattrs is installed directly rather than with SetAllXattrs, since i.usage
+// was saved with the charge for xattrs already included.
+func (i *InodeSimpleExtendedAttributes) loadXattrs(xattrs map[string]string) {
+	i.xattrs = xattrs
+}
@@ -0,0 +1,352 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsutil
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/state"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserror"
+)
+
+func TestSimpleExtendedAttributesSaveRestore(t *testing.T) {
+	ctx := contexttest.Context(t)
+	want := map[string]string{
+		"user.empty": "",
+		"user.nul":   "a\x00b\x00",
+		"user.test":  "value",
+	}
+
+	var saved InodeSimpleExtendedAttributes
+	for name, value := range want {
+		if err := saved.SetXattr(ctx, nil, name, value, 0 /* flags */); err != nil {
+			t.Fatalf("SetXattr(%q) failed: %v", name, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := state.Save(ctx, &buf, &saved); err != nil {
+		t.Fatalf("state.Save failed: %v", err)
+	}
+	var loaded InodeSimpleExtendedAttributes
+	if _, err := state.Load(ctx, bytes.NewReader(buf.Bytes()), &loaded); err != nil {
+		t.Fatalf("state.Load failed: %v", err)
+	}
+
+	names, err := loaded.ListXattr(ctx, nil, linux.XATTR_LIST_MAX)
+	if err != nil {
+		t.Fatalf("ListXattr failed: %v", err)
+	}
+	if len(names) != len(want) {
+		t.Errorf("ListXattr got %v, want names of %v", names, want)
+	}
+	for name, wantValue := range want {
+		value, err := loaded.GetXattr(ctx, nil, name, linux.XATTR_SIZE_MAX)
+		if err != nil {
+			t.Errorf("GetXattr(%q) failed: %v", name, err)
+			continue
+		}
+		if value != wantValue {
+			t.Errorf("GetXattr(%q) got %q, want %q", name, value, wantValue)
+		}
+	}
+}
+
+func TestSimpleExtendedAttributesConcurrentSave(t *testing.T) {
+	ctx := contexttest.Context(t)
+	var saved InodeSimpleExtendedAttributes
+
+	// The writer always sets both attributes to the same value at once.
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			v := strconv.Itoa(i)
+			if err := saved.SetAllXattrs(ctx, nil, map[string]string{"user.a": v, "user.b": v}); err != nil {
+				t.Errorf("SetAllXattrs failed: %v", err)
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	for i := 0; i < 100; i++ {
+		var buf bytes.Buffer
+		if _, err := state.Save(ctx, &buf, &saved); err != nil {
+			t.Fatalf("state.Save failed: %v", err)
+		}
+		var loaded InodeSimpleExtendedAttributes
+		if _, err := state.Load(ctx, bytes.NewReader(buf.Bytes()), &loaded); err != nil {
+			t.Fatalf("state.Load failed: %v", err)
+		}
+		xattrs, err := loaded.GetAllXattrs(ctx, nil)
+		if err != nil {
+			t.Fatalf("GetAllXattrs failed: %v", err)
+		}
+		if xattrs["user.a"] != xattrs["user.b"] {
+			t.Fatalf("loaded torn xattrs %v", xattrs)
+		}
+	}
+}
+
+// checkXattr checks that name has the given value in xattrs, or doesn't exist
+// if value is empty.
+func checkXattr(t *testing.T, xattrs *InodeSimpleExtendedAttributes, name, want string) {
+	t.Helper()
+	ctx := contexttest.Context(t)
+	got, err := xattrs.GetXattr(ctx, nil, name, linux.XATTR_SIZE_MAX)
+	if want == "" {
+		if err != syserror.ENOATTR {
+			t.Errorf("GetXattr(%q) got (%q, %v), want err %v", name, got, err, syserror.ENOATTR)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("GetXattr(%q) failed: %v", name, err)
+		return
+	}
+	if got != want {
+		t.Errorf("GetXattr(%q) got %q, want %q", name, got, want)
+	}
+}
+
+func TestSimpleExtendedAttributesRename(t *testing.T) {
+	ctx := contexttest.Context(t)
+	var xattrs InodeSimpleExtendedAttributes
+	for name, value := range map[string]string{"user.a": "1", "user.b": "2"} {
+		if err := xattrs.SetXattr(ctx, nil, name, value, 0 /* flags */); err != nil {
+			t.Fatalf("SetXattr(%q) failed: %v", name, err)
+		}
+	}
+	if err := xattrs.RenameXattr(ctx, nil, "user.missing", "user.c"); err != syserror.ENOATTR {
+		t.Errorf("RenameXattr of missing name got error %v, want %v", err, syserror.ENOATTR)
+	}
+
+	// Renaming onto an existing name replaces its value.
+	if err := xattrs.RenameXattr(ctx, nil, "user.a", "user.b"); err != nil {
+		t.Fatalf("RenameXattr failed: %v", err)
+	}
+	checkXattr(t, &xattrs, "user.a", "")
+	checkXattr(t, &xattrs, "user.b", "1")
+
+	// Renaming a name to itself is a no-op.
+	if err := xattrs.RenameXattr(ctx, nil, "user.b", "user.b"); err != nil {
+		t.Fatalf("RenameXattr to same name failed: %v", err)
+	}
+	checkXattr(t, &xattrs, "user.b", "1")
+
+	// A longer name may exceed the size quota.
+	quota := XattrQuota{Size: len("user.b") + len("1")}
+	if err := xattrs.RenameXattrWithQuota("user.b", "user.long", quota); err != syserror.EDQUOT {
+		t.Errorf("RenameXattrWithQuota over quota got error %v, want %v", err, syserror.EDQUOT)
+	}
+	if err := xattrs.RenameXattrWithQuota("user.b", "user.c", quota); err != nil {
+		t.Errorf("RenameXattrWithQuota within quota failed: %v", err)
+	}
+	checkXattr(t, &xattrs, "user.c", "1")
+}
+
+func TestSimpleExtendedAttributesUsage(t *testing.T) {
+	ctx := contexttest.Context(t)
+	var usage XattrUsage
+	var xattrs InodeSimpleExtendedAttributes
+	xattrs.SetXattrUsage(&usage)
+	checkUsage := func(want int) {
+		t.Helper()
+		if got := usage.Bytes(); got != uint64(want) {
+			t.Errorf("XattrUsage.Bytes() got %d, want %d", got, want)
+		}
+		if got := xattrs.XattrUsage(nil); got != uint64(want) {
+			t.Errorf("XattrUsage got %d, want %d", got, want)
+		}
+	}
+
+	if err := xattrs.SetXattr(ctx, nil, "user.a", "123", 0 /* flags */); err != nil {
+		t.Fatalf("SetXattr failed: %v", err)
+	}
+	checkUsage(len("user.a") + len("123"))
+
+	// Replacing a value only charges the difference.
+	if err := xattrs.SetXattr(ctx, nil, "user.a", "1", linux.XATTR_REPLACE); err != nil {
+		t.Fatalf("SetXattr failed: %v", err)
+	}
+	checkUsage(len("user.a") + len("1"))
+
+	if err := xattrs.SetAllXattrs(ctx, nil, map[string]string{"user.b": "22", "user.a": ""}); err != nil {
+		t.Fatalf("SetAllXattrs failed: %v", err)
+	}
+	checkUsage(len("user.a") + len("user.b") + len("22"))
+
+	if err := xattrs.RenameXattr(ctx, nil, "user.b", "user.long"); err != nil {
+		t.Fatalf("RenameXattr failed: %v", err)
+	}
+	checkUsage(len("user.a") + len("user.long") + len("22"))
+
+	if err := xattrs.RemoveXattr(ctx, nil, "user.a"); err != nil {
+		t.Fatalf("RemoveXattr failed: %v", err)
+	}
+	checkUsage(len("user.long") + len("22"))
+
+	// Releasing the inode uncharges everything that remains.
+	xattrs.ReleaseXattrUsage()
+	if got := usage.Bytes(); got != 0 {
+		t.Errorf("XattrUsage.Bytes() after release got %d, want 0", got)
+	}
+}
+
+func TestSimpleExtendedAttributesClear(t *testing.T) {
+	ctx := contexttest.Context(t)
+	var usage XattrUsage
+	var xattrs InodeSimpleExtendedAttributes
+	xattrs.SetXattrUsage(&usage)
+	quota := XattrQuota{Count: 3}
+	for _, name := range []string{"user.a", "user.b", "trusted.c"} {
+		if err := xattrs.SetXattrWithQuota(name, "value", 0 /* flags */, quota); err != nil {
+			t.Fatalf("SetXattrWithQuota(%q) failed: %v", name, err)
+		}
+	}
+	if err := xattrs.ClearXattrs(ctx, nil); err != nil {
+		t.Fatalf("ClearXattrs failed: %v", err)
+	}
+
+	// Only the user attributes are removed.
+	names, err := xattrs.ListXattr(ctx, nil, 0)
+	if err != nil {
+		t.Fatalf("ListXattr failed: %v", err)
+	}
+	if want := map[string]struct{}{"trusted.c": {}}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListXattr got %v, want %v", names, want)
+	}
+	if got, want := usage.Bytes(), uint64(len("trusted.c")+len("value")); got != want {
+		t.Errorf("XattrUsage.Bytes() got %d, want %d", got, want)
+	}
+
+	// The cleared attributes no longer count against the quota.
+	for _, name := range []string{"user.d", "user.e"} {
+		if err := xattrs.SetXattrWithQuota(name, "value", 0 /* flags */, quota); err != nil {
+			t.Errorf("SetXattrWithQuota(%q) after ClearXattrs failed: %v", name, err)
+		}
+	}
+}
+
+func newXattrsForBenchmark(b *testing.B, n int) *InodeSimpleExtendedAttributes {
+	ctx := contexttest.Context(b)
+	var xattrs InodeSimpleExtendedAttributes
+	for i := 0; i < n; i++ {
+		if err := xattrs.SetXattr(ctx, nil, fmt.Sprintf("user.test%d", i), "value", 0 /* flags */); err != nil {
+			b.Fatalf("SetXattr failed: %v", err)
+		}
+	}
+	return &xattrs
+}
+
+// BenchmarkXattrListSize compares computing the size of a listxattr(2) result
+// by listing all names against walking them.
+func BenchmarkXattrListSize(b *testing.B) {
+	const n = 1000
+	b.Run("ListXattr", func(b *testing.B) {
+		xattrs := newXattrsForBenchmark(b, n)
+		ctx := contexttest.Context(b)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			names, err := xattrs.ListXattr(ctx, nil, linux.XATTR_LIST_MAX)
+			if err != nil {
+				b.Fatalf("ListXattr failed: %v", err)
+			}
+			size := 0
+			for name := range names {
+				size += len(name) + 1
+			}
+		}
+	})
+	b.Run("WalkXattrs", func(b *testing.B) {
+		xattrs := newXattrsForBenchmark(b, n)
+		ctx := contexttest.Context(b)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			size := 0
+			if err := xattrs.WalkXattrs(ctx, nil, func(name string) {
+				size += len(name) + 1
+			}); err != nil {
+				b.Fatalf("WalkXattrs failed: %v", err)
+			}
+		}
+	})
+}
+
+// BenchmarkXattrConcurrentGet measures reads of different attributes of a
+// single inode from many goroutines. Reads only take mu for reading, so they
+// proceed concurrently; WithWriter shows the cost of a concurrent writer of an
+// unrelated attribute.
+func BenchmarkXattrConcurrentGet(b *testing.B) {
+	const n = 64
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("user.test%d", i)
+	}
+	for _, withWriter := range []bool{false, true} {
+		name := "ReadOnly"
+		if withWriter {
+			name = "WithWriter"
+		}
+		b.Run(name, func(b *testing.B) {
+			xattrs := newXattrsForBenchmark(b, n)
+			ctx := contexttest.Context(b)
+			done := make(chan struct{})
+			if withWriter {
+				go func() {
+					for {
+						select {
+						case <-done:
+							return
+						default:
+						}
+						xattrs.SetXattr(ctx, nil, "user.writer", "value", 0 /* flags */)
+					}
+				}()
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if _, err := xattrs.GetXattr(ctx, nil, names[i%n], linux.XATTR_SIZE_MAX); err != nil {
+						b.Errorf("GetXattr failed: %v", err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+			close(done)
+		})
+	}
+}
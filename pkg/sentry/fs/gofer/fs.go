@@ -62,6 +62,11 @@ const (
 	// overlayfsStaleRead if present closes cached readonly file after the first
 	// write. This is done to workaround a limitation of Linux overlayfs.
 	overlayfsStaleRead = "overlayfs_stale_read"
+
+	// If present, extended attribute names are kept case-sensitive even if
+	// the host filesystem is not, at the cost of storing them under
+	// different names on the host.
+	xattrCaseSensitiveKey = "xattr_case_sensitive"
 )
 
 // defaultAname is the default attach name.
@@ -150,6 +155,7 @@ type opts struct {
 	privateunixsocket      bool
 	limitHostFDTranslation bool
 	overlayfsStaleRead     bool
+	xattrCaseSensitive     bool
 }
 
 // options parses mount(2) data into structured options.
@@ -257,6 +263,11 @@ func options(data string) (opts, error) {
 		delete(options, overlayfsStaleRead)
 	}
 
+	if _, ok := options[xattrCaseSensitiveKey]; ok {
+		o.xattrCaseSensitive = true
+		delete(options, xattrCaseSensitiveKey)
+	}
+
 	// Fail to attach if the caller wanted us to do something that we
 	// don't support.
 	if len(options) > 0 {
@@ -16,10 +16,14 @@ package gofer
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang/mock/gomock"
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/p9"
 	"gvisor.dev/gvisor/pkg/p9/p9test"
@@ -308,3 +312,101 @@ func TestRevalidation(t *testing.T) {
 		})
 	}
 }
+
+// interruptedContext is a context.Context with a pending interrupt.
+type interruptedContext struct {
+	context.Context
+}
+
+// Interrupted implements context.Context.Interrupted.
+func (interruptedContext) Interrupted() bool {
+	return true
+}
+
+func TestXattrInterrupted(t *testing.T) {
+	rootTest(t, "interrupted", cacheNone, func(ctx context.Context, h *p9test.Harness, rootFile *p9test.Mock, rootInode *fs.Inode) {
+		// Internal callers, such as overlay copy-up, must be able to read
+		// attributes even if their task has been interrupted, so the
+		// Gofer is still contacted.
+		ictx := interruptedContext{ctx}
+		rootFile.EXPECT().GetXattr("user.test", gomock.Any()).Return("value", nil)
+		if got, err := rootInode.GetXattr(ictx, "user.test", 0); err != nil || got != "value" {
+			t.Errorf("GetXattr got (%q, %v), want (%q, nil)", got, err, "value")
+		}
+		want := map[string]struct{}{"user.test": {}}
+		rootFile.EXPECT().ListXattr(gomock.Any()).Return(want, nil)
+		if got, err := rootInode.ListXattr(ictx, 0); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("ListXattr got (%v, %v), want (%v, nil)", got, err, want)
+		}
+	})
+}
+
+func TestSupportsXattrs(t *testing.T) {
+	rootTest(t, "supported", cacheNone, func(ctx context.Context, h *p9test.Harness, rootFile *p9test.Mock, rootInode *fs.Inode) {
+		// The harness negotiates the highest protocol version, which
+		// supports all xattr messages.
+		if !rootInode.SupportsXattrs() {
+			t.Errorf("SupportsXattrs got false, want true")
+		}
+	})
+}
+
+func TestXattrNameEncoding(t *testing.T) {
+	names := []string{"user.foo", "user.Foo", "user.FOO", "user.%46oo", "user.föo", "user.FÖO", "trusted.a.B", "user."}
+	encoded := make(map[string]string)
+	for _, name := range names {
+		hostName := encodeXattrName(name)
+		if got, ok := decodeXattrName(hostName); !ok || got != name {
+			t.Errorf("decodeXattrName(%q) got (%q, %t) want (%q, true)", hostName, got, ok, name)
+		}
+		// A case-insensitive host must not see two names as the same.
+		folded := strings.ToLower(hostName)
+		if other, ok := encoded[folded]; ok {
+			t.Errorf("encodeXattrName(%q) and encodeXattrName(%q) collide as %q", name, other, folded)
+		}
+		encoded[folded] = name
+	}
+
+	// Names set on the host that encodeXattrName can't produce are rejected.
+	for _, hostName := range []string{"user.Foo", "user.%", "user.%4", "user.%zz", "user.%61", "user.%4F", "foo"} {
+		if got, ok := decodeXattrName(hostName); ok {
+			t.Errorf("decodeXattrName(%q) got (%q, true) want (_, false)", hostName, got)
+		}
+	}
+}
+
+func TestXattrCaseSensitive(t *testing.T) {
+	rootTest(t, "collision", cacheNone, func(ctx context.Context, h *p9test.Harness, rootFile *p9test.Mock, rootInode *fs.Inode) {
+		rootInode.InodeOperations.(*inodeOperations).session().xattrCaseSensitive = true
+
+		// Record the names that reach the host, which folds case.
+		var hostNames []string
+		for _, name := range []string{"user.Foo", "user.foo"} {
+			rootFile.EXPECT().SetXattr(gomock.Any(), "value", uint32(0)).Do(func(hostName, _ string, _ uint32) {
+				hostNames = append(hostNames, hostName)
+			}).Return(nil)
+			if err := rootInode.SetXattr(ctx, nil, name, "value", 0 /* flags */); err != nil {
+				t.Fatalf("SetXattr(%q) failed: %v", name, err)
+			}
+		}
+		if strings.EqualFold(hostNames[0], hostNames[1]) {
+			t.Fatalf("user.Foo and user.foo collide on the host as %q and %q", hostNames[0], hostNames[1])
+		}
+
+		// Both names are listed as set, and names set directly on the host
+		// are hidden.
+		rootFile.EXPECT().ListXattr(gomock.Any()).Return(map[string]struct{}{
+			hostNames[0]: {},
+			hostNames[1]: {},
+			"user.Bar":   {},
+		}, nil)
+		names, err := rootInode.ListXattr(ctx, linux.XATTR_LIST_MAX)
+		if err != nil {
+			t.Fatalf("ListXattr failed: %v", err)
+		}
+		want := map[string]struct{}{"user.Foo": {}, "user.foo": {}}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("ListXattr got %v want %v", names, want)
+		}
+	})
+}
@@ -621,24 +621,50 @@ func (i *inodeOperations) Truncate(ctx context.Context, inode *fs.Inode, length
 	return i.fileState.file.setAttr(ctx, mask, attr)
 }
 
+// hostXattrName returns the name under which the host stores the extended
+// attribute name.
+func (i *inodeOperations) hostXattrName(name string) string {
+	if i.session().xattrCaseSensitive {
+		return encodeXattrName(name)
+	}
+	return name
+}
+
 // GetXattr implements fs.InodeOperations.GetXattr.
 func (i *inodeOperations) GetXattr(ctx context.Context, _ *fs.Inode, name string, size uint64) (string, error) {
-	return i.fileState.file.getXattr(ctx, name, size)
+	return i.fileState.file.getXattr(ctx, i.hostXattrName(name), size)
 }
 
 // SetXattr implements fs.InodeOperations.SetXattr.
 func (i *inodeOperations) SetXattr(ctx context.Context, _ *fs.Inode, name string, value string, flags uint32) error {
-	return i.fileState.file.setXattr(ctx, name, value, flags)
+	return i.fileState.file.setXattr(ctx, i.hostXattrName(name), value, flags)
 }
 
 // ListXattr implements fs.InodeOperations.ListXattr.
 func (i *inodeOperations) ListXattr(ctx context.Context, _ *fs.Inode, size uint64) (map[string]struct{}, error) {
-	return i.fileState.file.listXattr(ctx, size)
+	names, err := i.fileState.file.listXattr(ctx, size)
+	if err != nil || !i.session().xattrCaseSensitive {
+		return names, err
+	}
+	decoded := make(map[string]struct{}, len(names))
+	for hostName := range names {
+		// Attributes whose names aren't encoded can't be accessed
+		// through the sandbox, so don't list them either.
+		if name, ok := decodeXattrName(hostName); ok {
+			decoded[name] = struct{}{}
+		}
+	}
+	return decoded, nil
 }
 
 // RemoveXattr implements fs.InodeOperations.RemoveXattr.
 func (i *inodeOperations) RemoveXattr(ctx context.Context, _ *fs.Inode, name string) error {
-	return i.fileState.file.removeXattr(ctx, name)
+	return i.fileState.file.removeXattr(ctx, i.hostXattrName(name))
+}
+
+// SupportsXattrs implements fs.InodeXattrSupportOperations.SupportsXattrs.
+func (i *inodeOperations) SupportsXattrs(*fs.Inode) bool {
+	return p9.VersionSupportsXattr(i.session().client.Version())
 }
 
 // Allocate implements fs.InodeOperations.Allocate.
@@ -173,6 +173,11 @@ type session struct {
 	// after file is open for write.
 	overlayfsStaleRead bool
 
+	// xattrCaseSensitive is the value of the xattr_case_sensitive mount
+	// option. If true, extended attribute names are encoded before they are
+	// sent to the gofer; see xattr.go.
+	xattrCaseSensitive bool
+
 	// connID is a unique identifier for the session connection.
 	connID string `state:"wait"`
 
@@ -309,6 +314,7 @@ func Root(ctx context.Context, dev string, filesystem fs.Filesystem, superBlockF
 		superBlockFlags:        superBlockFlags,
 		limitHostFDTranslation: o.limitHostFDTranslation,
 		overlayfsStaleRead:     o.overlayfsStaleRead,
+		xattrCaseSensitive:     o.xattrCaseSensitive,
 		mounter:                mounter,
 	}
 	s.EnableLeakCheck("gofer.session")
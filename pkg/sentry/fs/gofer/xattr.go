@@ -0,0 +1,107 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Extended attribute names are case-sensitive in Linux, but a gofer may be
+// serving a case-insensitive host filesystem, on which user.Foo and user.foo
+// name the same attribute. With the xattr_case_sensitive mount option, the
+// sentry keeps names distinct by storing each attribute on the host under an
+// encoded name that no case folding can collide with another.
+//
+// The tradeoff is that names on the host no longer match the names seen in the
+// sandbox: attributes set on the host outside of the sandbox are invisible
+// unless their names happen to be valid encodings, and an encoded name may be
+// up to three times longer than the original, so long names can exceed the
+// host's XATTR_NAME_MAX.
+
+// hexDigits are the digits used by encodeXattrName. They are lower case, so
+// that encoded names contain no upper case letters.
+const hexDigits = "0123456789abcdef"
+
+// needsXattrEscape returns true if c may be folded by a case-insensitive host,
+// or is the escape character itself.
+func needsXattrEscape(c byte) bool {
+	return c == '%' || ('A' <= c && c <= 'Z') || c >= utf8.RuneSelf
+}
+
+// encodeXattrName returns the host name of the extended attribute name. The
+// namespace prefix is kept so that the host still applies its namespace
+// semantics, and every byte of the rest of the name that needs escaping is
+// replaced by '%' followed by two hex digits.
+func encodeXattrName(name string) string {
+	i := strings.IndexByte(name, '.')
+	if i < 0 {
+		// Not a valid name; let the host reject it.
+		return name
+	}
+	var b strings.Builder
+	b.Grow(len(name))
+	b.WriteString(name[:i+1])
+	for j := i + 1; j < len(name); j++ {
+		c := name[j]
+		if !needsXattrEscape(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&0xf])
+	}
+	return b.String()
+}
+
+// decodeXattrName reverses encodeXattrName. It returns false if hostName is not
+// a name returned by encodeXattrName, e.g. because the attribute was set on the
+// host outside of the sandbox.
+func decodeXattrName(hostName string) (string, bool) {
+	i := strings.IndexByte(hostName, '.')
+	if i < 0 {
+		return "", false
+	}
+	var b strings.Builder
+	b.Grow(len(hostName))
+	b.WriteString(hostName[:i+1])
+	for j := i + 1; j < len(hostName); j++ {
+		c := hostName[j]
+		if c != '%' {
+			if needsXattrEscape(c) {
+				return "", false
+			}
+			b.WriteByte(c)
+			continue
+		}
+		if j+2 >= len(hostName) {
+			return "", false
+		}
+		hi := strings.IndexByte(hexDigits, hostName[j+1])
+		lo := strings.IndexByte(hexDigits, hostName[j+2])
+		if hi < 0 || lo < 0 {
+			return "", false
+		}
+		c = byte(hi<<4 | lo)
+		if !needsXattrEscape(c) {
+			// encodeXattrName never escapes c.
+			return "", false
+		}
+		b.WriteByte(c)
+		j += 2
+	}
+	return b.String(), true
+}
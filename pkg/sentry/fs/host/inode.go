@@ -15,7 +15,11 @@
 package host
 
 import (
+	"bytes"
+	"strings"
+
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/fd"
 	"gvisor.dev/gvisor/pkg/safemem"
@@ -34,8 +38,7 @@ import (
 //
 // +stateify savable
 type inodeOperations struct {
-	fsutil.InodeNotVirtual           `state:"nosave"`
-	fsutil.InodeNoExtendedAttributes `state:"nosave"`
+	fsutil.InodeNotVirtual `state:"nosave"`
 
 	// fileState implements fs.CachedFileObject. It exists
 	// to break a circular load dependency between inodeOperations
@@ -397,6 +400,70 @@ func (i *inodeOperations) Getlink(context.Context, *fs.Inode) (*fs.Dirent, error
 	return nil, fs.ErrResolveViaReadlink
 }
 
+// hostXattrPermitted returns true if the extended attribute name may be
+// passed through to the host. Only the user namespace is: attributes in the
+// other namespaces are interpreted by the host kernel (e.g. security.capability
+// and POSIX ACLs) or reflect the sandbox's host privileges rather than the
+// application's.
+func hostXattrPermitted(name string) bool {
+	return strings.HasPrefix(name, linux.XATTR_USER_PREFIX)
+}
+
+// GetXattr implements fs.InodeOperations.GetXattr.
+func (i *inodeOperations) GetXattr(_ context.Context, _ *fs.Inode, name string, size uint64) (string, error) {
+	if !hostXattrPermitted(name) {
+		return "", syserror.EOPNOTSUPP
+	}
+	if size > linux.XATTR_SIZE_MAX {
+		size = linux.XATTR_SIZE_MAX
+	}
+	buf := make([]byte, size)
+	n, err := unix.Fgetxattr(i.fileState.FD(), name, buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
+
+// SetXattr implements fs.InodeOperations.SetXattr.
+func (i *inodeOperations) SetXattr(_ context.Context, _ *fs.Inode, name, value string, flags uint32) error {
+	if !hostXattrPermitted(name) {
+		return syserror.EOPNOTSUPP
+	}
+	return unix.Fsetxattr(i.fileState.FD(), name, []byte(value), int(flags))
+}
+
+// ListXattr implements fs.InodeOperations.ListXattr.
+func (i *inodeOperations) ListXattr(context.Context, *fs.Inode, uint64) (map[string]struct{}, error) {
+	// Always retrieve the entire list, since names that aren't permitted
+	// are filtered out below and don't count towards the caller's size.
+	buf := make([]byte, linux.XATTR_LIST_MAX)
+	n, err := unix.Flistxattr(i.fileState.FD(), buf)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]struct{})
+	for _, name := range bytes.Split(buf[:n], []byte{0}) {
+		if len(name) != 0 && hostXattrPermitted(string(name)) {
+			names[string(name)] = struct{}{}
+		}
+	}
+	return names, nil
+}
+
+// RemoveXattr implements fs.InodeOperations.RemoveXattr.
+func (i *inodeOperations) RemoveXattr(_ context.Context, _ *fs.Inode, name string) error {
+	if !hostXattrPermitted(name) {
+		return syserror.EOPNOTSUPP
+	}
+	return unix.Fremovexattr(i.fileState.FD(), name)
+}
+
+// SupportsXattrs implements fs.InodeXattrSupportOperations.SupportsXattrs.
+func (*inodeOperations) SupportsXattrs(*fs.Inode) bool {
+	return true
+}
+
 // StatFS implements fs.InodeOperations.StatFS.
 func (i *inodeOperations) StatFS(context.Context) (fs.Info, error) {
 	return fs.Info{}, syserror.ENOSYS
@@ -15,10 +15,14 @@
 package host
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/syserror"
 )
 
 // TestCloseFD verifies fds will be closed.
@@ -43,3 +47,67 @@ func TestCloseFD(t *testing.T) {
 		t.Errorf("want 0, nil (EOF) from read end, got %v, %v", c, err)
 	}
 }
+
+// TestXattrPassthrough verifies that user xattrs are passed through to the
+// host file, and that other namespaces are not.
+func TestXattrPassthrough(t *testing.T) {
+	hostFile, err := ioutil.TempFile("", "host_xattr_test_")
+	if err != nil {
+		t.Fatalf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(hostFile.Name())
+	defer hostFile.Close()
+	if err := unix.Fsetxattr(int(hostFile.Fd()), "user.host", []byte("a"), 0 /* flags */); err != nil {
+		if err == unix.EOPNOTSUPP {
+			t.Skipf("host filesystem doesn't support user xattrs")
+		}
+		t.Fatalf("host fsetxattr failed: %v", err)
+	}
+
+	fd, err := unix.Dup(int(hostFile.Fd()))
+	if err != nil {
+		t.Fatalf("dup failed: %v", err)
+	}
+	ctx := contexttest.Context(t)
+	file, err := NewFile(ctx, fd)
+	if err != nil {
+		unix.Close(fd)
+		t.Fatalf("NewFile failed: %v", err)
+	}
+	defer file.DecRef(ctx)
+	inode := file.Dirent.Inode
+
+	if got, err := inode.GetXattr(ctx, "user.host", linux.XATTR_SIZE_MAX); err != nil || got != "a" {
+		t.Errorf("GetXattr got (%q, %v), want (%q, nil)", got, err, "a")
+	}
+	if err := inode.SetXattr(ctx, file.Dirent, "user.sentry", "b", 0 /* flags */); err != nil {
+		t.Fatalf("SetXattr failed: %v", err)
+	}
+	buf := make([]byte, 1)
+	if n, err := unix.Fgetxattr(int(hostFile.Fd()), "user.sentry", buf); err != nil || string(buf[:n]) != "b" {
+		t.Errorf("host fgetxattr got (%q, %v), want (%q, nil)", buf[:n], err, "b")
+	}
+	names, err := inode.ListXattr(ctx, linux.XATTR_LIST_MAX)
+	if err != nil {
+		t.Fatalf("ListXattr failed: %v", err)
+	}
+	if _, ok := names["user.host"]; !ok || len(names) != 2 {
+		t.Errorf("ListXattr got %v, want user.host and user.sentry", names)
+	}
+	if err := inode.RemoveXattr(ctx, file.Dirent, "user.host"); err != nil {
+		t.Errorf("RemoveXattr failed: %v", err)
+	}
+	if _, err := unix.Fgetxattr(int(hostFile.Fd()), "user.host", buf); err != unix.ENODATA {
+		t.Errorf("host fgetxattr after RemoveXattr got error %v, want %v", err, unix.ENODATA)
+	}
+
+	// Other namespaces are never passed through.
+	for _, name := range []string{"trusted.test", "security.test", linux.XATTR_NAME_POSIX_ACL_ACCESS} {
+		if _, err := inode.GetXattr(ctx, name, linux.XATTR_SIZE_MAX); err != syserror.EOPNOTSUPP {
+			t.Errorf("GetXattr(%q) got error %v, want %v", name, err, syserror.EOPNOTSUPP)
+		}
+		if err := inode.SetXattr(ctx, file.Dirent, name, "", 0 /* flags */); err != syserror.EOPNOTSUPP {
+			t.Errorf("SetXattr(%q) got error %v, want %v", name, err, syserror.EOPNOTSUPP)
+		}
+	}
+}
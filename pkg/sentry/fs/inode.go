@@ -15,6 +15,8 @@
 package fs
 
 import (
+	"strings"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/log"
@@ -60,6 +62,10 @@ type Inode struct {
 	// have to take this lock for read. Write operations to files with
 	// O_APPEND have to take this lock for write.
 	appendMu sync.RWMutex `state:"nosave"`
+
+	// aclCache caches the decoded access ACL of the Inode for permission
+	// checks. It is not used by overlay Inodes.
+	aclCache aclCache `state:"nosave"`
 }
 
 // LockCtx is an Inode's lock context and contains different personalities of locks; both
@@ -265,12 +271,105 @@ func (i *Inode) GetXattr(ctx context.Context, name string, size uint64) (string,
 	return i.InodeOperations.GetXattr(ctx, i, name, size)
 }
 
+// GetXattrFull returns the complete value of i's extended attribute name. It
+// is intended for callers other than getxattr(2), such as GetAllXattrs and
+// POSIX ACL checks, that have no user buffer size to pass to GetXattr.
+func (i *Inode) GetXattrFull(ctx context.Context, name string) (string, error) {
+	// No value can be stored that is longer than XATTR_SIZE_MAX, so this
+	// size never truncates or rejects one.
+	return i.GetXattr(ctx, name, linux.XATTR_SIZE_MAX)
+}
+
+// GetXattrSize returns the length of the value of the extended attribute name.
+// If i's InodeOperations don't implement InodeXattrSizeOperations, the value
+// is retrieved in full.
+func (i *Inode) GetXattrSize(ctx context.Context, name string) (int, error) {
+	if i.overlay == nil {
+		if ops, ok := i.InodeOperations.(InodeXattrSizeOperations); ok {
+			return ops.GetXattrSize(ctx, i, name)
+		}
+	}
+	value, err := i.GetXattrFull(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	return len(value), nil
+}
+
 // SetXattr calls i.InodeOperations.SetXattr with i as the Inode.
 func (i *Inode) SetXattr(ctx context.Context, d *Dirent, name, value string, flags uint32) error {
 	if i.overlay != nil {
 		return overlaySetXattr(ctx, i.overlay, d, name, value, flags)
 	}
-	return i.InodeOperations.SetXattr(ctx, i, name, value, flags)
+	err := i.InodeOperations.SetXattr(ctx, i, name, value, flags)
+	i.xattrChanged(name)
+	return err
+}
+
+// GetAndSetXattr atomically reads i's extended attribute name and, if cond
+// returns true for its value, sets it to value. It returns the value read and
+// whether value was set. Since the update can't be made atomic otherwise, it
+// returns EOPNOTSUPP if i's InodeOperations don't implement
+// InodeXattrGetAndSetOperations. As with SetXattr, d is only used if i is an
+// overlay Inode.
+func (i *Inode) GetAndSetXattr(ctx context.Context, d *Dirent, name, value string, cond func(old string, exists bool) bool) (string, bool, error) {
+	if i.overlay != nil {
+		return overlayGetAndSetXattr(ctx, i.overlay, d, name, value, cond)
+	}
+	ops, ok := i.InodeOperations.(InodeXattrGetAndSetOperations)
+	if !ok {
+		return "", false, syserror.EOPNOTSUPP
+	}
+	old, set, err := ops.GetAndSetXattr(ctx, i, name, value, cond)
+	i.xattrChanged(name)
+	return old, set, err
+}
+
+// RenameXattr atomically moves the value of i's extended attribute oldName to
+// newName, replacing any existing value of newName. Since the rename can't be
+// made atomic otherwise, it returns EOPNOTSUPP if i's InodeOperations don't
+// implement InodeXattrRenameOperations. As with SetXattr, d is only used if i
+// is an overlay Inode.
+func (i *Inode) RenameXattr(ctx context.Context, d *Dirent, oldName, newName string) error {
+	if i.overlay != nil {
+		return overlayRenameXattr(ctx, i.overlay, d, oldName, newName)
+	}
+	ops, ok := i.InodeOperations.(InodeXattrRenameOperations)
+	if !ok {
+		return syserror.EOPNOTSUPP
+	}
+	err := ops.RenameXattr(ctx, i, oldName, newName)
+	i.xattrChanged(oldName)
+	i.xattrChanged(newName)
+	return err
+}
+
+// ClearXattrs atomically removes all of i's extended attributes in the user
+// namespace. Since this can't be made atomic otherwise, it returns EOPNOTSUPP
+// if i's InodeOperations don't implement InodeXattrClearOperations. As with
+// SetXattr, d is only used if i is an overlay Inode.
+func (i *Inode) ClearXattrs(ctx context.Context, d *Dirent) error {
+	if i.overlay != nil {
+		return overlayClearXattrs(ctx, i.overlay, d)
+	}
+	ops, ok := i.InodeOperations.(InodeXattrClearOperations)
+	if !ok {
+		return syserror.EOPNOTSUPP
+	}
+	return ops.ClearXattrs(ctx, i)
+}
+
+// XattrUsage returns the number of bytes used by i's extended attributes. It
+// returns 0 if i's InodeOperations don't implement InodeXattrUsageOperations,
+// and for overlay Inodes.
+func (i *Inode) XattrUsage() uint64 {
+	if i.overlay != nil {
+		return 0
+	}
+	if ops, ok := i.InodeOperations.(InodeXattrUsageOperations); ok {
+		return ops.XattrUsage(i)
+	}
+	return 0
 }
 
 // ListXattr calls i.InodeOperations.ListXattr with i as the Inode.
@@ -281,12 +380,145 @@ func (i *Inode) ListXattr(ctx context.Context, size uint64) (map[string]struct{}
 	return i.InodeOperations.ListXattr(ctx, i, size)
 }
 
+// WalkXattrs calls fn with the name of each of i's extended attributes. If i's
+// InodeOperations implement InodeXattrWalkOperations, names are passed to fn as
+// they are found; otherwise they are listed with ListXattr first.
+func (i *Inode) WalkXattrs(ctx context.Context, fn func(name string)) error {
+	if i.overlay == nil {
+		if ops, ok := i.InodeOperations.(InodeXattrWalkOperations); ok {
+			return ops.WalkXattrs(ctx, i, fn)
+		}
+	}
+	names, err := i.ListXattr(ctx, linux.XATTR_LIST_MAX)
+	if err != nil {
+		return err
+	}
+	for name := range names {
+		fn(name)
+	}
+	return nil
+}
+
 // RemoveXattr calls i.InodeOperations.RemoveXattr with i as the Inode.
 func (i *Inode) RemoveXattr(ctx context.Context, d *Dirent, name string) error {
 	if i.overlay != nil {
 		return overlayRemoveXattr(ctx, i.overlay, d, name)
 	}
-	return i.InodeOperations.RemoveXattr(ctx, i, name)
+	err := i.InodeOperations.RemoveXattr(ctx, i, name)
+	i.xattrChanged(name)
+	return err
+}
+
+// xattrChanged is called after i's extended attribute name may have changed.
+//
+// Preconditions: i is not an overlay Inode.
+func (i *Inode) xattrChanged(name string) {
+	if name == linux.XATTR_NAME_POSIX_ACL_ACCESS {
+		i.aclCache.invalidate()
+	}
+}
+
+// GetAllXattrs returns all of i's extended attributes. If i's InodeOperations
+// implement InodeBulkXattrOperations they are retrieved in a single call,
+// otherwise they are listed and retrieved one at a time.
+func (i *Inode) GetAllXattrs(ctx context.Context) (map[string]string, error) {
+	if i.overlay == nil {
+		if ops, ok := i.InodeOperations.(InodeBulkXattrOperations); ok {
+			return ops.GetAllXattrs(ctx, i)
+		}
+	}
+	names, err := i.ListXattr(ctx, linux.XATTR_SIZE_MAX)
+	if err != nil {
+		return nil, err
+	}
+	xattrs := make(map[string]string, len(names))
+	for name := range names {
+		value, err := i.GetXattrFull(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		xattrs[name] = value
+	}
+	return xattrs, nil
+}
+
+// SetAllXattrs sets each extended attribute in xattrs on i, overwriting any
+// existing value. If i's InodeOperations implement InodeBulkXattrOperations
+// they are set in a single call, otherwise they are set one at a time. As with
+// SetXattr, d is only used if i is an overlay Inode.
+func (i *Inode) SetAllXattrs(ctx context.Context, d *Dirent, xattrs map[string]string) error {
+	if i.overlay == nil {
+		if ops, ok := i.InodeOperations.(InodeBulkXattrOperations); ok {
+			err := ops.SetAllXattrs(ctx, i, xattrs)
+			i.aclCache.invalidate()
+			return err
+		}
+	}
+	for name, value := range xattrs {
+		if err := i.SetXattr(ctx, d, name, value, 0 /* flags */); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyXattrs copies src's user.* and trusted.* extended attributes to dst,
+// overwriting any existing values, so that they are preserved when image
+// layers are merged. Filesystem-internal attributes, such as the overlay's
+// trusted.overlay.* attributes, are not copied. If src doesn't support
+// extended attributes, nothing is copied. Overlay copy-up doesn't use
+// CopyXattrs, since it must preserve all other attributes, including
+// security.*.
+//
+// The attributes are read with GetAllXattrs and written with SetAllXattrs, so
+// the copy is atomic if both Inodes implement InodeBulkXattrOperations. As with
+// SetXattr, d is only used if dst is an overlay Inode.
+func CopyXattrs(ctx context.Context, dst *Inode, d *Dirent, src *Inode) error {
+	xattrs, err := src.GetAllXattrs(ctx)
+	if err == syserror.EOPNOTSUPP {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for name := range xattrs {
+		if !inheritableXattr(name) {
+			delete(xattrs, name)
+		}
+	}
+	if len(xattrs) == 0 {
+		return nil
+	}
+	return dst.SetAllXattrs(ctx, d, xattrs)
+}
+
+// inheritableXattr returns true if CopyXattrs copies the extended attribute
+// name.
+func inheritableXattr(name string) bool {
+	if isXattrOverlay(name) {
+		return false
+	}
+	return strings.HasPrefix(name, linux.XATTR_USER_PREFIX) || strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX)
+}
+
+// SupportsXattrs returns false if i's InodeOperations implement
+// InodeXattrSupportOperations and don't support extended attributes for i.
+func (i *Inode) SupportsXattrs() bool {
+	if i.overlay != nil {
+		return overlaySupportsXattrs(i.overlay)
+	}
+	ops, ok := i.InodeOperations.(InodeXattrSupportOperations)
+	return !ok || ops.SupportsXattrs(i)
+}
+
+// SupportsPOSIXACLs returns true if i's InodeOperations implement
+// InodePOSIXACLOperations and support POSIX ACLs for i.
+func (i *Inode) SupportsPOSIXACLs() bool {
+	if i.overlay != nil {
+		return overlaySupportsPOSIXACLs(i.overlay)
+	}
+	ops, ok := i.InodeOperations.(InodePOSIXACLOperations)
+	return ok && ops.SupportsPOSIXACLs(i)
 }
 
 // CheckPermission will check if the caller may access this file in the
@@ -296,27 +528,34 @@ func (i *Inode) RemoveXattr(ctx context.Context, d *Dirent, name string) error {
 // - checks file system mount flags,
 // - and utilizes InodeOperations.Check to check capabilities and modes.
 func (i *Inode) CheckPermission(ctx context.Context, p PermMask) error {
+	if p.Write {
+		if err := i.CheckWritableMount(); err != nil {
+			return err
+		}
+	}
+	return i.check(ctx, p)
+}
+
+// CheckWritableMount returns EROFS if i may not be modified because it is on
+// a read-only mount. It is like Linux's fs/namespace.c:mnt_want_write.
+func (i *Inode) CheckWritableMount() error {
 	// First check the outer-most mounted filesystem.
-	if p.Write && i.MountSource.Flags.ReadOnly {
+	if i.MountSource.Flags.ReadOnly {
 		return syserror.EROFS
 	}
 
 	if i.overlay != nil {
-		// CheckPermission requires some special handling for
-		// an overlay.
-		//
 		// Writes will always be redirected to an upper filesystem,
 		// so ignore all lower layers being read-only.
 		//
 		// But still honor the upper-most filesystem's mount flags;
 		// we should not attempt to modify the writable layer if it
 		// is mounted read-only.
-		if p.Write && overlayUpperMountSource(i.MountSource).Flags.ReadOnly {
+		if overlayUpperMountSource(i.MountSource).Flags.ReadOnly {
 			return syserror.EROFS
 		}
 	}
-
-	return i.check(ctx, p)
+	return nil
 }
 
 func (i *Inode) check(ctx context.Context, p PermMask) error {
@@ -181,10 +181,23 @@ type InodeOperations interface {
 	// return ERANGE to indicate that the buffer is too small, but they are also
 	// free to ignore the hint entirely (i.e. the value returned may be larger
 	// than size). All size checking is done independently at the syscall layer.
+	//
+	// Implementations that block may return syserror.ErrInterrupted if ctx
+	// is interrupted. Since retrieving a value has no side effects, the
+	// syscall is always restarted.
 	GetXattr(ctx context.Context, inode *Inode, name string, size uint64) (string, error)
 
 	// SetXattr sets the value of extended attribute specified by name. Inodes
 	// that do not support extended attributes return EOPNOTSUPP.
+	//
+	// If flags contains XATTR_CREATE and name already has a value,
+	// implementations must return EEXIST. If flags contains XATTR_REPLACE and
+	// name has no value, implementations must return ENODATA. If neither flag
+	// is set, any existing value is overwritten.
+	//
+	// Implementations that block may return syserror.ErrInterrupted if ctx
+	// is interrupted, but only if the attribute is left unchanged: the
+	// syscall is restarted, and must not observe a partially written value.
 	SetXattr(ctx context.Context, inode *Inode, name, value string, flags uint32) error
 
 	// ListXattr returns the set of all extended attributes names that
@@ -197,10 +210,16 @@ type InodeOperations interface {
 	// return ERANGE to indicate that the buffer is too small, but they are also
 	// free to ignore the hint entirely. All size checking is done independently
 	// at the syscall layer.
+	//
+	// As with GetXattr, syserror.ErrInterrupted may be returned if ctx is
+	// interrupted.
 	ListXattr(ctx context.Context, inode *Inode, size uint64) (map[string]struct{}, error)
 
 	// RemoveXattr removes an extended attribute specified by name. Inodes that
 	// do not support extended attributes return EOPNOTSUPP.
+	//
+	// As with SetXattr, syserror.ErrInterrupted may only be returned if the
+	// attribute was not removed.
 	RemoveXattr(ctx context.Context, inode *Inode, name string) error
 
 	// Check determines whether an Inode can be accessed with the
@@ -324,3 +343,108 @@ type InodeOperations interface {
 	// it will), then ENOSYS should be returned.
 	StatFS(context.Context) (Info, error)
 }
+
+// InodePOSIXACLOperations is an optional interface that InodeOperations may
+// implement if the underlying filesystem supports POSIX ACLs. ACLs are
+// accessed through the system.posix_acl_access and system.posix_acl_default
+// extended attributes, which are only passed to the InodeOperations xattr
+// methods if SupportsPOSIXACLs returns true.
+type InodePOSIXACLOperations interface {
+	// SupportsPOSIXACLs returns true if inode can store POSIX ACLs.
+	SupportsPOSIXACLs(inode *Inode) bool
+}
+
+// InodeXattrSupportOperations is an optional interface that InodeOperations
+// may implement to report whether the underlying filesystem supports extended
+// attributes at all. If SupportsXattrs returns false, xattr syscalls fail with
+// EOPNOTSUPP, or return an empty list, without calling the InodeOperations
+// xattr methods. InodeOperations that don't implement this interface are
+// assumed to support extended attributes.
+type InodeXattrSupportOperations interface {
+	// SupportsXattrs returns true if inode can have extended attributes.
+	SupportsXattrs(inode *Inode) bool
+}
+
+// InodeBulkXattrOperations is an optional interface that InodeOperations may
+// implement to get or set all of an inode's extended attributes at once,
+// rather than one attribute per call. It is only used internally, by overlay
+// copy-up, CopyXattrs and when saving fsutil.InodeSimpleExtendedAttributes;
+// syscalls always use the per-attribute methods.
+type InodeBulkXattrOperations interface {
+	// GetAllXattrs returns all of inode's extended attributes.
+	GetAllXattrs(ctx context.Context, inode *Inode) (map[string]string, error)
+
+	// SetAllXattrs sets each extended attribute in xattrs on inode,
+	// overwriting any existing value. Extended attributes not in xattrs are
+	// left unchanged.
+	SetAllXattrs(ctx context.Context, inode *Inode, xattrs map[string]string) error
+}
+
+// InodeXattrGetAndSetOperations is an optional interface that InodeOperations
+// may implement to read and conditionally replace an extended attribute
+// atomically, e.g. for compare-and-swap style metadata updates. It is only used
+// internally; there is no corresponding syscall.
+type InodeXattrGetAndSetOperations interface {
+	// GetAndSetXattr reads the value of the extended attribute name and, if
+	// cond returns true for it, sets name to value. No other change to name
+	// may happen in between. exists is false if name has no value.
+	// GetAndSetXattr returns the value read and whether value was set.
+	//
+	// cond must not call back into inode's extended attribute methods.
+	GetAndSetXattr(ctx context.Context, inode *Inode, name, value string, cond func(old string, exists bool) bool) (string, bool, error)
+}
+
+// InodeXattrRenameOperations is an optional interface that InodeOperations may
+// implement to rename an extended attribute atomically, e.g. for transactional
+// metadata updates. It is only used internally; there is no corresponding
+// syscall.
+type InodeXattrRenameOperations interface {
+	// RenameXattr moves the value of the extended attribute oldName to
+	// newName, replacing any existing value of newName. Concurrent readers
+	// must see either oldName or newName, never neither. It fails with
+	// ENODATA if oldName has no value.
+	RenameXattr(ctx context.Context, inode *Inode, oldName, newName string) error
+}
+
+// InodeXattrUsageOperations is an optional interface that InodeOperations may
+// implement to report the storage used by their extended attributes, e.g. for
+// statfs(2) accounting.
+type InodeXattrUsageOperations interface {
+	// XattrUsage returns the total length, in bytes, of the names and values
+	// of inode's extended attributes.
+	XattrUsage(inode *Inode) uint64
+}
+
+// InodeXattrClearOperations is an optional interface that InodeOperations may
+// implement to remove all of an inode's user extended attributes at once, e.g.
+// to restore a file to a pristine state. There is no corresponding syscall,
+// and nothing in the sentry calls it yet: Linux keeps extended attributes
+// across truncate and copy, so no existing operation needs to clear them.
+type InodeXattrClearOperations interface {
+	// ClearXattrs removes every extended attribute in the user namespace.
+	// Concurrent readers must see either all of them or none of them.
+	// Attributes in other namespaces are left unchanged.
+	ClearXattrs(ctx context.Context, inode *Inode) error
+}
+
+// InodeXattrSizeOperations is an optional interface that InodeOperations may
+// implement to report the length of an extended attribute's value without
+// retrieving it, e.g. for getxattr(2) with a size of 0. Implementations are
+// worthwhile for filesystems whose values are expensive to retrieve.
+type InodeXattrSizeOperations interface {
+	// GetXattrSize returns the length of the value of the extended
+	// attribute name. It fails with the same errors as GetXattr.
+	GetXattrSize(ctx context.Context, inode *Inode, name string) (int, error)
+}
+
+// InodeXattrWalkOperations is an optional interface that InodeOperations may
+// implement to enumerate extended attribute names without building a set of
+// all of them, as ListXattr does.
+type InodeXattrWalkOperations interface {
+	// WalkXattrs calls fn with the name of each of inode's extended
+	// attributes, in no particular order. The names must form a snapshot:
+	// listxattr(2) relies on it to never return a torn list when
+	// attributes are concurrently set or removed. fn must not call back
+	// into inode's extended attribute methods.
+	WalkXattrs(ctx context.Context, inode *Inode, fn func(name string)) error
+}
@@ -20,6 +20,7 @@ import (
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/fsmetric"
 	"gvisor.dev/gvisor/pkg/sentry/socket/unix/transport"
 	"gvisor.dev/gvisor/pkg/syserror"
 )
@@ -571,12 +572,45 @@ func overlaySetXattr(ctx context.Context, o *overlayEntry, d *Dirent, name, valu
 		return syserror.EPERM
 	}
 
-	if err := copyUp(ctx, d); err != nil {
+	if err := overlayXattrCopyUp(ctx, o, d); err != nil {
 		return err
 	}
 	return o.upper.SetXattr(ctx, d, name, value, flags)
 }
 
+func overlayGetAndSetXattr(ctx context.Context, o *overlayEntry, d *Dirent, name, value string, cond func(old string, exists bool) bool) (string, bool, error) {
+	// As in overlaySetXattr, overlay xattrs can't be changed.
+	if isXattrOverlay(name) {
+		return "", false, syserror.EPERM
+	}
+
+	if err := overlayXattrCopyUp(ctx, o, d); err != nil {
+		return "", false, err
+	}
+	return o.upper.GetAndSetXattr(ctx, d, name, value, cond)
+}
+
+func overlayRenameXattr(ctx context.Context, o *overlayEntry, d *Dirent, oldName, newName string) error {
+	// As in overlaySetXattr, overlay xattrs can't be changed.
+	if isXattrOverlay(oldName) || isXattrOverlay(newName) {
+		return syserror.EPERM
+	}
+
+	if err := overlayXattrCopyUp(ctx, o, d); err != nil {
+		return err
+	}
+	return o.upper.RenameXattr(ctx, d, oldName, newName)
+}
+
+func overlayClearXattrs(ctx context.Context, o *overlayEntry, d *Dirent) error {
+	// Overlay xattrs are outside the user namespace, so they are never
+	// cleared.
+	if err := overlayXattrCopyUp(ctx, o, d); err != nil {
+		return err
+	}
+	return o.upper.ClearXattrs(ctx, d)
+}
+
 func overlayListXattr(ctx context.Context, o *overlayEntry, size uint64) (map[string]struct{}, error) {
 	o.copyMu.RLock()
 	defer o.copyMu.RUnlock()
@@ -603,12 +637,59 @@ func overlayRemoveXattr(ctx context.Context, o *overlayEntry, d *Dirent, name st
 		return syserror.EPERM
 	}
 
-	if err := copyUp(ctx, d); err != nil {
+	if err := overlayXattrCopyUp(ctx, o, d); err != nil {
 		return err
 	}
 	return o.upper.RemoveXattr(ctx, d, name)
 }
 
+// overlayXattrCopyUp copies up d, whose overlay entry is o, before its
+// extended attributes are changed.
+func overlayXattrCopyUp(ctx context.Context, o *overlayEntry, d *Dirent) error {
+	o.copyMu.RLock()
+	lowerOnly := o.upper == nil
+	o.copyMu.RUnlock()
+	if err := copyUp(ctx, d); err != nil {
+		return err
+	}
+	// This may count a copy up that raced with another operation, which is
+	// fine for a metric.
+	if lowerOnly {
+		fsmetric.XattrCopyUps.Increment()
+	}
+	return nil
+}
+
+func overlaySupportsXattrs(o *overlayEntry) bool {
+	o.copyMu.RLock()
+	defer o.copyMu.RUnlock()
+	if o.upper != nil {
+		return o.upper.SupportsXattrs()
+	}
+	// Setting an extended attribute copies the file up, so whether the lower
+	// filesystem supports them doesn't decide it.
+	return true
+}
+
+func overlaySupportsPOSIXACLs(o *overlayEntry) bool {
+	o.copyMu.RLock()
+	defer o.copyMu.RUnlock()
+	if o.upper != nil {
+		return o.upper.SupportsPOSIXACLs()
+	}
+	return o.lower.SupportsPOSIXACLs()
+}
+
+// overlayACLInode returns the Inode that holds o's POSIX ACLs.
+func overlayACLInode(o *overlayEntry) *Inode {
+	o.copyMu.RLock()
+	defer o.copyMu.RUnlock()
+	if o.upper != nil {
+		return o.upper
+	}
+	return o.lower
+}
+
 func overlayCheck(ctx context.Context, o *overlayEntry, p PermMask) error {
 	o.copyMu.RLock()
 	// Hot path. Avoid defers.
@@ -371,6 +371,43 @@ func TestCacheFlush(t *testing.T) {
 
 }
 
+// TestOverlayXattrHidden checks that the overlay's own trusted.overlay.* xattrs
+// in a lower filesystem can't be observed or changed through the overlay.
+func TestOverlayXattrHidden(t *testing.T) {
+	ctx := contexttest.Context(t)
+	name := fs.XattrOverlayWhiteout("foo")
+	_, d := makeOverlayXattrTestFile(t, map[string]string{
+		name:        "y",
+		"user.test": "",
+	})
+
+	for _, copiedUp := range []bool{false, true} {
+		if copiedUp {
+			// Copy up, which must not copy the overlay's xattrs.
+			if err := d.Inode.SetXattr(ctx, d, "user.test", "", 0 /* flags */); err != nil {
+				t.Fatalf("SetXattr(user.test) failed: %v", err)
+			}
+		}
+
+		if _, err := d.Inode.GetXattr(ctx, name, 1); err != syserror.ENODATA {
+			t.Errorf("GetXattr(%s) with copiedUp=%t got err %v want %v", name, copiedUp, err, syserror.ENODATA)
+		}
+		names, err := d.Inode.ListXattr(ctx, 100)
+		if err != nil {
+			t.Fatalf("ListXattr with copiedUp=%t failed: %v", copiedUp, err)
+		}
+		if _, ok := names[name]; ok || len(names) != 1 {
+			t.Errorf("ListXattr with copiedUp=%t got %v want only user.test", copiedUp, names)
+		}
+		if err := d.Inode.SetXattr(ctx, d, name, "y", 0 /* flags */); err != syserror.EPERM {
+			t.Errorf("SetXattr(%s) with copiedUp=%t got err %v want %v", name, copiedUp, err, syserror.EPERM)
+		}
+		if err := d.Inode.RemoveXattr(ctx, d, name); err != syserror.EPERM {
+			t.Errorf("RemoveXattr(%s) with copiedUp=%t got err %v want %v", name, copiedUp, err, syserror.EPERM)
+		}
+	}
+}
+
 type dir struct {
 	fs.InodeOperations
 
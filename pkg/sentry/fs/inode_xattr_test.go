@@ -0,0 +1,384 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"fmt"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/syserror"
+)
+
+// interruptibleContext is a Context whose interruptible sleeps end when
+// interrupt is closed, as when a signal is delivered to a task.
+type interruptibleContext struct {
+	context.Context
+	interrupt chan struct{}
+}
+
+// SleepStart implements context.ChannelSleeper.SleepStart.
+func (ctx *interruptibleContext) SleepStart() <-chan struct{} {
+	return ctx.interrupt
+}
+
+// Interrupted implements context.ChannelSleeper.Interrupted.
+func (ctx *interruptibleContext) Interrupted() bool {
+	select {
+	case <-ctx.interrupt:
+		return true
+	default:
+		return false
+	}
+}
+
+// slowXattrInodeOperations stores extended attributes in a backend that blocks
+// each write until proceed is closed, or until the caller is interrupted.
+type slowXattrInodeOperations struct {
+	*MockInodeOperations
+
+	// started receives a value when a write begins to block.
+	started chan struct{}
+	proceed chan struct{}
+	xattrs  map[string]string
+}
+
+// GetXattr implements InodeOperations.GetXattr.
+func (i *slowXattrInodeOperations) GetXattr(_ context.Context, _ *Inode, name string, _ uint64) (string, error) {
+	value, ok := i.xattrs[name]
+	if !ok {
+		return "", syserror.ENODATA
+	}
+	return value, nil
+}
+
+// SetXattr implements InodeOperations.SetXattr.
+func (i *slowXattrInodeOperations) SetXattr(ctx context.Context, _ *Inode, name, value string, _ uint32) error {
+	i.started <- struct{}{}
+	select {
+	case <-ctx.SleepStart():
+		ctx.SleepFinish(false)
+		return syserror.ErrInterrupted
+	case <-i.proceed:
+		ctx.SleepFinish(true)
+	}
+	i.xattrs[name] = value
+	return nil
+}
+
+func TestSetXattrInterrupted(t *testing.T) {
+	ctx := &interruptibleContext{
+		Context:   contexttest.Context(t),
+		interrupt: make(chan struct{}),
+	}
+	ops := &slowXattrInodeOperations{
+		MockInodeOperations: NewMockInodeOperations(ctx),
+		started:             make(chan struct{}),
+		proceed:             make(chan struct{}),
+		xattrs:              make(map[string]string),
+	}
+	inode := NewInode(ctx, ops, NewMockMountSource(nil), StableAttr{Type: RegularFile})
+	defer inode.DecRef(ctx)
+
+	const name = "trusted.test"
+	value := string(make([]byte, linux.XATTR_SIZE_MAX))
+	errs := make(chan error)
+	set := func() {
+		errs <- inode.SetXattr(ctx, nil, name, value, 0 /* flags */)
+	}
+
+	// Deliver a "signal" while the write is blocked.
+	go set()
+	<-ops.started
+	close(ctx.interrupt)
+	err := <-errs
+	if got := syserror.ConvertIntr(err, syserror.ERESTARTSYS); got != syserror.ERESTARTSYS {
+		t.Fatalf("SetXattr interrupted got err %v want %v", got, syserror.ERESTARTSYS)
+	}
+	if _, err := inode.GetXattr(ctx, name, linux.XATTR_SIZE_MAX); err != syserror.ENODATA {
+		t.Errorf("GetXattr after interrupted SetXattr got err %v want %v", err, syserror.ENODATA)
+	}
+
+	// The restarted syscall applies the whole value.
+	ctx.interrupt = make(chan struct{})
+	go set()
+	<-ops.started
+	close(ops.proceed)
+	if err := <-errs; err != nil {
+		t.Fatalf("SetXattr after restart failed: %v", err)
+	}
+	got, err := inode.GetXattr(ctx, name, linux.XATTR_SIZE_MAX)
+	if err != nil {
+		t.Fatalf("GetXattr failed: %v", err)
+	}
+	if got != value {
+		t.Errorf("GetXattr got a value of length %d want %d", len(got), len(value))
+	}
+}
+
+// remoteXattrInodeOperations stores extended attributes in a backend from which
+// each value must be copied, as when it is retrieved from a gofer.
+type remoteXattrInodeOperations struct {
+	*MockInodeOperations
+
+	xattrs map[string]string
+
+	// gets is the number of values retrieved.
+	gets int
+}
+
+// GetXattr implements InodeOperations.GetXattr.
+func (i *remoteXattrInodeOperations) GetXattr(_ context.Context, _ *Inode, name string, _ uint64) (string, error) {
+	value, ok := i.xattrs[name]
+	if !ok {
+		return "", syserror.ENODATA
+	}
+	i.gets++
+	return string(append([]byte(nil), value...)), nil
+}
+
+// sizedXattrInodeOperations can also report value lengths without retrieving
+// the values.
+type sizedXattrInodeOperations struct {
+	remoteXattrInodeOperations
+}
+
+// GetXattrSize implements InodeXattrSizeOperations.GetXattrSize.
+func (i *sizedXattrInodeOperations) GetXattrSize(_ context.Context, _ *Inode, name string) (int, error) {
+	value, ok := i.xattrs[name]
+	if !ok {
+		return 0, syserror.ENODATA
+	}
+	return len(value), nil
+}
+
+func TestGetXattrSize(t *testing.T) {
+	ctx := contexttest.Context(t)
+	const name = "user.test"
+	value := string(make([]byte, 100))
+	remote := remoteXattrInodeOperations{
+		MockInodeOperations: NewMockInodeOperations(ctx),
+		xattrs:              map[string]string{name: value},
+	}
+	sized := &sizedXattrInodeOperations{remote}
+	for _, test := range []struct {
+		name     string
+		ops      InodeOperations
+		gets     *int
+		wantGets int
+	}{
+		{
+			name:     "fallback",
+			ops:      &remote,
+			gets:     &remote.gets,
+			wantGets: 1,
+		},
+		{
+			name:     "GetXattrSize",
+			ops:      sized,
+			gets:     &sized.gets,
+			wantGets: 0,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			inode := NewInode(ctx, test.ops, NewMockMountSource(nil), StableAttr{Type: RegularFile})
+			defer inode.DecRef(ctx)
+
+			n, err := inode.GetXattrSize(ctx, name)
+			if err != nil {
+				t.Fatalf("GetXattrSize failed: %v", err)
+			}
+			if n != len(value) {
+				t.Errorf("GetXattrSize got %d want %d", n, len(value))
+			}
+			if *test.gets != test.wantGets {
+				t.Errorf("GetXattrSize retrieved %d values, want %d", *test.gets, test.wantGets)
+			}
+			if _, err := inode.GetXattrSize(ctx, "user.missing"); err != syserror.ENODATA {
+				t.Errorf("GetXattrSize of missing attribute got err %v want %v", err, syserror.ENODATA)
+			}
+		})
+	}
+}
+
+// BenchmarkGetXattrProbe measures getxattr(2)'s probe-then-read pattern, with
+// the probe either retrieving the value or only its length.
+func BenchmarkGetXattrProbe(b *testing.B) {
+	ctx := contexttest.Context(b)
+	const name = "user.test"
+	remote := remoteXattrInodeOperations{
+		MockInodeOperations: NewMockInodeOperations(ctx),
+		xattrs:              map[string]string{name: string(make([]byte, linux.XATTR_SIZE_MAX))},
+	}
+	for _, test := range []struct {
+		name string
+		ops  InodeOperations
+	}{
+		{name: "Fallback", ops: &remote},
+		{name: "GetXattrSize", ops: &sizedXattrInodeOperations{remote}},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			inode := NewInode(ctx, test.ops, NewMockMountSource(nil), StableAttr{Type: RegularFile})
+			defer inode.DecRef(ctx)
+			for i := 0; i < b.N; i++ {
+				n, err := inode.GetXattrSize(ctx, name)
+				if err != nil {
+					b.Fatalf("GetXattrSize failed: %v", err)
+				}
+				if _, err := inode.GetXattr(ctx, name, uint64(n)); err != nil {
+					b.Fatalf("GetXattr failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// roundTripXattrInodeOperations stores extended attributes in a backend that
+// counts the requests made to it, as when each request is a gofer round trip.
+type roundTripXattrInodeOperations struct {
+	*MockInodeOperations
+
+	xattrs map[string]string
+
+	// roundTrips is the number of requests made to the backend.
+	roundTrips int
+}
+
+// SetXattr implements InodeOperations.SetXattr.
+func (i *roundTripXattrInodeOperations) SetXattr(_ context.Context, _ *Inode, name, value string, _ uint32) error {
+	i.roundTrips++
+	i.xattrs[name] = value
+	return nil
+}
+
+// bulkXattrInodeOperations can also set many attributes in one request.
+type bulkXattrInodeOperations struct {
+	roundTripXattrInodeOperations
+}
+
+// GetAllXattrs implements InodeBulkXattrOperations.GetAllXattrs.
+func (i *bulkXattrInodeOperations) GetAllXattrs(context.Context, *Inode) (map[string]string, error) {
+	i.roundTrips++
+	xattrs := make(map[string]string, len(i.xattrs))
+	for name, value := range i.xattrs {
+		xattrs[name] = value
+	}
+	return xattrs, nil
+}
+
+// SetAllXattrs implements InodeBulkXattrOperations.SetAllXattrs.
+func (i *bulkXattrInodeOperations) SetAllXattrs(_ context.Context, _ *Inode, xattrs map[string]string) error {
+	i.roundTrips++
+	for name, value := range xattrs {
+		i.xattrs[name] = value
+	}
+	return nil
+}
+
+// extractedXattrs returns n attributes like those restored by tar --xattrs.
+func extractedXattrs(n int) map[string]string {
+	xattrs := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		xattrs[fmt.Sprintf("user.tar.%d", i)] = fmt.Sprintf("value-%d", i)
+	}
+	return xattrs
+}
+
+func TestSetAllXattrs(t *testing.T) {
+	ctx := contexttest.Context(t)
+	xattrs := extractedXattrs(20)
+	single := roundTripXattrInodeOperations{
+		MockInodeOperations: NewMockInodeOperations(ctx),
+		xattrs:              make(map[string]string),
+	}
+	bulk := &bulkXattrInodeOperations{roundTripXattrInodeOperations{
+		MockInodeOperations: NewMockInodeOperations(ctx),
+		xattrs:              make(map[string]string),
+	}}
+	for _, test := range []struct {
+		name           string
+		ops            InodeOperations
+		backend        *roundTripXattrInodeOperations
+		wantRoundTrips int
+	}{
+		{
+			name:           "fallback",
+			ops:            &single,
+			backend:        &single,
+			wantRoundTrips: len(xattrs),
+		},
+		{
+			name:           "InodeBulkXattrOperations",
+			ops:            bulk,
+			backend:        &bulk.roundTripXattrInodeOperations,
+			wantRoundTrips: 1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			inode := NewInode(ctx, test.ops, NewMockMountSource(nil), StableAttr{Type: RegularFile})
+			defer inode.DecRef(ctx)
+
+			if err := inode.SetAllXattrs(ctx, nil, xattrs); err != nil {
+				t.Fatalf("SetAllXattrs failed: %v", err)
+			}
+			if test.backend.roundTrips != test.wantRoundTrips {
+				t.Errorf("SetAllXattrs made %d requests, want %d", test.backend.roundTrips, test.wantRoundTrips)
+			}
+			for name, want := range xattrs {
+				if got := test.backend.xattrs[name]; got != want {
+					t.Errorf("SetAllXattrs set %q to %q want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSetAllXattrs measures restoring a file's extended attributes, as
+// tar --xattrs does, either one request per attribute or in a single request.
+func BenchmarkSetAllXattrs(b *testing.B) {
+	ctx := contexttest.Context(b)
+	xattrs := extractedXattrs(20)
+	for _, test := range []struct {
+		name string
+		ops  InodeOperations
+	}{
+		{
+			name: "Fallback",
+			ops: &roundTripXattrInodeOperations{
+				MockInodeOperations: NewMockInodeOperations(ctx),
+				xattrs:              make(map[string]string),
+			},
+		},
+		{
+			name: "InodeBulkXattrOperations",
+			ops: &bulkXattrInodeOperations{roundTripXattrInodeOperations{
+				MockInodeOperations: NewMockInodeOperations(ctx),
+				xattrs:              make(map[string]string),
+			}},
+		},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			inode := NewInode(ctx, test.ops, NewMockMountSource(nil), StableAttr{Type: RegularFile})
+			defer inode.DecRef(ctx)
+			for i := 0; i < b.N; i++ {
+				if err := inode.SetAllXattrs(ctx, nil, xattrs); err != nil {
+					b.Fatalf("SetAllXattrs failed: %v", err)
+				}
+			}
+		})
+	}
+}
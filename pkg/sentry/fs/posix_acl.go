@@ -0,0 +1,341 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserror"
+)
+
+// POSIXACLEntry is an entry of a POSIX access control list.
+type POSIXACLEntry struct {
+	// Tag is the type of the entry, one of linux.ACL_*.
+	Tag uint16
+
+	// Perms are the permissions granted by the entry.
+	Perms PermMask
+
+	// ID is the user or group ID of ACL_USER and ACL_GROUP entries, and
+	// linux.ACL_UNDEFINED_ID for all others. ACLs stored by filesystems
+	// hold KUIDs and KGIDs; ACLs passed to and from userspace hold IDs in
+	// the caller's user namespace.
+	ID uint32
+}
+
+// POSIXACL is a POSIX access control list, as stored in the
+// system.posix_acl_access and system.posix_acl_default extended attributes.
+// See acl(5).
+//
+// The entries of a valid ACL are sorted by tag, in the order ACL_USER_OBJ,
+// ACL_USER, ACL_GROUP_OBJ, ACL_GROUP, ACL_MASK, ACL_OTHER, and always include
+// one ACL_USER_OBJ, ACL_GROUP_OBJ and ACL_OTHER entry. ACLs with ACL_USER or
+// ACL_GROUP entries must also include one ACL_MASK entry.
+type POSIXACL []POSIXACLEntry
+
+// DecodePOSIXACL decodes the extended attribute representation of an ACL. An
+// empty ACL, consisting of only the header, is returned as nil. Compare
+// Linux's fs/posix_acl.c:posix_acl_from_xattr() and posix_acl_valid().
+func DecodePOSIXACL(value []byte) (POSIXACL, error) {
+	if len(value) < linux.POSIX_ACL_XATTR_HEADER_SIZE {
+		return nil, syserror.EINVAL
+	}
+	if binary.LittleEndian.Uint32(value) != linux.POSIX_ACL_XATTR_VERSION {
+		return nil, syserror.EOPNOTSUPP
+	}
+	value = value[linux.POSIX_ACL_XATTR_HEADER_SIZE:]
+	if len(value)%linux.POSIX_ACL_XATTR_ENTRY_SIZE != 0 {
+		return nil, syserror.EINVAL
+	}
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	acl := make(POSIXACL, 0, len(value)/linux.POSIX_ACL_XATTR_ENTRY_SIZE)
+	for ; len(value) > 0; value = value[linux.POSIX_ACL_XATTR_ENTRY_SIZE:] {
+		perm := binary.LittleEndian.Uint16(value[2:])
+		if perm&^(linux.ACL_READ|linux.ACL_WRITE|linux.ACL_EXECUTE) != 0 {
+			return nil, syserror.EINVAL
+		}
+		e := POSIXACLEntry{
+			Tag:   binary.LittleEndian.Uint16(value),
+			Perms: PermsFromMode(linux.FileMode(perm)),
+			ID:    linux.ACL_UNDEFINED_ID,
+		}
+		if e.Tag == linux.ACL_USER || e.Tag == linux.ACL_GROUP {
+			e.ID = binary.LittleEndian.Uint32(value[4:])
+		}
+		acl = append(acl, e)
+	}
+	if !acl.valid() {
+		return nil, syserror.EINVAL
+	}
+	return acl, nil
+}
+
+// valid returns whether the entries of acl are well-formed and in order.
+func (acl POSIXACL) valid() bool {
+	// state is the tag of the next entry expected, or 0 once ACL_OTHER has
+	// been seen.
+	state := uint16(linux.ACL_USER_OBJ)
+	needsMask := false
+	for _, e := range acl {
+		switch e.Tag {
+		case linux.ACL_USER_OBJ:
+			if state != linux.ACL_USER_OBJ {
+				return false
+			}
+			state = linux.ACL_USER
+		case linux.ACL_USER:
+			if state != linux.ACL_USER {
+				return false
+			}
+			needsMask = true
+		case linux.ACL_GROUP_OBJ:
+			if state != linux.ACL_USER {
+				return false
+			}
+			state = linux.ACL_GROUP
+		case linux.ACL_GROUP:
+			if state != linux.ACL_GROUP {
+				return false
+			}
+			needsMask = true
+		case linux.ACL_MASK:
+			if state != linux.ACL_GROUP {
+				return false
+			}
+			state = linux.ACL_OTHER
+		case linux.ACL_OTHER:
+			if state != linux.ACL_OTHER && (state != linux.ACL_GROUP || needsMask) {
+				return false
+			}
+			state = 0
+		default:
+			return false
+		}
+	}
+	return state == 0
+}
+
+// Encode returns the extended attribute representation of acl.
+func (acl POSIXACL) Encode() []byte {
+	buf := make([]byte, linux.POSIX_ACL_XATTR_HEADER_SIZE+len(acl)*linux.POSIX_ACL_XATTR_ENTRY_SIZE)
+	binary.LittleEndian.PutUint32(buf, linux.POSIX_ACL_XATTR_VERSION)
+	b := buf[linux.POSIX_ACL_XATTR_HEADER_SIZE:]
+	for _, e := range acl {
+		binary.LittleEndian.PutUint16(b, e.Tag)
+		binary.LittleEndian.PutUint16(b[2:], uint16(e.Perms.Mode()))
+		binary.LittleEndian.PutUint32(b[4:], e.ID)
+		b = b[linux.POSIX_ACL_XATTR_ENTRY_SIZE:]
+	}
+	return buf
+}
+
+// EquivPermissions returns perms with the user, group and other permissions
+// replaced by those granted by acl, and whether acl is fully described by the
+// result, in which case it needn't be stored. If acl has a mask entry, it
+// takes the place of the group permissions. Compare Linux's
+// fs/posix_acl.c:posix_acl_equiv_mode().
+func (acl POSIXACL) EquivPermissions(perms FilePermissions) (FilePermissions, bool) {
+	equiv := true
+	var mask *PermMask
+	for i, e := range acl {
+		switch e.Tag {
+		case linux.ACL_USER_OBJ:
+			perms.User = e.Perms
+		case linux.ACL_GROUP_OBJ:
+			perms.Group = e.Perms
+		case linux.ACL_OTHER:
+			perms.Other = e.Perms
+		case linux.ACL_MASK:
+			mask = &acl[i].Perms
+			equiv = false
+		default:
+			equiv = false
+		}
+	}
+	if mask != nil {
+		perms.Group = *mask
+	}
+	return perms, equiv
+}
+
+// CreatePermissions returns the ACL and permissions of a new file created
+// with the requested permissions perms in a directory whose default ACL is
+// acl, and whether the returned ACL is fully described by the returned
+// permissions. The default ACL takes the place of the umask. Compare Linux's
+// fs/posix_acl.c:posix_acl_create_masq().
+func (acl POSIXACL) CreatePermissions(perms FilePermissions) (POSIXACL, FilePermissions, bool) {
+	acl = append(POSIXACL(nil), acl...)
+	equiv := true
+	var groupObj, mask *POSIXACLEntry
+	for i := range acl {
+		e := &acl[i]
+		switch e.Tag {
+		case linux.ACL_USER_OBJ:
+			e.Perms = intersectPerms(e.Perms, perms.User)
+			perms.User = e.Perms
+		case linux.ACL_GROUP_OBJ:
+			groupObj = e
+		case linux.ACL_OTHER:
+			e.Perms = intersectPerms(e.Perms, perms.Other)
+			perms.Other = e.Perms
+		case linux.ACL_MASK:
+			mask = e
+			equiv = false
+		default:
+			equiv = false
+		}
+	}
+	// The mask, if there is one, limits the group class. Otherwise, the
+	// owning group's entry does.
+	if mask == nil {
+		mask = groupObj
+	}
+	mask.Perms = intersectPerms(mask.Perms, perms.Group)
+	perms.Group = mask.Perms
+	return acl, perms, equiv
+}
+
+// intersectPerms returns the permissions in both a and b.
+func intersectPerms(a, b PermMask) PermMask {
+	return PermMask{
+		Read:    a.Read && b.Read,
+		Write:   a.Write && b.Write,
+		Execute: a.Execute && b.Execute,
+	}
+}
+
+// Permits returns whether acl, the access ACL of a file with the given owner,
+// grants the requested permissions to creds. It must not be used for the
+// file's owner, whose permissions are always given by the file mode. Compare
+// Linux's fs/posix_acl.c:posix_acl_permission().
+func (acl POSIXACL) Permits(creds *auth.Credentials, owner FileOwner, req PermMask) bool {
+	// matched is the entry that applies to creds, if any. ACL_OTHER only
+	// applies if no group entry matches creds, even one that doesn't
+	// grant the requested permissions.
+	var matched *POSIXACLEntry
+	inGroup := false
+	for i := range acl {
+		e := &acl[i]
+		switch e.Tag {
+		case linux.ACL_USER:
+			// ACL_USER entries precede all group entries, so nothing
+			// else can have matched yet.
+			if matched == nil && auth.KUID(e.ID) == creds.EffectiveKUID {
+				matched = e
+			}
+		case linux.ACL_GROUP_OBJ, linux.ACL_GROUP:
+			gid := owner.GID
+			if e.Tag == linux.ACL_GROUP {
+				gid = auth.KGID(e.ID)
+			}
+			if matched == nil && creds.InGroup(gid) {
+				inGroup = true
+				if e.Perms.SupersetOf(req) {
+					matched = e
+				}
+			}
+		case linux.ACL_MASK:
+			// The mask limits the permissions granted by every matching
+			// entry other than ACL_USER_OBJ and ACL_OTHER.
+			if matched != nil {
+				return intersectPerms(matched.Perms, e.Perms).SupersetOf(req)
+			}
+		case linux.ACL_OTHER:
+			if matched != nil {
+				return matched.Perms.SupersetOf(req)
+			}
+			return !inGroup && e.Perms.SupersetOf(req)
+		}
+	}
+	return false
+}
+
+// aclCache caches the decoded access ACL of an Inode, so that permission
+// checks don't read and decode it each time.
+type aclCache struct {
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// gen is incremented each time the access ACL may have changed, so that
+	// an ACL read before the change isn't cached after it.
+	gen uint64
+
+	// acl is the access ACL, or nil if there is none. It is only valid if
+	// valid is true.
+	acl   POSIXACL
+	valid bool
+}
+
+// invalidate discards the cached ACL. It must be called after every change to
+// the access ACL.
+func (c *aclCache) invalidate() {
+	c.mu.Lock()
+	c.gen++
+	c.acl = nil
+	c.valid = false
+	c.mu.Unlock()
+}
+
+// accessACL returns the access ACL of inode, which has attributes uattr, and
+// true if there is one. Compare Linux's fs/namei.c:acl_permission_check(),
+// which only consults ACLs of files with group permissions. The returned ACL
+// is shared with other callers, and must not be modified.
+func accessACL(ctx context.Context, inode *Inode, uattr UnstableAttr) (POSIXACL, bool) {
+	if uattr.Perms.Group == (PermMask{}) || !inode.SupportsPOSIXACLs() {
+		return nil, false
+	}
+	if inode.overlay != nil {
+		// Changes to the overlay's ACLs are made through this Inode,
+		// which keeps the cache.
+		inode = overlayACLInode(inode.overlay)
+	}
+
+	c := &inode.aclCache
+	c.mu.Lock()
+	if c.valid {
+		acl := c.acl
+		c.mu.Unlock()
+		return acl, acl != nil
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	var acl POSIXACL
+	value, err := inode.GetXattrFull(ctx, linux.XATTR_NAME_POSIX_ACL_ACCESS)
+	switch err {
+	case nil:
+		// An ACL that can't be decoded grants nothing beyond the mode.
+		acl, _ = DecodePOSIXACL([]byte(value))
+	case syserror.ENODATA:
+	default:
+		// The error may be transient, so don't cache the result.
+		return nil, false
+	}
+
+	c.mu.Lock()
+	if c.gen == gen {
+		c.acl = acl
+		c.valid = true
+	}
+	c.mu.Unlock()
+	return acl, acl != nil
+}
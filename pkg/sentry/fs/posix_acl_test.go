@@ -0,0 +1,341 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"bytes"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/syserror"
+)
+
+func aclEntry(tag uint16, perms linux.FileMode, id uint32) POSIXACLEntry {
+	return POSIXACLEntry{Tag: tag, Perms: PermsFromMode(perms), ID: id}
+}
+
+// minimalACL returns an ACL with only the entries required of every ACL.
+func minimalACL(user, group, other linux.FileMode) POSIXACL {
+	return POSIXACL{
+		aclEntry(linux.ACL_USER_OBJ, user, linux.ACL_UNDEFINED_ID),
+		aclEntry(linux.ACL_GROUP_OBJ, group, linux.ACL_UNDEFINED_ID),
+		aclEntry(linux.ACL_OTHER, other, linux.ACL_UNDEFINED_ID),
+	}
+}
+
+// extendedACL returns an ACL granting the given permissions to user uid and
+// group gid, in addition to those of minimalACL, limited by mask.
+func extendedACL(user linux.FileMode, uid uint32, uidPerms, group linux.FileMode, gid uint32, gidPerms, mask, other linux.FileMode) POSIXACL {
+	return POSIXACL{
+		aclEntry(linux.ACL_USER_OBJ, user, linux.ACL_UNDEFINED_ID),
+		aclEntry(linux.ACL_USER, uidPerms, uid),
+		aclEntry(linux.ACL_GROUP_OBJ, group, linux.ACL_UNDEFINED_ID),
+		aclEntry(linux.ACL_GROUP, gidPerms, gid),
+		aclEntry(linux.ACL_MASK, mask, linux.ACL_UNDEFINED_ID),
+		aclEntry(linux.ACL_OTHER, other, linux.ACL_UNDEFINED_ID),
+	}
+}
+
+func TestPOSIXACLEncodeDecode(t *testing.T) {
+	for _, acl := range []POSIXACL{
+		minimalACL(07, 05, 0),
+		extendedACL(06, 1000, 04, 04, 2000, 06, 06, 0),
+	} {
+		got, err := DecodePOSIXACL(acl.Encode())
+		if err != nil {
+			t.Errorf("DecodePOSIXACL(%v.Encode()) failed: %v", acl, err)
+			continue
+		}
+		if !bytes.Equal(got.Encode(), acl.Encode()) {
+			t.Errorf("DecodePOSIXACL(%v.Encode()) = %v, want %v", acl, got, acl)
+		}
+	}
+
+	// An ACL with no entries is empty.
+	header := POSIXACL(nil).Encode()
+	if got, err := DecodePOSIXACL(header); got != nil || err != nil {
+		t.Errorf("DecodePOSIXACL(%v) = %v, %v, want nil, nil", header, got, err)
+	}
+}
+
+func TestPOSIXACLDecodeInvalid(t *testing.T) {
+	valid := minimalACL(07, 05, 0).Encode()
+	badVersion := append([]byte(nil), valid...)
+	badVersion[0] = 1
+	badPerm := append([]byte(nil), valid...)
+	badPerm[linux.POSIX_ACL_XATTR_HEADER_SIZE+2] = 010
+
+	for _, tc := range []struct {
+		name  string
+		value []byte
+		want  error
+	}{
+		{
+			name:  "truncated header",
+			value: valid[:linux.POSIX_ACL_XATTR_HEADER_SIZE-1],
+			want:  syserror.EINVAL,
+		},
+		{
+			name:  "truncated entry",
+			value: valid[:len(valid)-1],
+			want:  syserror.EINVAL,
+		},
+		{
+			name:  "bad version",
+			value: badVersion,
+			want:  syserror.EOPNOTSUPP,
+		},
+		{
+			name:  "bad permissions",
+			value: badPerm,
+			want:  syserror.EINVAL,
+		},
+		{
+			name:  "missing other",
+			value: minimalACL(07, 05, 0)[:2].Encode(),
+			want:  syserror.EINVAL,
+		},
+		{
+			name: "out of order",
+			value: POSIXACL{
+				aclEntry(linux.ACL_GROUP_OBJ, 05, linux.ACL_UNDEFINED_ID),
+				aclEntry(linux.ACL_USER_OBJ, 07, linux.ACL_UNDEFINED_ID),
+				aclEntry(linux.ACL_OTHER, 0, linux.ACL_UNDEFINED_ID),
+			}.Encode(),
+			want: syserror.EINVAL,
+		},
+		{
+			name: "missing mask",
+			value: POSIXACL{
+				aclEntry(linux.ACL_USER_OBJ, 07, linux.ACL_UNDEFINED_ID),
+				aclEntry(linux.ACL_USER, 07, 1000),
+				aclEntry(linux.ACL_GROUP_OBJ, 05, linux.ACL_UNDEFINED_ID),
+				aclEntry(linux.ACL_OTHER, 0, linux.ACL_UNDEFINED_ID),
+			}.Encode(),
+			want: syserror.EINVAL,
+		},
+		{
+			name: "unknown tag",
+			value: POSIXACL{
+				aclEntry(linux.ACL_USER_OBJ, 07, linux.ACL_UNDEFINED_ID),
+				aclEntry(0x40, 07, linux.ACL_UNDEFINED_ID),
+				aclEntry(linux.ACL_GROUP_OBJ, 05, linux.ACL_UNDEFINED_ID),
+				aclEntry(linux.ACL_OTHER, 0, linux.ACL_UNDEFINED_ID),
+			}.Encode(),
+			want: syserror.EINVAL,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := DecodePOSIXACL(tc.value); err != tc.want {
+				t.Errorf("DecodePOSIXACL(%v) got error %v, want %v", tc.value, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestPOSIXACLEquivPermissions(t *testing.T) {
+	perms := FilePermsFromMode(linux.ModeSetGID | 0777)
+
+	got, equiv := minimalACL(07, 05, 0).EquivPermissions(perms)
+	if want := FilePermsFromMode(linux.ModeSetGID | 0750); got != want || !equiv {
+		t.Errorf("EquivPermissions(%v) = %v, %t, want %v, true", perms, got, equiv, want)
+	}
+
+	// The mask takes the place of the group permissions.
+	got, equiv = extendedACL(06, 1000, 04, 04, 2000, 06, 06, 0).EquivPermissions(perms)
+	if want := FilePermsFromMode(linux.ModeSetGID | 0660); got != want || equiv {
+		t.Errorf("EquivPermissions(%v) = %v, %t, want %v, false", perms, got, equiv, want)
+	}
+}
+
+func TestPOSIXACLCreatePermissions(t *testing.T) {
+	perms := FilePermsFromMode(0666)
+
+	def := minimalACL(07, 05, 0)
+	acl, got, equiv := def.CreatePermissions(perms)
+	if want := FilePermsFromMode(0640); got != want || !equiv {
+		t.Errorf("CreatePermissions(%v) = %v, %t, want %v, true", perms, got, equiv, want)
+	}
+	if want := minimalACL(06, 04, 0); !bytes.Equal(acl.Encode(), want.Encode()) {
+		t.Errorf("CreatePermissions(%v) got ACL %v, want %v", perms, acl, want)
+	}
+	// The default ACL must not be modified.
+	if want := minimalACL(07, 05, 0); !bytes.Equal(def.Encode(), want.Encode()) {
+		t.Errorf("CreatePermissions modified the default ACL to %v, want %v", def, want)
+	}
+
+	// The mask, rather than the owning group's entry, is limited by the
+	// requested group permissions.
+	perms = FilePermsFromMode(0640)
+	acl, got, equiv = extendedACL(07, 1000, 07, 07, 2000, 07, 07, 05).CreatePermissions(perms)
+	if want := FilePermsFromMode(0640); got != want || equiv {
+		t.Errorf("CreatePermissions(%v) = %v, %t, want %v, false", perms, got, equiv, want)
+	}
+	if want := extendedACL(06, 1000, 07, 07, 2000, 07, 04, 0); !bytes.Equal(acl.Encode(), want.Encode()) {
+		t.Errorf("CreatePermissions(%v) got ACL %v, want %v", perms, acl, want)
+	}
+}
+
+func TestPOSIXACLPermits(t *testing.T) {
+	userns := auth.NewRootUserNamespace()
+	owner := FileOwner{UID: 0, GID: 0}
+	acl := extendedACL(07, 1000, 07, 05, 2000, 06, 05, 05)
+
+	read := PermMask{Read: true}
+	write := PermMask{Write: true}
+	for _, tc := range []struct {
+		name string
+		uid  auth.KUID
+		gids []auth.KGID
+		req  PermMask
+		want bool
+	}{
+		{
+			name: "named user limited by mask",
+			uid:  1000,
+			req:  write,
+			want: false,
+		},
+		{
+			name: "named user",
+			uid:  1000,
+			req:  read,
+			want: true,
+		},
+		{
+			name: "owning group",
+			uid:  3000,
+			gids: []auth.KGID{0},
+			req:  read,
+			want: true,
+		},
+		{
+			name: "named group limited by mask",
+			uid:  3000,
+			gids: []auth.KGID{2000},
+			req:  write,
+			want: false,
+		},
+		{
+			name: "group member doesn't get other permissions",
+			uid:  3000,
+			gids: []auth.KGID{2000},
+			req:  PermMask{Execute: true},
+			want: false,
+		},
+		{
+			name: "other",
+			uid:  3000,
+			gids: []auth.KGID{3000},
+			req:  read,
+			want: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			creds := auth.NewUserCredentials(tc.uid, auth.KGID(tc.uid), tc.gids, nil, userns)
+			if got := acl.Permits(creds, owner, tc.req); got != tc.want {
+				t.Errorf("Permits(%v) = %t, want %t", tc.req, got, tc.want)
+			}
+		})
+	}
+}
+
+// aclInodeOperations stores extended attributes, including POSIX ACLs, and
+// counts reads of the access ACL.
+type aclInodeOperations struct {
+	*MockInodeOperations
+	xattrs map[string]string
+	reads  int
+}
+
+// SupportsPOSIXACLs implements InodePOSIXACLOperations.SupportsPOSIXACLs.
+func (*aclInodeOperations) SupportsPOSIXACLs(*Inode) bool {
+	return true
+}
+
+// GetXattr implements InodeOperations.GetXattr.
+func (i *aclInodeOperations) GetXattr(_ context.Context, _ *Inode, name string, _ uint64) (string, error) {
+	if name == linux.XATTR_NAME_POSIX_ACL_ACCESS {
+		i.reads++
+	}
+	value, ok := i.xattrs[name]
+	if !ok {
+		return "", syserror.ENODATA
+	}
+	return value, nil
+}
+
+// SetXattr implements InodeOperations.SetXattr.
+func (i *aclInodeOperations) SetXattr(_ context.Context, _ *Inode, name, value string, _ uint32) error {
+	i.xattrs[name] = value
+	return nil
+}
+
+// RemoveXattr implements InodeOperations.RemoveXattr.
+func (i *aclInodeOperations) RemoveXattr(_ context.Context, _ *Inode, name string) error {
+	if _, ok := i.xattrs[name]; !ok {
+		return syserror.ENODATA
+	}
+	delete(i.xattrs, name)
+	return nil
+}
+
+func TestAccessACLCached(t *testing.T) {
+	ctx := contexttest.Context(t)
+	ops := &aclInodeOperations{
+		MockInodeOperations: NewMockInodeOperations(ctx),
+		xattrs:              make(map[string]string),
+	}
+	inode := NewInode(ctx, ops, NewMockMountSource(nil), StableAttr{Type: RegularFile})
+	defer inode.DecRef(ctx)
+	uattr := UnstableAttr{Perms: FilePermsFromMode(0750)}
+
+	// checkACL checks the result of accessACL, and that the access ACL has
+	// been read reads times in total.
+	checkACL := func(desc string, want POSIXACL, reads int) {
+		t.Helper()
+		for i := 0; i < 3; i++ {
+			got, ok := accessACL(ctx, inode, uattr)
+			if ok != (want != nil) || !bytes.Equal(got.Encode(), want.Encode()) {
+				t.Errorf("%s: accessACL got (%v, %t), want (%v, %t)", desc, got, ok, want, want != nil)
+			}
+		}
+		if ops.reads != reads {
+			t.Errorf("%s: access ACL read %d times, want %d", desc, ops.reads, reads)
+		}
+	}
+
+	checkACL("no ACL", nil, 1)
+
+	acl := extendedACL(07, 1000, 07, 05, 2000, 06, 07, 0)
+	if err := inode.SetXattr(ctx, nil, linux.XATTR_NAME_POSIX_ACL_ACCESS, string(acl.Encode()), 0 /* flags */); err != nil {
+		t.Fatalf("SetXattr failed: %v", err)
+	}
+	checkACL("after set", acl, 2)
+
+	// Other attributes don't affect the cache.
+	if err := inode.SetXattr(ctx, nil, linux.XATTR_NAME_POSIX_ACL_DEFAULT, string(acl.Encode()), 0 /* flags */); err != nil {
+		t.Fatalf("SetXattr failed: %v", err)
+	}
+	checkACL("after setting default ACL", acl, 2)
+
+	if err := inode.RemoveXattr(ctx, nil, linux.XATTR_NAME_POSIX_ACL_ACCESS); err != nil {
+		t.Fatalf("RemoveXattr failed: %v", err)
+	}
+	checkACL("after remove", nil, 3)
+}
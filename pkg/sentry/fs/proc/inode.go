@@ -24,6 +24,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/syserror"
 )
 
 // LINT.IfChange
@@ -85,6 +86,41 @@ func (i *taskOwnedInodeOps) UnstableAttr(ctx context.Context, inode *fs.Inode) (
 	return uattr, nil
 }
 
+// noXattrInodeOps wraps an fs.InodeOperations and overrides its extended
+// attribute methods. As in Linux, procfs files don't support extended
+// attributes, even if the wrapped InodeOperations (e.g. ramfs.Dir) would
+// otherwise store them.
+//
+// +stateify savable
+type noXattrInodeOps struct {
+	fs.InodeOperations
+}
+
+// GetXattr implements fs.InodeOperations.GetXattr.
+func (*noXattrInodeOps) GetXattr(context.Context, *fs.Inode, string, uint64) (string, error) {
+	return "", syserror.EOPNOTSUPP
+}
+
+// SetXattr implements fs.InodeOperations.SetXattr.
+func (*noXattrInodeOps) SetXattr(context.Context, *fs.Inode, string, string, uint32) error {
+	return syserror.EOPNOTSUPP
+}
+
+// ListXattr implements fs.InodeOperations.ListXattr.
+func (*noXattrInodeOps) ListXattr(context.Context, *fs.Inode, uint64) (map[string]struct{}, error) {
+	return nil, syserror.EOPNOTSUPP
+}
+
+// RemoveXattr implements fs.InodeOperations.RemoveXattr.
+func (*noXattrInodeOps) RemoveXattr(context.Context, *fs.Inode, string) error {
+	return syserror.EOPNOTSUPP
+}
+
+// SupportsXattrs implements fs.InodeXattrSupportOperations.SupportsXattrs.
+func (*noXattrInodeOps) SupportsXattrs(*fs.Inode) bool {
+	return false
+}
+
 // staticFileInodeOps is an InodeOperations implementation that can be used to
 // return file contents which are constant. This file is not writable and will
 // always have mode 0444.
@@ -131,7 +167,7 @@ func newProcInode(ctx context.Context, iops fs.InodeOperations, msrc *fs.MountSo
 	if t != nil {
 		iops = &taskOwnedInodeOps{iops, t}
 	}
-	return fs.NewInode(ctx, iops, msrc, sattr)
+	return fs.NewInode(ctx, &noXattrInodeOps{iops}, msrc, sattr)
 }
 
 // LINT.ThenChange(../../fsimpl/proc/tasks.go)
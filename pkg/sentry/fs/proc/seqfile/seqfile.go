@@ -92,18 +92,18 @@ func (s *SeqGenerationCounter) IsCurrent(generation int64) bool {
 //
 // +stateify savable
 type SeqFile struct {
-	fsutil.InodeGenericChecker `state:"nosave"`
-	fsutil.InodeNoopRelease    `state:"nosave"`
-	fsutil.InodeNoopWriteOut   `state:"nosave"`
-	fsutil.InodeNotAllocatable `state:"nosave"`
-	fsutil.InodeNotDirectory   `state:"nosave"`
-	fsutil.InodeNotMappable    `state:"nosave"`
-	fsutil.InodeNotSocket      `state:"nosave"`
-	fsutil.InodeNotSymlink     `state:"nosave"`
-	fsutil.InodeNotTruncatable `state:"nosave"`
-	fsutil.InodeVirtual        `state:"nosave"`
-
-	fsutil.InodeSimpleExtendedAttributes
+	fsutil.InodeGenericChecker       `state:"nosave"`
+	fsutil.InodeNoExtendedAttributes `state:"nosave"`
+	fsutil.InodeNoopRelease          `state:"nosave"`
+	fsutil.InodeNoopWriteOut         `state:"nosave"`
+	fsutil.InodeNotAllocatable       `state:"nosave"`
+	fsutil.InodeNotDirectory         `state:"nosave"`
+	fsutil.InodeNotMappable          `state:"nosave"`
+	fsutil.InodeNotSocket            `state:"nosave"`
+	fsutil.InodeNotSymlink           `state:"nosave"`
+	fsutil.InodeNotTruncatable       `state:"nosave"`
+	fsutil.InodeVirtual              `state:"nosave"`
+
 	fsutil.InodeSimpleAttributes
 
 	// mu protects the fields below.
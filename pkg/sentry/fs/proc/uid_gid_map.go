@@ -38,19 +38,19 @@ import (
 //
 // +stateify savable
 type idMapInodeOperations struct {
-	fsutil.InodeGenericChecker `state:"nosave"`
-	fsutil.InodeNoopRelease    `state:"nosave"`
-	fsutil.InodeNoopWriteOut   `state:"nosave"`
-	fsutil.InodeNotAllocatable `state:"nosave"`
-	fsutil.InodeNotDirectory   `state:"nosave"`
-	fsutil.InodeNotMappable    `state:"nosave"`
-	fsutil.InodeNotSocket      `state:"nosave"`
-	fsutil.InodeNotSymlink     `state:"nosave"`
-	fsutil.InodeNotTruncatable `state:"nosave"`
-	fsutil.InodeVirtual        `state:"nosave"`
+	fsutil.InodeGenericChecker       `state:"nosave"`
+	fsutil.InodeNoExtendedAttributes `state:"nosave"`
+	fsutil.InodeNoopRelease          `state:"nosave"`
+	fsutil.InodeNoopWriteOut         `state:"nosave"`
+	fsutil.InodeNotAllocatable       `state:"nosave"`
+	fsutil.InodeNotDirectory         `state:"nosave"`
+	fsutil.InodeNotMappable          `state:"nosave"`
+	fsutil.InodeNotSocket            `state:"nosave"`
+	fsutil.InodeNotSymlink           `state:"nosave"`
+	fsutil.InodeNotTruncatable       `state:"nosave"`
+	fsutil.InodeVirtual              `state:"nosave"`
 
 	fsutil.InodeSimpleAttributes
-	fsutil.InodeSimpleExtendedAttributes
 
 	t    *kernel.Task
 	gids bool
@@ -16,13 +16,19 @@ package tmpfs
 
 import (
 	"bytes"
+	"fmt"
+	"strconv"
 	"testing"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/sentry/fs/xattrtest"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/contexttest"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserror"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
@@ -71,3 +77,383 @@ func TestGrow(t *testing.T) {
 		t.Fatalf("Read %v, want %v", rbuf, want)
 	}
 }
+
+func TestSetXattrFlags(t *testing.T) {
+	ctx := contexttest.Context(t)
+	inode := newFileInode(ctx)
+	defer inode.DecRef(ctx)
+
+	const name = "user.test"
+	for _, tc := range []struct {
+		desc  string
+		value string
+		flags uint32
+		err   error
+		want  string
+	}{
+		{
+			desc:  "replace missing",
+			value: "a",
+			flags: linux.XATTR_REPLACE,
+			err:   syserror.ENODATA,
+		},
+		{
+			desc:  "create missing",
+			value: "b",
+			flags: linux.XATTR_CREATE,
+			want:  "b",
+		},
+		{
+			desc:  "create existing",
+			value: "c",
+			flags: linux.XATTR_CREATE,
+			err:   syserror.EEXIST,
+			want:  "b",
+		},
+		{
+			desc:  "replace existing",
+			value: "d",
+			flags: linux.XATTR_REPLACE,
+			want:  "d",
+		},
+		{
+			desc:  "overwrite existing",
+			value: "e",
+			want:  "e",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if err := inode.InodeOperations.SetXattr(ctx, inode, name, tc.value, tc.flags); err != tc.err {
+				t.Fatalf("SetXattr(%q, %q, %#x) got error %v want %v", name, tc.value, tc.flags, err, tc.err)
+			}
+			if tc.want == "" {
+				return
+			}
+			got, err := inode.GetXattr(ctx, name, linux.XATTR_SIZE_MAX)
+			if err != nil {
+				t.Fatalf("GetXattr(%q) failed: %v", name, err)
+			}
+			if got != tc.want {
+				t.Errorf("GetXattr(%q) got %q want %q", name, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSetXattrQuota(t *testing.T) {
+	ctx := contexttest.Context(t)
+	root, err := (&Filesystem{}).Mount(ctx, "", fs.MountSourceFlags{}, "xattr_quota=64", nil)
+	if err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+	defer root.DecRef(ctx)
+
+	// Each attribute uses 16 bytes of quota: a 10 byte name and a 6 byte
+	// value.
+	value := "abcdef"
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("user.test%d", i)
+		if err := root.SetXattr(ctx, nil, name, value, 0 /* flags */); err != nil {
+			t.Fatalf("SetXattr(%q) failed: %v", name, err)
+		}
+	}
+	if err := root.SetXattr(ctx, nil, "user.test4", value, 0 /* flags */); err != syserror.EDQUOT {
+		t.Errorf("SetXattr over quota got error %v, want %v", err, syserror.EDQUOT)
+	}
+
+	// Replacing an attribute only counts the new value.
+	if err := root.SetXattr(ctx, nil, "user.test0", "ghijkl", linux.XATTR_REPLACE); err != nil {
+		t.Errorf("SetXattr replacing within quota failed: %v", err)
+	}
+	if err := root.SetXattr(ctx, nil, "user.test0", "ghijklm", linux.XATTR_REPLACE); err != syserror.EDQUOT {
+		t.Errorf("SetXattr replacing over quota got error %v, want %v", err, syserror.EDQUOT)
+	}
+
+	// Removing an attribute frees its quota.
+	if err := root.RemoveXattr(ctx, nil, "user.test1"); err != nil {
+		t.Fatalf("RemoveXattr failed: %v", err)
+	}
+	if err := root.SetXattr(ctx, nil, "user.test4", value, 0 /* flags */); err != nil {
+		t.Errorf("SetXattr after RemoveXattr failed: %v", err)
+	}
+}
+
+func TestSetAllXattrsQuota(t *testing.T) {
+	ctx := contexttest.Context(t)
+	root, err := (&Filesystem{}).Mount(ctx, "", fs.MountSourceFlags{}, "xattr_quota=64", nil)
+	if err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+	defer root.DecRef(ctx)
+
+	if err := root.SetXattr(ctx, nil, "user.test0", "abcdef", 0 /* flags */); err != nil {
+		t.Fatalf("SetXattr failed: %v", err)
+	}
+
+	// Each attribute uses 16 bytes of quota, so only three more fit.
+	over := map[string]string{
+		"user.test1": "abcdef",
+		"user.test2": "abcdef",
+		"user.test3": "abcdef",
+		"user.test4": "abcdef",
+	}
+	if err := root.SetAllXattrs(ctx, nil, over); err != syserror.EDQUOT {
+		t.Errorf("SetAllXattrs over quota got error %v, want %v", err, syserror.EDQUOT)
+	}
+	// Nothing is set if the attributes don't fit.
+	if _, err := root.GetXattr(ctx, "user.test1", 0 /* size */); err != syserror.ENODATA {
+		t.Errorf("GetXattr after failed SetAllXattrs got error %v, want %v", err, syserror.ENODATA)
+	}
+
+	// Replaced attributes only count their new value.
+	within := map[string]string{
+		"user.test0": "ghijkl",
+		"user.test1": "abcdef",
+		"user.test2": "abcdef",
+		"user.test3": "abcdef",
+	}
+	if err := root.SetAllXattrs(ctx, nil, within); err != nil {
+		t.Errorf("SetAllXattrs within quota failed: %v", err)
+	}
+}
+
+func TestSetXattrCount(t *testing.T) {
+	ctx := contexttest.Context(t)
+	root, err := (&Filesystem{}).Mount(ctx, "", fs.MountSourceFlags{}, "xattr_count=3", nil)
+	if err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+	defer root.DecRef(ctx)
+
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("user.test%d", i)
+		if err := root.SetXattr(ctx, nil, name, "", 0 /* flags */); err != nil {
+			t.Fatalf("SetXattr(%q) failed: %v", name, err)
+		}
+	}
+	if err := root.SetXattr(ctx, nil, "user.test3", "", 0 /* flags */); err != syserror.ENOSPC {
+		t.Errorf("SetXattr over count limit got error %v, want %v", err, syserror.ENOSPC)
+	}
+
+	// Replacing an attribute doesn't add to the count.
+	if err := root.SetXattr(ctx, nil, "user.test0", "value", linux.XATTR_REPLACE); err != nil {
+		t.Errorf("SetXattr replacing at count limit failed: %v", err)
+	}
+
+	// Removing an attribute makes room for another.
+	if err := root.RemoveXattr(ctx, nil, "user.test1"); err != nil {
+		t.Fatalf("RemoveXattr failed: %v", err)
+	}
+	if err := root.SetXattr(ctx, nil, "user.test3", "", 0 /* flags */); err != nil {
+		t.Errorf("SetXattr after RemoveXattr failed: %v", err)
+	}
+}
+
+func TestSetAllXattrsCount(t *testing.T) {
+	ctx := contexttest.Context(t)
+	root, err := (&Filesystem{}).Mount(ctx, "", fs.MountSourceFlags{}, "xattr_count=3", nil)
+	if err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+	defer root.DecRef(ctx)
+
+	if err := root.SetXattr(ctx, nil, "user.test0", "", 0 /* flags */); err != nil {
+		t.Fatalf("SetXattr failed: %v", err)
+	}
+
+	over := map[string]string{
+		"user.test1": "",
+		"user.test2": "",
+		"user.test3": "",
+	}
+	if err := root.SetAllXattrs(ctx, nil, over); err != syserror.ENOSPC {
+		t.Errorf("SetAllXattrs over count limit got error %v, want %v", err, syserror.ENOSPC)
+	}
+	// Nothing is set if the attributes don't fit.
+	if _, err := root.GetXattr(ctx, "user.test1", 0 /* size */); err != syserror.ENODATA {
+		t.Errorf("GetXattr after failed SetAllXattrs got error %v, want %v", err, syserror.ENODATA)
+	}
+
+	// Replaced attributes don't add to the count.
+	within := map[string]string{
+		"user.test0": "value",
+		"user.test1": "",
+		"user.test2": "",
+	}
+	if err := root.SetAllXattrs(ctx, nil, within); err != nil {
+		t.Errorf("SetAllXattrs at count limit failed: %v", err)
+	}
+}
+
+func TestStatFSXattrUsage(t *testing.T) {
+	ctx := contexttest.Context(t)
+	root, err := (&Filesystem{}).Mount(ctx, "", fs.MountSourceFlags{}, "", nil)
+	if err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+	defer root.DecRef(ctx)
+
+	before, err := root.StatFS(ctx)
+	if err != nil {
+		t.Fatalf("StatFS failed: %v", err)
+	}
+
+	const name = "user.test"
+	value := string(make([]byte, linux.XATTR_SIZE_MAX))
+	if err := root.SetXattr(ctx, nil, name, value, 0 /* flags */); err != nil {
+		t.Fatalf("SetXattr failed: %v", err)
+	}
+	if got, want := root.XattrUsage(), uint64(len(name)+len(value)); got != want {
+		t.Errorf("XattrUsage got %d, want %d", got, want)
+	}
+	after, err := root.StatFS(ctx)
+	if err != nil {
+		t.Fatalf("StatFS failed: %v", err)
+	}
+	usedBlocks := uint64(len(name)+len(value)+hostarch.PageSize-1) / hostarch.PageSize
+	if got, want := before.FreeBlocks-after.FreeBlocks, usedBlocks; got != want {
+		t.Errorf("StatFS used %d more blocks after SetXattr, want %d", got, want)
+	}
+
+	if err := root.RemoveXattr(ctx, nil, name); err != nil {
+		t.Fatalf("RemoveXattr failed: %v", err)
+	}
+	after, err = root.StatFS(ctx)
+	if err != nil {
+		t.Fatalf("StatFS failed: %v", err)
+	}
+	if after.FreeBlocks != before.FreeBlocks {
+		t.Errorf("StatFS got %d free blocks after RemoveXattr, want %d", after.FreeBlocks, before.FreeBlocks)
+	}
+}
+
+func TestGetAndSetXattrConcurrent(t *testing.T) {
+	ctx := contexttest.Context(t)
+	inode := newFileInode(ctx)
+	defer inode.DecRef(ctx)
+
+	// Each goroutine increments a counter stored in the attribute, retrying
+	// whenever another goroutine changed it since it was read. Without an
+	// atomic read-modify-write, increments would be lost.
+	const (
+		name       = "user.counter"
+		goroutines = 8
+		increments = 200
+	)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; {
+				old, err := inode.GetXattr(ctx, name, linux.XATTR_SIZE_MAX)
+				if err != nil && err != syserror.ENODATA {
+					t.Errorf("GetXattr failed: %v", err)
+					return
+				}
+				existed := err == nil
+				n, _ := strconv.Atoi(old)
+				unchanged := func(cur string, exists bool) bool {
+					return cur == old && exists == existed
+				}
+				if _, ok, err := inode.GetAndSetXattr(ctx, nil, name, strconv.Itoa(n+1), unchanged); err != nil {
+					t.Errorf("GetAndSetXattr failed: %v", err)
+					return
+				} else if ok {
+					i++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := inode.GetXattr(ctx, name, linux.XATTR_SIZE_MAX)
+	if err != nil {
+		t.Fatalf("GetXattr failed: %v", err)
+	}
+	if want := strconv.Itoa(goroutines * increments); got != want {
+		t.Errorf("GetXattr got %s, want %s", got, want)
+	}
+}
+
+func TestRenameXattrConcurrent(t *testing.T) {
+	ctx := contexttest.Context(t)
+	inode := newFileInode(ctx)
+	defer inode.DecRef(ctx)
+
+	const (
+		oldName = "user.old"
+		newName = "user.new"
+		renames = 1000
+	)
+	if err := inode.SetXattr(ctx, nil, oldName, "value", 0 /* flags */); err != nil {
+		t.Fatalf("SetXattr failed: %v", err)
+	}
+
+	// Readers must always find the value under exactly one of the two names.
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				names, err := inode.ListXattr(ctx, linux.XATTR_LIST_MAX)
+				if err != nil {
+					t.Errorf("ListXattr failed: %v", err)
+					return
+				}
+				_, hasOld := names[oldName]
+				_, hasNew := names[newName]
+				if hasOld == hasNew {
+					t.Errorf("ListXattr got %v, want exactly one of %q and %q", names, oldName, newName)
+					return
+				}
+			}
+		}()
+	}
+
+	from, to := oldName, newName
+	for i := 0; i < renames; i++ {
+		if err := inode.RenameXattr(ctx, nil, from, to); err != nil {
+			t.Errorf("RenameXattr(%q, %q) failed: %v", from, to, err)
+			break
+		}
+		from, to = to, from
+	}
+	close(done)
+	wg.Wait()
+
+	if err := inode.RenameXattr(ctx, nil, "user.missing", newName); err != syserror.ENODATA {
+		t.Errorf("RenameXattr of missing name got error %v, want %v", err, syserror.ENODATA)
+	}
+}
+
+func TestXattrConformance(t *testing.T) {
+	ctx := contexttest.Context(t)
+	t.Run("File", func(t *testing.T) {
+		xattrtest.Run(t, ctx, func(*testing.T) *fs.Inode {
+			return newFileInode(ctx)
+		})
+	})
+	t.Run("Dir", func(t *testing.T) {
+		xattrtest.Run(t, ctx, func(t *testing.T) *fs.Inode {
+			root, err := (&Filesystem{}).Mount(ctx, "", fs.MountSourceFlags{}, "", nil)
+			if err != nil {
+				t.Fatalf("Mount failed: %v", err)
+			}
+			return root
+		})
+	})
+	t.Run("Symlink", func(t *testing.T) {
+		xattrtest.Run(t, ctx, func(*testing.T) *fs.Inode {
+			msrc := fs.NewCachingMountSource(ctx, &Filesystem{}, fs.MountSourceFlags{})
+			return NewSymlink(ctx, "target", fs.FileOwner{}, msrc)
+		})
+	})
+}
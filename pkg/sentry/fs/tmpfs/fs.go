@@ -21,6 +21,7 @@ import (
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/sentry/fs/fsutil"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 )
 
@@ -44,6 +45,27 @@ const (
 	// lookup.
 	cacheRevalidate = "revalidate"
 
+	// xattrQuotaKey sets the maximum total size, in bytes, of the names and
+	// values of each inode's extended attributes. 0 means no limit.
+	xattrQuotaKey = "xattr_quota"
+
+	// defaultXattrQuota is the default per-inode extended attribute quota.
+	// Linux doesn't limit extended attributes on tmpfs inodes beyond the
+	// size of a single value (XATTR_SIZE_MAX), but since they are stored in
+	// sentry memory, bound them to a handful of maximum-sized values.
+	defaultXattrQuota = 16 * linux.XATTR_SIZE_MAX
+
+	// xattrCountKey sets the maximum number of extended attributes of each
+	// inode. 0 means no limit.
+	xattrCountKey = "xattr_count"
+
+	// defaultXattrCount is the default per-inode extended attribute count
+	// limit. Linux doesn't limit the number of extended attributes on tmpfs
+	// inodes, but listxattr(2) can't return more names than fit in
+	// XATTR_LIST_MAX bytes, so allow as many of the shortest user.* names as
+	// fit in one list.
+	defaultXattrCount = linux.XATTR_LIST_MAX / len("user.x\x00")
+
 	// Permissions that exceed modeMask will be rejected.
 	modeMask = 01777
 
@@ -129,6 +151,26 @@ func (f *Filesystem) Mount(ctx context.Context, device string, flags fs.MountSou
 		delete(options, rootGIDKey)
 	}
 
+	xattrQuota := defaultXattrQuota
+	if quotastr, ok := options[xattrQuotaKey]; ok {
+		quota, err := strconv.ParseUint(quotastr, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("xattr_quota value not parsable 'xattr_quota=%s': %v", quotastr, err)
+		}
+		xattrQuota = int(quota)
+		delete(options, xattrQuotaKey)
+	}
+
+	xattrCount := defaultXattrCount
+	if countstr, ok := options[xattrCountKey]; ok {
+		count, err := strconv.ParseUint(countstr, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("xattr_count value not parsable 'xattr_count=%s': %v", countstr, err)
+		}
+		xattrCount = int(count)
+		delete(options, xattrCountKey)
+	}
+
 	// Construct a mount which will follow the cache options provided.
 	//
 	// TODO(gvisor.dev/issue/179): There should be no reason to disable
@@ -150,6 +192,52 @@ func (f *Filesystem) Mount(ctx context.Context, device string, flags fs.MountSou
 		return nil, fmt.Errorf("unsupported mount options: %v", options)
 	}
 
+	msrc.MountSourceOperations = &mountSourceOperations{
+		MountSourceOperations: msrc.MountSourceOperations,
+		xattrQuota: fsutil.XattrQuota{
+			Size:  xattrQuota,
+			Count: xattrCount,
+		},
+		xattrUsage: &fsutil.XattrUsage{},
+	}
+
 	// Construct the tmpfs root.
 	return NewDir(ctx, nil, owner, perms, msrc, nil /* parent */)
 }
+
+// mountSourceOperations wraps the MountSourceOperations of a tmpfs mount to
+// carry its mount options.
+//
+// +stateify savable
+type mountSourceOperations struct {
+	fs.MountSourceOperations
+
+	// xattrQuota limits each inode's extended attributes. See xattrQuotaKey
+	// and xattrCountKey.
+	xattrQuota fsutil.XattrQuota
+
+	// xattrUsage counts the bytes used by the extended attributes of all
+	// inodes in the filesystem. It is reported by statfs(2).
+	xattrUsage *fsutil.XattrUsage
+}
+
+// xattrUsage returns the extended attribute usage counter of msrc, or nil if
+// msrc wasn't created by Filesystem.Mount.
+func xattrUsage(msrc *fs.MountSource) *fsutil.XattrUsage {
+	if mops, ok := msrc.MountSourceOperations.(*mountSourceOperations); ok {
+		return mops.xattrUsage
+	}
+	return nil
+}
+
+// xattrQuota returns the per-inode extended attribute quota of msrc. Inodes
+// that weren't created by Filesystem.Mount, e.g. memfds, get the default.
+func xattrQuota(msrc *fs.MountSource) fsutil.XattrQuota {
+	if mops, ok := msrc.MountSourceOperations.(*mountSourceOperations); ok {
+		return mops.xattrQuota
+	}
+	return fsutil.XattrQuota{
+		Size:  defaultXattrQuota,
+		Count: defaultXattrCount,
+	}
+}
@@ -132,6 +132,8 @@ func NewMemfdInode(ctx context.Context, allowSeals bool) *fs.Inode {
 
 // Release implements fs.InodeOperations.Release.
 func (f *fileInodeOperations) Release(context.Context) {
+	f.ReleaseXattrUsage()
+
 	f.dataMu.Lock()
 	defer f.dataMu.Unlock()
 	f.data.DropAll(f.kernel.MemoryFile())
@@ -179,6 +181,31 @@ func (f *fileInodeOperations) Check(ctx context.Context, inode *fs.Inode, p fs.P
 	return fs.ContextCanAccessFile(ctx, inode, p)
 }
 
+// SetXattr implements fs.InodeOperations.SetXattr.
+func (f *fileInodeOperations) SetXattr(_ context.Context, inode *fs.Inode, name, value string, flags uint32) error {
+	return f.SetXattrWithQuota(name, value, flags, xattrQuota(inode.MountSource))
+}
+
+// GetAndSetXattr implements fs.InodeXattrGetAndSetOperations.GetAndSetXattr.
+func (f *fileInodeOperations) GetAndSetXattr(_ context.Context, inode *fs.Inode, name, value string, cond func(old string, exists bool) bool) (string, bool, error) {
+	return f.GetAndSetXattrWithQuota(name, value, cond, xattrQuota(inode.MountSource))
+}
+
+// RenameXattr implements fs.InodeXattrRenameOperations.RenameXattr.
+func (f *fileInodeOperations) RenameXattr(_ context.Context, inode *fs.Inode, oldName, newName string) error {
+	return f.RenameXattrWithQuota(oldName, newName, xattrQuota(inode.MountSource))
+}
+
+// SetAllXattrs implements fs.InodeBulkXattrOperations.SetAllXattrs.
+func (f *fileInodeOperations) SetAllXattrs(_ context.Context, inode *fs.Inode, xattrs map[string]string) error {
+	return f.SetAllXattrsWithQuota(xattrs, xattrQuota(inode.MountSource))
+}
+
+// SupportsPOSIXACLs implements fs.InodePOSIXACLOperations.SupportsPOSIXACLs.
+func (*fileInodeOperations) SupportsPOSIXACLs(*fs.Inode) bool {
+	return true
+}
+
 // SetPermissions implements fs.InodeOperations.SetPermissions.
 func (f *fileInodeOperations) SetPermissions(ctx context.Context, _ *fs.Inode, p fs.FilePermissions) bool {
 	f.attrMu.Lock()
@@ -317,8 +344,8 @@ func (*fileInodeOperations) IsVirtual() bool {
 }
 
 // StatFS implements fs.InodeOperations.StatFS.
-func (*fileInodeOperations) StatFS(context.Context) (fs.Info, error) {
-	return fsInfo, nil
+func (f *fileInodeOperations) StatFS(context.Context) (fs.Info, error) {
+	return statFS(f.XattrUsageCounter()), nil
 }
 
 func (f *fileInodeOperations) read(ctx context.Context, file *fs.File, dst usermem.IOSequence, offset int64) (int64, error) {
@@ -45,6 +45,17 @@ var fsInfo = fs.Info{
 	FreeBlocks:  math.MaxInt64 / hostarch.PageSize,
 }
 
+// statFS returns the tmpfs info for a filesystem whose extended attributes are
+// counted by u, which may be nil. Extended attributes are stored in memory, so
+// they count as used blocks.
+func statFS(u *fsutil.XattrUsage) fs.Info {
+	info := fsInfo
+	if u != nil {
+		info.FreeBlocks -= (u.Bytes() + hostarch.PageSize - 1) / hostarch.PageSize
+	}
+	return info
+}
+
 // rename implements fs.InodeOperations.Rename for tmpfs nodes.
 func rename(ctx context.Context, oldParent *fs.Inode, oldName string, newParent *fs.Inode, newName string, replacement bool) error {
 	// Don't allow renames across different mounts.
@@ -105,6 +116,7 @@ func NewDir(ctx context.Context, contents map[string]*fs.Inode, owner fs.FileOwn
 		ramfsDir: ramfs.NewDir(ctx, contents, owner, perms),
 		kernel:   kernel.KernelFromContext(ctx),
 	}
+	d.ramfsDir.SetXattrUsage(xattrUsage(msrc))
 
 	// Manually set the CreateOps.
 	d.ramfsDir.CreateOps = d.newCreateOps()
@@ -175,7 +187,27 @@ func (d *Dir) GetXattr(ctx context.Context, i *fs.Inode, name string, size uint6
 
 // SetXattr implements fs.InodeOperations.SetXattr.
 func (d *Dir) SetXattr(ctx context.Context, i *fs.Inode, name, value string, flags uint32) error {
-	return d.ramfsDir.SetXattr(ctx, i, name, value, flags)
+	return d.ramfsDir.SetXattrWithQuota(name, value, flags, xattrQuota(i.MountSource))
+}
+
+// GetAndSetXattr implements fs.InodeXattrGetAndSetOperations.GetAndSetXattr.
+func (d *Dir) GetAndSetXattr(ctx context.Context, i *fs.Inode, name, value string, cond func(old string, exists bool) bool) (string, bool, error) {
+	return d.ramfsDir.GetAndSetXattrWithQuota(name, value, cond, xattrQuota(i.MountSource))
+}
+
+// RenameXattr implements fs.InodeXattrRenameOperations.RenameXattr.
+func (d *Dir) RenameXattr(ctx context.Context, i *fs.Inode, oldName, newName string) error {
+	return d.ramfsDir.RenameXattrWithQuota(oldName, newName, xattrQuota(i.MountSource))
+}
+
+// SetAllXattrs implements fs.InodeBulkXattrOperations.SetAllXattrs.
+func (d *Dir) SetAllXattrs(ctx context.Context, i *fs.Inode, xattrs map[string]string) error {
+	return d.ramfsDir.SetAllXattrsWithQuota(xattrs, xattrQuota(i.MountSource))
+}
+
+// ClearXattrs implements fs.InodeXattrClearOperations.ClearXattrs.
+func (d *Dir) ClearXattrs(ctx context.Context, i *fs.Inode) error {
+	return d.ramfsDir.ClearXattrs(ctx, i)
 }
 
 // ListXattr implements fs.InodeOperations.ListXattr.
@@ -183,11 +215,26 @@ func (d *Dir) ListXattr(ctx context.Context, i *fs.Inode, size uint64) (map[stri
 	return d.ramfsDir.ListXattr(ctx, i, size)
 }
 
+// WalkXattrs implements fs.InodeXattrWalkOperations.WalkXattrs.
+func (d *Dir) WalkXattrs(ctx context.Context, i *fs.Inode, fn func(name string)) error {
+	return d.ramfsDir.WalkXattrs(ctx, i, fn)
+}
+
 // RemoveXattr implements fs.InodeOperations.RemoveXattr.
 func (d *Dir) RemoveXattr(ctx context.Context, i *fs.Inode, name string) error {
 	return d.ramfsDir.RemoveXattr(ctx, i, name)
 }
 
+// SupportsPOSIXACLs implements fs.InodePOSIXACLOperations.SupportsPOSIXACLs.
+func (*Dir) SupportsPOSIXACLs(*fs.Inode) bool {
+	return true
+}
+
+// XattrUsage implements fs.InodeXattrUsageOperations.XattrUsage.
+func (d *Dir) XattrUsage(i *fs.Inode) uint64 {
+	return d.ramfsDir.XattrUsage(i)
+}
+
 // Lookup implements fs.InodeOperations.Lookup.
 func (d *Dir) Lookup(ctx context.Context, i *fs.Inode, p string) (*fs.Dirent, error) {
 	return d.ramfsDir.Lookup(ctx, i, p)
@@ -252,6 +299,7 @@ func (d *Dir) newCreateOps() *ramfs.CreateOps {
 				Links: 0,
 			})
 			iops := NewInMemoryFile(ctx, usage.Tmpfs, uattr)
+			iops.(*fileInodeOperations).SetXattrUsage(xattrUsage(dir.MountSource))
 			return fs.NewInode(ctx, iops, dir.MountSource, fs.StableAttr{
 				DeviceID:  tmpfsDevice.DeviceID(),
 				InodeID:   tmpfsDevice.NextIno(),
@@ -277,8 +325,8 @@ func (d *Dir) Rename(ctx context.Context, inode *fs.Inode, oldParent *fs.Inode,
 }
 
 // StatFS implements fs.InodeOperations.StatFS.
-func (*Dir) StatFS(context.Context) (fs.Info, error) {
-	return fsInfo, nil
+func (d *Dir) StatFS(context.Context) (fs.Info, error) {
+	return statFS(d.ramfsDir.XattrUsageCounter()), nil
 }
 
 // Allocate implements fs.InodeOperations.Allocate.
@@ -288,6 +336,7 @@ func (d *Dir) Allocate(ctx context.Context, node *fs.Inode, offset, length int64
 
 // Release implements fs.InodeOperations.Release.
 func (d *Dir) Release(ctx context.Context) {
+	d.ramfsDir.ReleaseXattrUsage()
 	d.ramfsDir.Release(ctx)
 }
 
@@ -301,6 +350,7 @@ type Symlink struct {
 // NewSymlink returns a new symlink with the provided permissions.
 func NewSymlink(ctx context.Context, target string, owner fs.FileOwner, msrc *fs.MountSource) *fs.Inode {
 	s := &Symlink{Symlink: *ramfs.NewSymlink(ctx, owner, target)}
+	s.SetXattrUsage(xattrUsage(msrc))
 	return fs.NewInode(ctx, s, msrc, fs.StableAttr{
 		DeviceID:  tmpfsDevice.DeviceID(),
 		InodeID:   tmpfsDevice.NextIno(),
@@ -314,9 +364,35 @@ func (s *Symlink) Rename(ctx context.Context, inode *fs.Inode, oldParent *fs.Ino
 	return rename(ctx, oldParent, oldName, newParent, newName, replacement)
 }
 
+// SetXattr implements fs.InodeOperations.SetXattr.
+func (s *Symlink) SetXattr(_ context.Context, i *fs.Inode, name, value string, flags uint32) error {
+	return s.SetXattrWithQuota(name, value, flags, xattrQuota(i.MountSource))
+}
+
+// GetAndSetXattr implements fs.InodeXattrGetAndSetOperations.GetAndSetXattr.
+func (s *Symlink) GetAndSetXattr(_ context.Context, i *fs.Inode, name, value string, cond func(old string, exists bool) bool) (string, bool, error) {
+	return s.GetAndSetXattrWithQuota(name, value, cond, xattrQuota(i.MountSource))
+}
+
+// RenameXattr implements fs.InodeXattrRenameOperations.RenameXattr.
+func (s *Symlink) RenameXattr(_ context.Context, i *fs.Inode, oldName, newName string) error {
+	return s.RenameXattrWithQuota(oldName, newName, xattrQuota(i.MountSource))
+}
+
+// SetAllXattrs implements fs.InodeBulkXattrOperations.SetAllXattrs.
+func (s *Symlink) SetAllXattrs(_ context.Context, i *fs.Inode, xattrs map[string]string) error {
+	return s.SetAllXattrsWithQuota(xattrs, xattrQuota(i.MountSource))
+}
+
 // StatFS returns the tmpfs info.
 func (s *Symlink) StatFS(context.Context) (fs.Info, error) {
-	return fsInfo, nil
+	return statFS(s.XattrUsageCounter()), nil
+}
+
+// Release implements fs.InodeOperations.Release.
+func (s *Symlink) Release(ctx context.Context) {
+	s.ReleaseXattrUsage()
+	s.Symlink.Release(ctx)
 }
 
 // Socket is a socket.
@@ -331,6 +407,7 @@ type Socket struct {
 // NewSocket returns a new socket with the provided permissions.
 func NewSocket(ctx context.Context, socket transport.BoundEndpoint, owner fs.FileOwner, perms fs.FilePermissions, msrc *fs.MountSource) *fs.Inode {
 	s := &Socket{Socket: *ramfs.NewSocket(ctx, socket, owner, perms)}
+	s.SetXattrUsage(xattrUsage(msrc))
 	return fs.NewInode(ctx, s, msrc, fs.StableAttr{
 		DeviceID:  tmpfsDevice.DeviceID(),
 		InodeID:   tmpfsDevice.NextIno(),
@@ -344,9 +421,35 @@ func (s *Socket) Rename(ctx context.Context, inode *fs.Inode, oldParent *fs.Inod
 	return rename(ctx, oldParent, oldName, newParent, newName, replacement)
 }
 
+// SetXattr implements fs.InodeOperations.SetXattr.
+func (s *Socket) SetXattr(_ context.Context, i *fs.Inode, name, value string, flags uint32) error {
+	return s.SetXattrWithQuota(name, value, flags, xattrQuota(i.MountSource))
+}
+
+// GetAndSetXattr implements fs.InodeXattrGetAndSetOperations.GetAndSetXattr.
+func (s *Socket) GetAndSetXattr(_ context.Context, i *fs.Inode, name, value string, cond func(old string, exists bool) bool) (string, bool, error) {
+	return s.GetAndSetXattrWithQuota(name, value, cond, xattrQuota(i.MountSource))
+}
+
+// RenameXattr implements fs.InodeXattrRenameOperations.RenameXattr.
+func (s *Socket) RenameXattr(_ context.Context, i *fs.Inode, oldName, newName string) error {
+	return s.RenameXattrWithQuota(oldName, newName, xattrQuota(i.MountSource))
+}
+
+// SetAllXattrs implements fs.InodeBulkXattrOperations.SetAllXattrs.
+func (s *Socket) SetAllXattrs(_ context.Context, i *fs.Inode, xattrs map[string]string) error {
+	return s.SetAllXattrsWithQuota(xattrs, xattrQuota(i.MountSource))
+}
+
 // StatFS returns the tmpfs info.
 func (s *Socket) StatFS(context.Context) (fs.Info, error) {
-	return fsInfo, nil
+	return statFS(s.XattrUsageCounter()), nil
+}
+
+// Release implements fs.InodeOperations.Release.
+func (s *Socket) Release(ctx context.Context) {
+	s.ReleaseXattrUsage()
+	s.Socket.Release(ctx)
 }
 
 // Fifo is a tmpfs named pipe.
@@ -354,6 +457,10 @@ func (s *Socket) StatFS(context.Context) (fs.Info, error) {
 // +stateify savable
 type Fifo struct {
 	fs.InodeOperations
+
+	// xattrUsage is the extended attribute usage of the filesystem, reported
+	// by StatFS. Fifos themselves don't support extended attributes.
+	xattrUsage *fsutil.XattrUsage
 }
 
 // NewFifo creates a new named pipe.
@@ -365,7 +472,10 @@ func NewFifo(ctx context.Context, owner fs.FileOwner, perms fs.FilePermissions,
 	iops := pipe.NewInodeOperations(ctx, perms, p)
 
 	// Wrap the iops with our Fifo.
-	fifoIops := &Fifo{iops}
+	fifoIops := &Fifo{
+		InodeOperations: iops,
+		xattrUsage:      xattrUsage(msrc),
+	}
 
 	// Build a new Inode.
 	return fs.NewInode(ctx, fifoIops, msrc, fs.StableAttr{
@@ -382,6 +492,6 @@ func (f *Fifo) Rename(ctx context.Context, inode *fs.Inode, oldParent *fs.Inode,
 }
 
 // StatFS returns the tmpfs info.
-func (*Fifo) StatFS(context.Context) (fs.Info, error) {
-	return fsInfo, nil
+func (f *Fifo) StatFS(context.Context) (fs.Info, error) {
+	return statFS(f.xattrUsage), nil
 }
@@ -0,0 +1,232 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package xattrtest provides a conformance test suite for the extended
+// attribute methods of fs.InodeOperations.
+//
+// Filesystems only need to store and retrieve attributes: permission checks,
+// namespace validation and size limits are all handled by the syscall layer
+// before the InodeOperations are called. Run checks the storage semantics that
+// the syscall layer relies on.
+package xattrtest
+
+import (
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/syserror"
+)
+
+// Run runs the conformance tests against Inodes returned by newInode, each of
+// which must be new and have no extended attributes in the user namespace.
+// Each Inode is released with DecRef once its test completes.
+//
+// If the Inodes don't support extended attributes, Run only checks that every
+// extended attribute method fails with EOPNOTSUPP.
+func Run(t *testing.T, ctx context.Context, newInode func(t *testing.T) *fs.Inode) {
+	for _, test := range []struct {
+		name string
+		fn   func(t *testing.T, ctx context.Context, inode *fs.Inode)
+	}{
+		{"GetMissing", testGetMissing},
+		{"SetGet", testSetGet},
+		{"EmptyValue", testEmptyValue},
+		{"Create", testCreate},
+		{"Replace", testReplace},
+		{"List", testList},
+		{"Remove", testRemove},
+		{"SizeHint", testSizeHint},
+		{"Full", testFull},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			inode := newInode(t)
+			defer inode.DecRef(ctx)
+			if !inode.SupportsXattrs() {
+				testUnsupported(t, ctx, inode)
+				return
+			}
+			test.fn(t, ctx, inode)
+		})
+	}
+}
+
+const (
+	name  = "user.test"
+	name2 = "user.test2"
+)
+
+// mustSet sets name to value on inode, failing the test on error.
+func mustSet(t *testing.T, ctx context.Context, inode *fs.Inode, name, value string) {
+	t.Helper()
+	if err := inode.SetXattr(ctx, nil, name, value, 0 /* flags */); err != nil {
+		t.Fatalf("SetXattr(%q) failed: %v", name, err)
+	}
+}
+
+// checkValue checks that name has value on inode.
+func checkValue(t *testing.T, ctx context.Context, inode *fs.Inode, name, want string) {
+	t.Helper()
+	got, err := inode.GetXattr(ctx, name, linux.XATTR_SIZE_MAX)
+	if err != nil {
+		t.Errorf("GetXattr(%q) failed: %v", name, err)
+		return
+	}
+	if got != want {
+		t.Errorf("GetXattr(%q) got %q, want %q", name, got, want)
+	}
+}
+
+// checkMissing checks that name has no value on inode.
+func checkMissing(t *testing.T, ctx context.Context, inode *fs.Inode, name string) {
+	t.Helper()
+	if _, err := inode.GetXattr(ctx, name, linux.XATTR_SIZE_MAX); err != syserror.ENODATA {
+		t.Errorf("GetXattr(%q) got error %v, want %v", name, err, syserror.ENODATA)
+	}
+}
+
+func testUnsupported(t *testing.T, ctx context.Context, inode *fs.Inode) {
+	if _, err := inode.GetXattr(ctx, name, linux.XATTR_SIZE_MAX); err != syserror.EOPNOTSUPP {
+		t.Errorf("GetXattr got error %v, want %v", err, syserror.EOPNOTSUPP)
+	}
+	if _, err := inode.GetXattrFull(ctx, name); err != syserror.EOPNOTSUPP {
+		t.Errorf("GetXattrFull got error %v, want %v", err, syserror.EOPNOTSUPP)
+	}
+	if err := inode.SetXattr(ctx, nil, name, "value", 0 /* flags */); err != syserror.EOPNOTSUPP {
+		t.Errorf("SetXattr got error %v, want %v", err, syserror.EOPNOTSUPP)
+	}
+	if _, err := inode.ListXattr(ctx, linux.XATTR_LIST_MAX); err != syserror.EOPNOTSUPP {
+		t.Errorf("ListXattr got error %v, want %v", err, syserror.EOPNOTSUPP)
+	}
+	if err := inode.RemoveXattr(ctx, nil, name); err != syserror.EOPNOTSUPP {
+		t.Errorf("RemoveXattr got error %v, want %v", err, syserror.EOPNOTSUPP)
+	}
+}
+
+func testGetMissing(t *testing.T, ctx context.Context, inode *fs.Inode) {
+	checkMissing(t, ctx, inode, name)
+}
+
+func testSetGet(t *testing.T, ctx context.Context, inode *fs.Inode) {
+	// Values are opaque bytes, not strings.
+	const value = "a\x00b\xff"
+	mustSet(t, ctx, inode, name, value)
+	checkValue(t, ctx, inode, name, value)
+
+	// Without flags, an existing value is overwritten.
+	mustSet(t, ctx, inode, name, "new")
+	checkValue(t, ctx, inode, name, "new")
+}
+
+func testEmptyValue(t *testing.T, ctx context.Context, inode *fs.Inode) {
+	// An empty value is still a value.
+	mustSet(t, ctx, inode, name, "")
+	checkValue(t, ctx, inode, name, "")
+	if err := inode.SetXattr(ctx, nil, name, "value", linux.XATTR_CREATE); err != syserror.EEXIST {
+		t.Errorf("SetXattr with XATTR_CREATE got error %v, want %v", err, syserror.EEXIST)
+	}
+}
+
+func testCreate(t *testing.T, ctx context.Context, inode *fs.Inode) {
+	if err := inode.SetXattr(ctx, nil, name, "value", linux.XATTR_CREATE); err != nil {
+		t.Fatalf("SetXattr with XATTR_CREATE failed: %v", err)
+	}
+	if err := inode.SetXattr(ctx, nil, name, "new", linux.XATTR_CREATE); err != syserror.EEXIST {
+		t.Errorf("SetXattr with XATTR_CREATE got error %v, want %v", err, syserror.EEXIST)
+	}
+	checkValue(t, ctx, inode, name, "value")
+}
+
+func testReplace(t *testing.T, ctx context.Context, inode *fs.Inode) {
+	if err := inode.SetXattr(ctx, nil, name, "value", linux.XATTR_REPLACE); err != syserror.ENODATA {
+		t.Errorf("SetXattr with XATTR_REPLACE got error %v, want %v", err, syserror.ENODATA)
+	}
+	checkMissing(t, ctx, inode, name)
+
+	mustSet(t, ctx, inode, name, "value")
+	if err := inode.SetXattr(ctx, nil, name, "new", linux.XATTR_REPLACE); err != nil {
+		t.Fatalf("SetXattr with XATTR_REPLACE failed: %v", err)
+	}
+	checkValue(t, ctx, inode, name, "new")
+}
+
+func testList(t *testing.T, ctx context.Context, inode *fs.Inode) {
+	mustSet(t, ctx, inode, name, "value")
+	mustSet(t, ctx, inode, name2, "")
+	names, err := inode.ListXattr(ctx, linux.XATTR_LIST_MAX)
+	if err != nil {
+		t.Fatalf("ListXattr failed: %v", err)
+	}
+	// Attributes outside the user namespace, e.g. security labels, may also be
+	// listed.
+	for _, n := range []string{name, name2} {
+		if _, ok := names[n]; !ok {
+			t.Errorf("ListXattr got %v, want %q included", names, n)
+		}
+	}
+}
+
+func testRemove(t *testing.T, ctx context.Context, inode *fs.Inode) {
+	if err := inode.RemoveXattr(ctx, nil, name); err != syserror.ENODATA {
+		t.Errorf("RemoveXattr of missing attribute got error %v, want %v", err, syserror.ENODATA)
+	}
+
+	mustSet(t, ctx, inode, name, "value")
+	mustSet(t, ctx, inode, name2, "value2")
+	if err := inode.RemoveXattr(ctx, nil, name); err != nil {
+		t.Fatalf("RemoveXattr failed: %v", err)
+	}
+	checkMissing(t, ctx, inode, name)
+	checkValue(t, ctx, inode, name2, "value2")
+
+	names, err := inode.ListXattr(ctx, linux.XATTR_LIST_MAX)
+	if err != nil {
+		t.Fatalf("ListXattr failed: %v", err)
+	}
+	if _, ok := names[name]; ok {
+		t.Errorf("ListXattr got %v, want %q removed", names, name)
+	}
+}
+
+func testSizeHint(t *testing.T, ctx context.Context, inode *fs.Inode) {
+	// Implementations may either ignore a size hint that is too small or fail
+	// with ERANGE, but must not truncate the value.
+	const value = "value"
+	mustSet(t, ctx, inode, name, value)
+	got, err := inode.GetXattr(ctx, name, uint64(len(value)-1))
+	if err != nil && err != syserror.ERANGE {
+		t.Fatalf("GetXattr with small size got error %v, want nil or %v", err, syserror.ERANGE)
+	}
+	if err == nil && got != value {
+		t.Errorf("GetXattr with small size got %q, want %q", got, value)
+	}
+}
+
+func testFull(t *testing.T, ctx context.Context, inode *fs.Inode) {
+	// Values as large as getxattr(2) allows must be retrieved in full.
+	value := strings.Repeat("a", linux.XATTR_SIZE_MAX)
+	mustSet(t, ctx, inode, name, value)
+	got, err := inode.GetXattrFull(ctx, name)
+	if err != nil {
+		t.Fatalf("GetXattrFull failed: %v", err)
+	}
+	if got != value {
+		t.Errorf("GetXattrFull got value of length %d, want %d", len(got), len(value))
+	}
+	if _, err := inode.GetXattrFull(ctx, name2); err != syserror.ENODATA {
+		t.Errorf("GetXattrFull(%q) got error %v, want %v", name2, err, syserror.ENODATA)
+	}
+}
@@ -139,3 +139,30 @@ func (fd *DynamicBytesFD) SetStat(context.Context, vfs.SetStatOptions) error {
 	// DynamicBytesFiles are immutable.
 	return syserror.EPERM
 }
+
+// GetXattr implements vfs.FileDescriptionImpl.GetXattr.
+func (fd *DynamicBytesFD) GetXattr(ctx context.Context, opts vfs.GetXattrOptions) (string, error) {
+	fs := fd.vfsfd.VirtualDentry().Mount().Filesystem()
+	if err := checkXattrPermissions(ctx, auth.CredentialsFromContext(ctx), fs, fd.inode, opts.Name, vfs.MayRead); err != nil {
+		return "", err
+	}
+	return fd.FileDescriptionDefaultImpl.GetXattr(ctx, opts)
+}
+
+// SetXattr implements vfs.FileDescriptionImpl.SetXattr.
+func (fd *DynamicBytesFD) SetXattr(ctx context.Context, opts vfs.SetXattrOptions) error {
+	fs := fd.vfsfd.VirtualDentry().Mount().Filesystem()
+	if err := checkXattrPermissions(ctx, auth.CredentialsFromContext(ctx), fs, fd.inode, opts.Name, vfs.MayWrite); err != nil {
+		return err
+	}
+	return fd.FileDescriptionDefaultImpl.SetXattr(ctx, opts)
+}
+
+// RemoveXattr implements vfs.FileDescriptionImpl.RemoveXattr.
+func (fd *DynamicBytesFD) RemoveXattr(ctx context.Context, name string) error {
+	fs := fd.vfsfd.VirtualDentry().Mount().Filesystem()
+	if err := checkXattrPermissions(ctx, auth.CredentialsFromContext(ctx), fs, fd.inode, name, vfs.MayWrite); err != nil {
+		return err
+	}
+	return fd.FileDescriptionDefaultImpl.RemoveXattr(ctx, name)
+}
@@ -270,6 +270,30 @@ func (fd *GenericDirectoryFD) SetStat(ctx context.Context, opts vfs.SetStatOptio
 	return fd.inode().SetStat(ctx, fd.filesystem(), creds, opts)
 }
 
+// GetXattr implements vfs.FileDescriptionImpl.GetXattr.
+func (fd *GenericDirectoryFD) GetXattr(ctx context.Context, opts vfs.GetXattrOptions) (string, error) {
+	if err := checkXattrPermissions(ctx, auth.CredentialsFromContext(ctx), fd.filesystem(), fd.inode(), opts.Name, vfs.MayRead); err != nil {
+		return "", err
+	}
+	return fd.FileDescriptionDefaultImpl.GetXattr(ctx, opts)
+}
+
+// SetXattr implements vfs.FileDescriptionImpl.SetXattr.
+func (fd *GenericDirectoryFD) SetXattr(ctx context.Context, opts vfs.SetXattrOptions) error {
+	if err := checkXattrPermissions(ctx, auth.CredentialsFromContext(ctx), fd.filesystem(), fd.inode(), opts.Name, vfs.MayWrite); err != nil {
+		return err
+	}
+	return fd.FileDescriptionDefaultImpl.SetXattr(ctx, opts)
+}
+
+// RemoveXattr implements vfs.FileDescriptionImpl.RemoveXattr.
+func (fd *GenericDirectoryFD) RemoveXattr(ctx context.Context, name string) error {
+	if err := checkXattrPermissions(ctx, auth.CredentialsFromContext(ctx), fd.filesystem(), fd.inode(), name, vfs.MayWrite); err != nil {
+		return err
+	}
+	return fd.FileDescriptionDefaultImpl.RemoveXattr(ctx, name)
+}
+
 // Allocate implements vfs.FileDescriptionImpl.Allocate.
 func (fd *GenericDirectoryFD) Allocate(ctx context.Context, mode, offset, length uint64) error {
 	return fd.DirectoryFileDescriptionDefaultImpl.Allocate(ctx, mode, offset, length)
@@ -18,6 +18,7 @@ package kernfs
 
 import (
 	"fmt"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -929,6 +930,33 @@ func (fs *Filesystem) BoundEndpointAt(ctx context.Context, rp *vfs.ResolvingPath
 	return nil, syserror.ECONNREFUSED
 }
 
+// checkXattrPermissions checks that creds may access the extended attribute
+// name of inode for ats, as in Linux's fs/xattr.c:xattr_permission(). kernfs
+// inodes don't support extended attributes, but in Linux these checks precede
+// the resulting EOPNOTSUPP.
+func checkXattrPermissions(ctx context.Context, creds *auth.Credentials, fs *vfs.Filesystem, inode Inode, name string, ats vfs.AccessTypes) error {
+	mode := inode.Mode()
+	var kuid auth.KUID
+	if mode.FileType() == linux.ModeDirectory && mode&linux.ModeSticky != 0 && ats.MayWrite() {
+		// Only needed to check ownership of sticky directories.
+		stat, err := inode.Stat(ctx, fs, vfs.StatOptions{Mask: linux.STATX_UID})
+		if err != nil {
+			return err
+		}
+		kuid = auth.KUID(stat.UID)
+	}
+	if err := vfs.CheckXattrPermissions(creds, ats, mode, kuid, name); err != nil {
+		return err
+	}
+	// Access to these namespaces doesn't depend on the file's mode.
+	if strings.HasPrefix(name, linux.XATTR_SECURITY_PREFIX) ||
+		strings.HasPrefix(name, linux.XATTR_SYSTEM_PREFIX) ||
+		strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX) {
+		return nil
+	}
+	return inode.CheckPermissions(ctx, creds, ats)
+}
+
 // ListXattrAt implements vfs.FilesystemImpl.ListXattrAt.
 func (fs *Filesystem) ListXattrAt(ctx context.Context, rp *vfs.ResolvingPath, size uint64) ([]string, error) {
 	fs.mu.RLock()
@@ -938,8 +966,10 @@ func (fs *Filesystem) ListXattrAt(ctx context.Context, rp *vfs.ResolvingPath, si
 	if err != nil {
 		return nil, err
 	}
-	// kernfs currently does not support extended attributes.
-	return nil, syserror.ENOTSUP
+	// kernfs currently does not support extended attributes. As in
+	// vfs.FileDescription.ListXattr, Linux lists no attributes rather than
+	// failing.
+	return nil, nil
 }
 
 // GetXattrAt implements vfs.FilesystemImpl.GetXattrAt.
@@ -947,10 +977,13 @@ func (fs *Filesystem) GetXattrAt(ctx context.Context, rp *vfs.ResolvingPath, opt
 	fs.mu.RLock()
 	defer fs.processDeferredDecRefs(ctx)
 	defer fs.mu.RUnlock()
-	_, err := fs.walkExistingLocked(ctx, rp)
+	d, err := fs.walkExistingLocked(ctx, rp)
 	if err != nil {
 		return "", err
 	}
+	if err := checkXattrPermissions(ctx, rp.Credentials(), fs.VFSFilesystem(), d.inode, opts.Name, vfs.MayRead); err != nil {
+		return "", err
+	}
 	// kernfs currently does not support extended attributes.
 	return "", syserror.ENOTSUP
 }
@@ -960,10 +993,17 @@ func (fs *Filesystem) SetXattrAt(ctx context.Context, rp *vfs.ResolvingPath, opt
 	fs.mu.RLock()
 	defer fs.processDeferredDecRefs(ctx)
 	defer fs.mu.RUnlock()
-	_, err := fs.walkExistingLocked(ctx, rp)
+	d, err := fs.walkExistingLocked(ctx, rp)
 	if err != nil {
 		return err
 	}
+	if err := rp.Mount().CheckBeginWrite(); err != nil {
+		return err
+	}
+	defer rp.Mount().EndWrite()
+	if err := checkXattrPermissions(ctx, rp.Credentials(), fs.VFSFilesystem(), d.inode, opts.Name, vfs.MayWrite); err != nil {
+		return err
+	}
 	// kernfs currently does not support extended attributes.
 	return syserror.ENOTSUP
 }
@@ -973,10 +1013,17 @@ func (fs *Filesystem) RemoveXattrAt(ctx context.Context, rp *vfs.ResolvingPath,
 	fs.mu.RLock()
 	defer fs.processDeferredDecRefs(ctx)
 	defer fs.mu.RUnlock()
-	_, err := fs.walkExistingLocked(ctx, rp)
+	d, err := fs.walkExistingLocked(ctx, rp)
 	if err != nil {
 		return err
 	}
+	if err := rp.Mount().CheckBeginWrite(); err != nil {
+		return err
+	}
+	defer rp.Mount().EndWrite()
+	if err := checkXattrPermissions(ctx, rp.Credentials(), fs.VFSFilesystem(), d.inode, name, vfs.MayWrite); err != nil {
+		return err
+	}
 	// kernfs currently does not support extended attributes.
 	return syserror.ENOTSUP
 }
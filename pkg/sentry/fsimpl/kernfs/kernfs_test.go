@@ -346,3 +346,80 @@ func TestDirFDIterDirents(t *testing.T) {
 		"file1": linux.DT_REG,
 	})
 }
+
+func TestXattr(t *testing.T) {
+	sys := newTestSystem(t, func(ctx context.Context, creds *auth.Credentials, fs *filesystem) kernfs.Inode {
+		return fs.newReadonlyDir(ctx, creds, 0755, map[string]kernfs.Inode{
+			"dir1":  fs.newReadonlyDir(ctx, creds, 0555, nil),
+			"file1": fs.newFile(ctx, creds, staticFileContent),
+		})
+	})
+	defer sys.Destroy()
+
+	// Without CAP_SYS_ADMIN or CAP_DAC_OVERRIDE, permission checks fail before
+	// kernfs reports that extended attributes are unsupported.
+	unprivileged := sys.Creds.Fork()
+	unprivileged.EffectiveCaps = 0
+
+	for _, test := range []struct {
+		name  string
+		path  string
+		creds *auth.Credentials
+		xattr string
+		get   error
+		set   error
+	}{
+		{
+			name:  "file",
+			path:  "/file1",
+			creds: sys.Creds,
+			xattr: "user.test",
+			get:   syserror.ENOTSUP,
+			set:   syserror.ENOTSUP,
+		},
+		{
+			name:  "dir",
+			path:  "/dir1",
+			creds: sys.Creds,
+			xattr: "user.test",
+			get:   syserror.ENOTSUP,
+			set:   syserror.ENOTSUP,
+		},
+		{
+			name:  "dir without write permission",
+			path:  "/dir1",
+			creds: unprivileged,
+			xattr: "user.test",
+			get:   syserror.ENOTSUP,
+			set:   syserror.EACCES,
+		},
+		{
+			name:  "trusted without CAP_SYS_ADMIN",
+			path:  "/file1",
+			creds: unprivileged,
+			xattr: "trusted.test",
+			get:   syserror.ENODATA,
+			set:   syserror.EPERM,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			pop := sys.PathOpAtRoot(test.path)
+			if _, err := sys.VFS.GetXattrAt(sys.Ctx, test.creds, pop, &vfs.GetXattrOptions{Name: test.xattr, Size: linux.XATTR_SIZE_MAX}); err != test.get {
+				t.Errorf("GetXattrAt(%q) got error %v, want %v", test.xattr, err, test.get)
+			}
+			if err := sys.VFS.SetXattrAt(sys.Ctx, test.creds, pop, &vfs.SetXattrOptions{Name: test.xattr, Value: "value"}); err != test.set {
+				t.Errorf("SetXattrAt(%q) got error %v, want %v", test.xattr, err, test.set)
+			}
+			if err := sys.VFS.RemoveXattrAt(sys.Ctx, test.creds, pop, test.xattr); err != test.set {
+				t.Errorf("RemoveXattrAt(%q) got error %v, want %v", test.xattr, err, test.set)
+			}
+			names, err := sys.VFS.ListXattrAt(sys.Ctx, test.creds, pop, linux.XATTR_LIST_MAX)
+			if err != nil {
+				t.Errorf("ListXattrAt failed: %v", err)
+			}
+			if len(names) != 0 {
+				t.Errorf("ListXattrAt got %v, want none", names)
+			}
+		})
+	}
+}
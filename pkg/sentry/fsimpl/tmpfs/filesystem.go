@@ -837,7 +837,13 @@ func (fs *filesystem) SetXattrAt(ctx context.Context, rp *vfs.ResolvingPath, opt
 		fs.mu.RUnlock()
 		return err
 	}
+	mnt := rp.Mount()
+	if err := mnt.CheckBeginWrite(); err != nil {
+		fs.mu.RUnlock()
+		return err
+	}
 	err = d.inode.setXattr(rp.Credentials(), &opts)
+	mnt.EndWrite()
 	fs.mu.RUnlock()
 	if err != nil {
 		return err
@@ -855,7 +861,13 @@ func (fs *filesystem) RemoveXattrAt(ctx context.Context, rp *vfs.ResolvingPath,
 		fs.mu.RUnlock()
 		return err
 	}
+	mnt := rp.Mount()
+	if err := mnt.CheckBeginWrite(); err != nil {
+		fs.mu.RUnlock()
+		return err
+	}
 	err = d.inode.removeXattr(rp.Credentials(), name)
+	mnt.EndWrite()
 	fs.mu.RUnlock()
 	if err != nil {
 		return err
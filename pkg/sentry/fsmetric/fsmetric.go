@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/syserror"
 )
 
 // RecordWaitTime enables the ReadWait, GoferReadWait9P, GoferReadWaitHost, and
@@ -40,6 +41,19 @@ var (
 	ReadWait = metric.MustCreateNewUint64NanosecondsMetric("/fs/read_wait", false /* sync */, "Time waiting on file reads, in nanoseconds.")
 )
 
+// Metrics for extended attribute syscalls. Each syscall family (e.g.
+// getxattr(2), lgetxattr(2) and fgetxattr(2)) shares a counter.
+var (
+	XattrGets       = metric.MustCreateNewUint64Metric("/fs/xattr/gets", false /* sync */, "Number of getxattr syscalls.")
+	XattrSets       = metric.MustCreateNewUint64Metric("/fs/xattr/sets", false /* sync */, "Number of setxattr syscalls.")
+	XattrLists      = metric.MustCreateNewUint64Metric("/fs/xattr/lists", false /* sync */, "Number of listxattr syscalls.")
+	XattrRemoves    = metric.MustCreateNewUint64Metric("/fs/xattr/removes", false /* sync */, "Number of removexattr syscalls.")
+	XattrERANGE     = metric.MustCreateNewUint64Metric("/fs/xattr/erange", false /* sync */, "Number of xattr syscalls that failed with ERANGE.")
+	XattrENODATA    = metric.MustCreateNewUint64Metric("/fs/xattr/enodata", false /* sync */, "Number of xattr syscalls that failed with ENODATA.")
+	XattrEOPNOTSUPP = metric.MustCreateNewUint64Metric("/fs/xattr/eopnotsupp", false /* sync */, "Number of xattr syscalls that failed with EOPNOTSUPP.")
+	XattrCopyUps    = metric.MustCreateNewUint64Metric("/fs/xattr/copy_ups", false /* sync */, "Number of xattr changes that copied up an overlay file from its lower layer.")
+)
+
 // Metrics that only apply to fs/gofer and fsimpl/gofer.
 var (
 	GoferOpens9P      = metric.MustCreateNewUint64Metric("/gofer/opens_9p", false /* sync */, "Number of times a file was opened from a gofer and did not have a host file descriptor.")
@@ -58,6 +72,20 @@ var (
 	TmpfsReadWait = metric.MustCreateNewUint64NanosecondsMetric("/in_memory_file/read_wait", false /* sync */, "Time waiting on in-memory file reads, in nanoseconds.")
 )
 
+// RecordXattr records an xattr syscall that returned err in m, which must be
+// one of XattrGets, XattrSets, XattrLists or XattrRemoves.
+func RecordXattr(m *metric.Uint64Metric, err error) {
+	m.Increment()
+	switch err {
+	case syserror.ERANGE:
+		XattrERANGE.Increment()
+	case syserror.ENODATA:
+		XattrENODATA.Increment()
+	case syserror.EOPNOTSUPP:
+		XattrEOPNOTSUPP.Increment()
+	}
+}
+
 // StartReadWait indicates the beginning of a file read.
 func StartReadWait() time.Time {
 	if !RecordWaitTime {
@@ -133,3 +133,15 @@ func (kuid KUID) In(ns *UserNamespace) UID {
 func (kgid KGID) In(ns *UserNamespace) GID {
 	return ns.MapFromKGID(kgid)
 }
+
+// IsRootInAncestor returns whether kuid is root in ns or any of its ancestors,
+// i.e. whether kuid is privileged in ns. Compare Linux's
+// security/commoncap.c:rootid_owns_currentns().
+func (kuid KUID) IsRootInAncestor(ns *UserNamespace) bool {
+	for ; ns != nil; ns = ns.parent {
+		if kuid.In(ns) == RootUID {
+			return true
+		}
+	}
+	return false
+}
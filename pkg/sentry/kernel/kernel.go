@@ -35,6 +35,7 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -299,6 +300,33 @@ type Kernel struct {
 	// system. It is controller by cgroupfs. Nil if cgroupfs is unavailable on
 	// the system.
 	cgroupRegistry *CgroupRegistry
+
+	// allowedXattrNamespaces is the set of extended attribute namespaces
+	// (e.g. "user") that applications may access. If nil, all namespaces are
+	// allowed. allowedXattrNamespaces is immutable after Init.
+	allowedXattrNamespaces map[string]struct{}
+
+	// selinuxLabel is the SELinux context returned for the security.selinux
+	// extended attribute of every file. If empty, security.selinux is handled
+	// by filesystems like any other attribute. selinuxLabel is immutable
+	// after Init.
+	selinuxLabel string
+
+	// ignoreSELinuxLabelWrites is true if attempts to set or remove
+	// security.selinux succeed without effect, rather than failing with
+	// EOPNOTSUPP. It is only meaningful if selinuxLabel is set, and is
+	// immutable after Init.
+	ignoreSELinuxLabelWrites bool
+
+	// xattrRateLimit is the maximum rate, in operations per second, of each
+	// task's extended attribute syscalls. If 0, the rate is unlimited.
+	// xattrRateLimit is immutable after Init.
+	xattrRateLimit int
+
+	// xattrRateLimitBlock is true if tasks that exceed xattrRateLimit block
+	// until they may proceed, rather than failing with EAGAIN.
+	// xattrRateLimitBlock is immutable after Init.
+	xattrRateLimitBlock bool
 }
 
 // InitKernelArgs holds arguments to Init.
@@ -343,6 +371,29 @@ type InitKernelArgs struct {
 
 	// PIDNamespace is the root PID namespace.
 	PIDNamespace *PIDNamespace
+
+	// AllowedXattrNamespaces is the set of extended attribute namespaces
+	// (e.g. "user") that applications may access, regardless of their
+	// privileges. If nil, all namespaces are allowed.
+	AllowedXattrNamespaces []string
+
+	// SELinuxLabel is the static SELinux context returned for the
+	// security.selinux extended attribute of every file. If empty, no label
+	// is synthesized.
+	SELinuxLabel string
+
+	// IgnoreSELinuxLabelWrites causes attempts to set or remove
+	// security.selinux to succeed without effect if SELinuxLabel is set.
+	IgnoreSELinuxLabelWrites bool
+
+	// XattrRateLimit is the maximum rate, in operations per second, of each
+	// task's extended attribute syscalls. Tasks may perform up to one
+	// second's worth of operations in a burst. If 0, the rate is unlimited.
+	XattrRateLimit int
+
+	// XattrRateLimitBlock causes tasks that exceed XattrRateLimit to block
+	// until they may proceed, rather than failing with EAGAIN.
+	XattrRateLimitBlock bool
 }
 
 // SetTimekeeper sets Kernel.timekeeper. SetTimekeeper must be called before
@@ -374,6 +425,19 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 
 	k.featureSet = args.FeatureSet
 	k.tasks = newTaskSet(args.PIDNamespace)
+	if args.AllowedXattrNamespaces != nil {
+		k.allowedXattrNamespaces = make(map[string]struct{}, len(args.AllowedXattrNamespaces))
+		for _, ns := range args.AllowedXattrNamespaces {
+			k.allowedXattrNamespaces[ns] = struct{}{}
+		}
+	}
+	k.selinuxLabel = args.SELinuxLabel
+	k.ignoreSELinuxLabelWrites = args.IgnoreSELinuxLabelWrites
+	if args.XattrRateLimit < 0 {
+		return fmt.Errorf("args.XattrRateLimit is negative: %d", args.XattrRateLimit)
+	}
+	k.xattrRateLimit = args.XattrRateLimit
+	k.xattrRateLimitBlock = args.XattrRateLimitBlock
 	k.rootUserNamespace = args.RootUserNamespace
 	k.rootUTSNamespace = args.RootUTSNamespace
 	k.rootIPCNamespace = args.RootIPCNamespace
@@ -1830,6 +1894,35 @@ func (k *Kernel) CgroupRegistry() *CgroupRegistry {
 	return k.cgroupRegistry
 }
 
+// XattrNamespaceAllowed returns true if applications may access the extended
+// attribute name, based on its namespace. Names without a namespace are
+// allowed, and left to callers to reject.
+func (k *Kernel) XattrNamespaceAllowed(name string) bool {
+	if k.allowedXattrNamespaces == nil {
+		return true
+	}
+	i := strings.IndexByte(name, '.')
+	if i < 0 {
+		return true
+	}
+	_, ok := k.allowedXattrNamespaces[name[:i]]
+	return ok
+}
+
+// SELinuxLabel returns the static SELinux context that applications see as
+// the security.selinux extended attribute of every file, or "" if none is
+// configured.
+func (k *Kernel) SELinuxLabel() string {
+	return k.selinuxLabel
+}
+
+// IgnoreSELinuxLabelWrites returns true if attempts to set or remove the
+// static security.selinux label should succeed without effect, rather than
+// failing with EOPNOTSUPP.
+func (k *Kernel) IgnoreSELinuxLabelWrites() bool {
+	return k.ignoreSELinuxLabelWrites
+}
+
 // Release releases resources owned by k.
 //
 // Precondition: This should only be called after the kernel is fully
@@ -0,0 +1,112 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+	"time"
+
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+)
+
+func TestXattrNamespaceAllowed(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		allowed map[string]struct{}
+		xattr   string
+		want    bool
+	}{
+		{
+			name:  "default user",
+			xattr: "user.test",
+			want:  true,
+		},
+		{
+			name:  "default trusted",
+			xattr: "trusted.test",
+			want:  true,
+		},
+		{
+			name:    "allowed",
+			allowed: map[string]struct{}{"user": {}},
+			xattr:   "user.test",
+			want:    true,
+		},
+		{
+			name:    "disallowed",
+			allowed: map[string]struct{}{"user": {}},
+			xattr:   "trusted.test",
+			want:    false,
+		},
+		{
+			name:    "none allowed",
+			allowed: map[string]struct{}{},
+			xattr:   "user.test",
+			want:    false,
+		},
+		{
+			name:    "prefix of allowed",
+			allowed: map[string]struct{}{"user": {}},
+			xattr:   "use.test",
+			want:    false,
+		},
+		{
+			name:    "no namespace",
+			allowed: map[string]struct{}{"user": {}},
+			xattr:   "test",
+			want:    true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			k := &Kernel{allowedXattrNamespaces: test.allowed}
+			if got := k.XattrNamespaceAllowed(test.xattr); got != test.want {
+				t.Errorf("XattrNamespaceAllowed(%q) got %t want %t", test.xattr, got, test.want)
+			}
+		})
+	}
+}
+
+func TestXattrRateLimiter(t *testing.T) {
+	const rate = 2
+	var l xattrRateLimiter
+	start := ktime.FromNanoseconds(int64(time.Hour))
+	take := func(now ktime.Time, want bool) ktime.Time {
+		t.Helper()
+		next, ok := l.take(now, rate)
+		if ok != want {
+			t.Fatalf("take(%v) got %t, want %t", now, ok, want)
+		}
+		return next
+	}
+
+	// A full bucket allows a burst of rate operations.
+	take(start, true)
+	take(start, true)
+	if got, want := take(start, false), start.Add(500*time.Millisecond); got != want {
+		t.Errorf("take(%v) got next token at %v, want %v", start, got, want)
+	}
+
+	// Tokens are refilled at rate per second.
+	take(start.Add(499*time.Millisecond), false)
+	take(start.Add(500*time.Millisecond), true)
+	take(start.Add(999*time.Millisecond), false)
+	take(start.Add(time.Second), true)
+
+	// The bucket holds at most rate tokens, however long it's unused.
+	now := start.Add(time.Hour)
+	take(now, true)
+	take(now, true)
+	take(now, false)
+}
@@ -593,6 +593,12 @@ type Task struct {
 	//
 	// +checklocks:mu
 	cgroups map[Cgroup]struct{}
+
+	// xattrRateLimiter limits the rate of the task's extended attribute
+	// syscalls, if the kernel is configured to do so.
+	//
+	// xattrRateLimiter is exclusive to the task goroutine.
+	xattrRateLimiter xattrRateLimiter
 }
 
 func (t *Task) savePtraceTracer() *Task {
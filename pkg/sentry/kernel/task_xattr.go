@@ -0,0 +1,95 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"time"
+
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/syserror"
+)
+
+// xattrRateLimiter is a token bucket that limits the rate of a task's
+// extended attribute syscalls. The zero value is a full bucket.
+//
+// +stateify savable
+type xattrRateLimiter struct {
+	// tokens is the number of operations that could be performed without
+	// waiting as of last.
+	tokens int
+
+	// last is the time, on the application monotonic clock, at which tokens
+	// was computed. If last is zero, the limiter has never been used.
+	last ktime.Time
+}
+
+// take consumes a token at time now from a bucket that holds at most rate
+// tokens and is refilled at rate tokens per second. If no token is available,
+// take returns false and the time at which one will be.
+//
+// Preconditions: rate > 0.
+func (l *xattrRateLimiter) take(now ktime.Time, rate int) (ktime.Time, bool) {
+	interval := time.Second / time.Duration(rate)
+	if interval == 0 {
+		interval = 1
+	}
+	if l.last.IsZero() {
+		l.tokens = rate
+		l.last = now
+	}
+	if n := now.Sub(l.last) / interval; n > 0 {
+		// Only advance last by the time it took to produce whole tokens, so
+		// that partial progress towards the next one isn't lost.
+		if n >= time.Duration(rate-l.tokens) {
+			l.tokens = rate
+			l.last = now
+		} else {
+			l.tokens += int(n)
+			l.last = l.last.Add(n * interval)
+		}
+	}
+	if l.tokens == 0 {
+		return l.last.Add(interval), false
+	}
+	l.tokens--
+	return now, true
+}
+
+// LimitXattrRate must be called by extended attribute syscalls before they
+// perform any work. If the kernel limits the rate of such syscalls and t has
+// exceeded the limit, LimitXattrRate either blocks until t may proceed or
+// returns EAGAIN, depending on the kernel's configuration. If t is interrupted
+// while blocked, it returns syserror.ErrInterrupted.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) LimitXattrRate() error {
+	rate := t.k.xattrRateLimit
+	if rate == 0 {
+		return nil
+	}
+	clock := t.k.MonotonicClock()
+	for {
+		deadline, ok := t.xattrRateLimiter.take(clock.Now(), rate)
+		if ok {
+			return nil
+		}
+		if !t.k.xattrRateLimitBlock {
+			return syserror.EAGAIN
+		}
+		if err := t.BlockWithDeadline(nil, true, deadline); err != syserror.ETIMEDOUT {
+			return err
+		}
+	}
+}
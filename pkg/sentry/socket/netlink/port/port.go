@@ -18,100 +18,610 @@
 // to the PID of the binding process. If that port is unavailable, negative
 // ports are searched to find a free port that will not conflict with other
 // PIDS.
+//
+// As in Linux, ports are scoped to a network namespace: the same port may be
+// allocated for the same protocol in two different network namespaces.
 package port
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io"
 	"math"
-	"math/rand"
+	"strconv"
+	"sync/atomic"
 
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/rand"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserror"
 )
 
 // maxPorts is a sanity limit on the maximum number of ports to allocate per
 // protocol.
 const maxPorts = 10000
 
+// Ports that aren't taken from a hint are searched for in
+// [minSearchPort, maxSearchPort] by default. The positive port space is left
+// open for pid-based allocations. This behavior is consistent with Linux.
+const (
+	minSearchPort = math.MinInt32
+	maxSearchPort = -4097
+)
+
+// randomProbes is the number of random ports tried by a randomized search
+// before it falls back to a linear scan. In the default search range nearly
+// every probe succeeds; only small, dense configured ranges need the scan.
+const randomProbes = 8
+
+// reapedPorts counts ports released by Manager.ReapOrphans.
+var reapedPorts = metric.MustCreateNewUint64Metric("/netlink/reaped_ports", false /* sync */, "Number of netlink ports released because their socket no longer existed.")
+
+// maxProtocols is the number of netlink protocols, MAX_LINKS in Linux.
+const maxProtocols = 32
+
+// allocatedPorts is the number of ports allocated to sockets by all Managers.
+// It is exported as a gauge, and must be accessed atomically.
+var allocatedPorts int64
+
+// protocolAllocatedPorts is allocatedPorts broken down by protocol, for
+// protocols below maxProtocols. It is exported as a gauge with a field for
+// the protocol, and must be accessed atomically.
+var protocolAllocatedPorts [maxProtocols]int64
+
+func init() {
+	metric.MustRegisterCustomUint64Metric("/netlink/allocated_ports", false /* cumulative */, false /* sync */, "Number of netlink ports currently allocated to sockets.", func(...string) uint64 {
+		return uint64(atomic.LoadInt64(&allocatedPorts))
+	})
+
+	protocols := make([]string, maxProtocols)
+	for i := range protocols {
+		protocols[i] = strconv.Itoa(i)
+	}
+	metric.MustRegisterCustomUint64Metric("/netlink/allocated_ports_by_protocol", false /* cumulative */, false /* sync */, "Number of netlink ports currently allocated to sockets, by protocol.", func(fields ...string) uint64 {
+		protocol, err := strconv.Atoi(fields[0])
+		if err != nil || protocol < 0 || protocol >= maxProtocols {
+			return 0
+		}
+		return uint64(atomic.LoadInt64(&protocolAllocatedPorts[protocol]))
+	}, metric.NewField("protocol", protocols))
+}
+
+// countAllocated adds delta to the number of ports allocated for protocol.
+func countAllocated(protocol int, delta int64) {
+	atomic.AddInt64(&allocatedPorts, delta)
+	if protocol >= 0 && protocol < maxProtocols {
+		atomic.AddInt64(&protocolAllocatedPorts[protocol], delta)
+	}
+}
+
+// Owner identifies the holder of an allocated port, usually a socket. Only the
+// Owner that allocated a port may release it. Owners are compared with ==.
+type Owner interface{}
+
+// kernelOwner owns port 0, which is reserved for the kernel.
+//
+// +stateify savable
+type kernelOwner struct{}
+
+// Range is an inclusive range of port IDs.
+//
+// +stateify savable
+type Range struct {
+	Min int32
+	Max int32
+}
+
+// Contains returns true if port is in r.
+func (r Range) Contains(port int32) bool {
+	return r.Min <= port && port <= r.Max
+}
+
+// Size returns the number of ports in r.
+func (r Range) Size() uint64 {
+	return uint64(int64(r.Max) - int64(r.Min) + 1)
+}
+
+// defaultSearchRange is the range searched by protocols without a configured
+// range.
+var defaultSearchRange = Range{Min: minSearchPort, Max: maxSearchPort}
+
+// Observer is notified of port allocations and releases.
+type Observer interface {
+	// PortAllocated is called after port is allocated for protocol in ns.
+	PortAllocated(ns *inet.Namespace, protocol int, port int32)
+
+	// PortReleased is called after port is released for protocol in ns.
+	PortReleased(ns *inet.Namespace, protocol int, port int32)
+}
+
+// protocolKey identifies the ports of a protocol in a network namespace.
+type protocolKey struct {
+	ns       *inet.Namespace
+	protocol int
+}
+
 // Manager allocates netlink port IDs.
 //
+// Port state is sharded by network namespace and protocol, so that allocations
+// for different protocols don't contend on a single lock. The state of a
+// protocol is removed once only the kernel's port remains and no range is
+// configured, so that the Manager doesn't keep network namespaces alive after
+// their last socket is gone.
+//
+// Lock order: Manager.mu -> protocolPorts.mu -> Manager.observersMu. At most
+// one protocolPorts.mu is held at a time.
+//
 // +stateify savable
 type Manager struct {
+	// mu protects protocols.
+	mu sync.RWMutex `state:"nosave"`
+
+	// protocols contains the port state for each network namespace and
+	// protocol. It is flattened into ports and ranges on save, and rebuilt
+	// from them on restore.
+	protocols map[protocolKey]*protocolPorts `state:"nosave"`
+
+	// ports contains the allocated ports and their owners for each network
+	// namespace and protocol. It is only valid during save/restore.
+	ports map[*inet.Namespace]map[int]map[int32]Owner
+
+	// ranges contains the configured port range for each network namespace
+	// and protocol. It is only valid during save/restore.
+	ranges map[*inet.Namespace]map[int]Range
+
+	// observersMu protects observers.
+	observersMu sync.RWMutex `state:"nosave"`
+
+	// observers are notified of allocations and releases. They are not
+	// saved; observers must register again after restore.
+	observers map[Observer]struct{} `state:"nosave"`
+
+	// randomSearch causes Allocate to pick a random free port when the hint
+	// is unavailable, rather than walking down the search range, so that
+	// autobound ports are not predictable.
+	randomSearch bool
+
+	// src is the source of randomness for randomSearch. It is not saved; a
+	// restored Manager uses the sandbox's secure random source.
+	src io.Reader `state:"nosave"`
+}
+
+// protocolPorts is the port state of a single protocol.
+type protocolPorts struct {
 	// mu protects the fields below.
-	mu sync.Mutex `state:"nosave"`
+	mu sync.Mutex
+
+	// ports maps allocated ports to their owners.
+	ports map[int32]Owner
+
+	// cursor is the last port handed out by the search for a free port, if
+	// hasCursor is true. The next search resumes below it.
+	cursor    int32
+	hasCursor bool
+
+	// released contains ports in the search range that have been released
+	// and can be handed out again without searching. It is only maintained
+	// by Managers without randomSearch; a random search almost never falls
+	// back to it, so it would otherwise grow with every release.
+	released map[int32]struct{}
 
-	// ports contains a map of allocated ports for each protocol.
-	ports map[int]map[int32]struct{}
+	// r is the configured port range, if limited is true. Protocols without
+	// a configured range take any hint and search defaultSearchRange, so
+	// that sockets default to their PID as in Linux.
+	r       Range
+	limited bool
+
+	// removed is true once p has been removed from Manager.protocols. A
+	// removed protocolPorts must not be modified; callers must look up the
+	// protocol's state again instead.
+	removed bool
+}
+
+func newProtocolPorts() *protocolPorts {
+	return &protocolPorts{
+		// Port 0 is reserved for the kernel.
+		ports:    map[int32]Owner{0: kernelOwner{}},
+		released: make(map[int32]struct{}),
+	}
+}
+
+// unused returns true if p holds nothing but the kernel's port 0.
+//
+// Preconditions: p.mu is held.
+func (p *protocolPorts) unused() bool {
+	return len(p.ports) <= 1 && !p.limited
+}
+
+// searchRange returns the range searched for free ports.
+//
+// Preconditions: p.mu is held.
+func (p *protocolPorts) searchRange() Range {
+	if p.limited {
+		return p.r
+	}
+	return defaultSearchRange
 }
 
 // New creates a new Manager.
 func New() *Manager {
+	return NewManagerWithSource(rand.Reader)
+}
+
+// NewManagerWithSource creates a new Manager that picks random ports using
+// src, e.g. a deterministic source in tests. Ports are only as unpredictable
+// as src; New uses the sandbox's secure random source.
+func NewManagerWithSource(src io.Reader) *Manager {
 	return &Manager{
-		ports: make(map[int]map[int32]struct{}),
+		protocols:    make(map[protocolKey]*protocolPorts),
+		observers:    make(map[Observer]struct{}),
+		randomSearch: true,
+		src:          src,
 	}
 }
 
-// Allocate reserves a new port ID for protocol. hint will be taken if
-// available.
-func (m *Manager) Allocate(protocol int, hint int32) (int32, bool) {
+// protocol returns the port state for k, creating it if necessary.
+func (m *Manager) protocol(k protocolKey) *protocolPorts {
+	m.mu.RLock()
+	p, ok := m.protocols[k]
+	m.mu.RUnlock()
+	if ok {
+		return p
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if p, ok := m.protocols[k]; ok {
+		return p
+	}
+	p = newProtocolPorts()
+	m.protocols[k] = p
+	return p
+}
 
-	proto, ok := m.ports[protocol]
-	if !ok {
-		proto = make(map[int32]struct{})
-		// Port 0 is reserved for the kernel.
-		proto[0] = struct{}{}
-		m.ports[protocol] = proto
+// lockProtocol returns the port state for k, creating it if necessary, with
+// its mu held.
+func (m *Manager) lockProtocol(k protocolKey) *protocolPorts {
+	for {
+		p := m.protocol(k)
+		p.mu.Lock()
+		if !p.removed {
+			return p
+		}
+		// p was removed after it was looked up.
+		p.mu.Unlock()
 	}
+}
 
-	if len(proto) >= maxPorts {
-		return 0, false
+// removeIfUnused removes p, the port state for k, if it is unused.
+//
+// Preconditions: p.mu is not held.
+func (m *Manager) removeIfUnused(k protocolKey, p *protocolPorts) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.removed || !p.unused() {
+		return
 	}
+	delete(m.protocols, k)
+	p.removed = true
+}
 
-	if _, ok := proto[hint]; !ok {
-		// Hint is available, reserve it.
-		proto[hint] = struct{}{}
-		return hint, true
+// RegisterObserver registers o to be notified of port allocations and
+// releases for all network namespaces and protocols. o is called with the
+// protocol's lock held, so it must not call back into the Manager.
+func (m *Manager) RegisterObserver(o Observer) {
+	m.observersMu.Lock()
+	defer m.observersMu.Unlock()
+	m.observers[o] = struct{}{}
+}
+
+// UnregisterObserver stops notifications to o.
+func (m *Manager) UnregisterObserver(o Observer) {
+	m.observersMu.Lock()
+	defer m.observersMu.Unlock()
+	delete(m.observers, o)
+}
+
+// notify calls fn for each registered observer.
+func (m *Manager) notify(fn func(Observer)) {
+	m.observersMu.RLock()
+	defer m.observersMu.RUnlock()
+	for o := range m.observers {
+		fn(o)
+	}
+}
+
+// ProtocolStats describes the port utilization of a protocol in a network
+// namespace.
+type ProtocolStats struct {
+	// Namespace is the network namespace.
+	Namespace *inet.Namespace
+
+	// Protocol is the netlink protocol.
+	Protocol int
+
+	// Allocated is the number of ports allocated to sockets. The kernel's
+	// port 0 is not counted.
+	Allocated int
+
+	// RangeSize is the number of ports in the range searched by Allocate.
+	RangeSize uint64
+}
+
+// Stats returns the port utilization of each protocol in each network namespace
+// for which ports are allocated or a range is configured. Each protocol is
+// read under its own lock, so each entry is consistent, but allocations and
+// releases for other protocols may happen while the result is taken.
+func (m *Manager) Stats() []ProtocolStats {
+	m.mu.RLock()
+	protocols := make(map[protocolKey]*protocolPorts, len(m.protocols))
+	for k, p := range m.protocols {
+		protocols[k] = p
+	}
+	m.mu.RUnlock()
+
+	stats := make([]ProtocolStats, 0, len(protocols))
+	for k, p := range protocols {
+		p.mu.Lock()
+		if p.removed {
+			p.mu.Unlock()
+			continue
+		}
+		allocated := len(p.ports)
+		if _, ok := p.ports[0]; ok {
+			allocated--
+		}
+		rangeSize := p.searchRange().Size()
+		p.mu.Unlock()
+		stats = append(stats, ProtocolStats{
+			Namespace: k.ns,
+			Protocol:  k.protocol,
+			Allocated: allocated,
+			RangeSize: rangeSize,
+		})
+	}
+	return stats
+}
+
+// SetRange limits the ports handed out by Allocate for protocol in ns to r.
+// Hints outside of r are ignored, and Allocate fails once all ports in r are
+// taken. Ports that are already allocated are unaffected.
+func (m *Manager) SetRange(ns *inet.Namespace, protocol int, r Range) error {
+	if r.Min > r.Max {
+		return syserror.EINVAL
+	}
+
+	p := m.lockProtocol(protocolKey{ns, protocol})
+	defer p.mu.Unlock()
+	p.r = r
+	p.limited = true
+	return nil
+}
+
+// Reserve claims exactly port for protocol in ns. Unlike Allocate, it never falls
+// back to another port: if port is already allocated, Reserve returns
+// EADDRINUSE. Reserve is not limited by the protocol's configured range.
+// Reserved ports are freed with Release.
+func (m *Manager) Reserve(ns *inet.Namespace, protocol int, port int32, owner Owner) (int32, error) {
+	return m.AllocateWith(ns, protocol, port, false /* fallbackRandom */, owner)
+}
+
+// take marks port as allocated to owner in p, the port state for k.
+//
+// Preconditions: p.mu is held. port is not allocated.
+func (m *Manager) take(k protocolKey, p *protocolPorts, port int32, owner Owner) {
+	p.ports[port] = owner
+	delete(p.released, port)
+	countAllocated(k.protocol, 1)
+	m.notify(func(o Observer) { o.PortAllocated(k.ns, k.protocol, port) })
+}
+
+// Allocate reserves a new port ID for protocol in ns on behalf of owner. hint will be
+// taken if available and within the protocol's configured range, if any.
+// Otherwise, a random free port in the search range is chosen, falling back to
+// a linear scan if the range is too densely allocated to find one quickly.
+// Callers that need a fixed port should use Reserve instead.
+func (m *Manager) Allocate(ns *inet.Namespace, protocol int, hint int32, owner Owner) (int32, bool) {
+	port, err := m.AllocateWith(ns, protocol, hint, true /* fallbackRandom */, owner)
+	return port, err == nil
+}
+
+// AllocateWith allocates preferred for protocol in ns on behalf of owner, and
+// returns the port allocated.
+//
+// If fallbackRandom is false, AllocateWith claims exactly preferred, as
+// Reserve does, and fails with EADDRINUSE if it is taken. Otherwise, preferred
+// is only taken if it is also within the protocol's configured range, and a
+// free port is searched for as described for Allocate if it isn't; EADDRINUSE
+// is returned if no port is free.
+func (m *Manager) AllocateWith(ns *inet.Namespace, protocol int, preferred int32, fallbackRandom bool, owner Owner) (int32, error) {
+	if !fallbackRandom && preferred == 0 {
+		// Port 0 always belongs to the kernel. Fail before looking up the
+		// protocol, which would otherwise be left without any sockets.
+		return 0, syserror.EADDRINUSE
+	}
+
+	k := protocolKey{ns, protocol}
+	p := m.lockProtocol(k)
+	defer p.mu.Unlock()
+
+	if len(p.ports) >= maxPorts {
+		return 0, syserror.EADDRINUSE
+	}
+
+	_, taken := p.ports[preferred]
+	if !fallbackRandom {
+		if taken {
+			return 0, syserror.EADDRINUSE
+		}
+		m.take(k, p, preferred, owner)
+		return preferred, nil
 	}
 
-	// Search for any free port in [math.MinInt32, -4096). The positive
-	// port space is left open for pid-based allocations. This behavior is
-	// consistent with Linux.
-	start := int32(math.MinInt32 + rand.Int63n(math.MaxInt32-4096+1))
+	if !taken && (!p.limited || p.r.Contains(preferred)) {
+		// Preferred is available, reserve it.
+		m.take(k, p, preferred, owner)
+		return preferred, nil
+	}
+	if port, ok := m.search(k, p, owner); ok {
+		return port, nil
+	}
+	return 0, syserror.EADDRINUSE
+}
+
+// search allocates a free port in p's search range to owner, and returns it.
+//
+// Preconditions: p.mu is held. p has fewer than maxPorts allocated ports.
+func (m *Manager) search(k protocolKey, p *protocolPorts, owner Owner) (int32, bool) {
+	sr := p.searchRange()
+	if m.randomSearch {
+		for i := 0; i < randomProbes; i++ {
+			port, err := m.randomPort(sr)
+			if err != nil {
+				// Fall back to the deterministic search.
+				break
+			}
+			if _, ok := p.ports[port]; !ok {
+				m.take(k, p, port, owner)
+				return port, true
+			}
+		}
+	}
+
+	// Reuse a released port if there is one.
+	for port := range p.released {
+		if !sr.Contains(port) {
+			// The range changed since port was released.
+			delete(p.released, port)
+			continue
+		}
+		m.take(k, p, port, owner)
+		return port, true
+	}
+
+	// Search for any free port in sr, resuming after the last port found by
+	// a search and wrapping around at the bottom of the range. Since the
+	// cursor only moves forward, each search usually succeeds immediately.
+	start := p.cursor
+	if !p.hasCursor || !sr.Contains(start) {
+		start = sr.Min
+	}
 	curr := start
 	for {
-		if _, ok := proto[curr]; !ok {
-			proto[curr] = struct{}{}
-			return curr, true
+		if curr == sr.Min {
+			curr = sr.Max
+		} else {
+			curr--
 		}
-
-		curr--
-		if curr >= -4096 {
-			curr = -4097
+		if _, ok := p.ports[curr]; !ok {
+			m.take(k, p, curr, owner)
+			p.cursor = curr
+			p.hasCursor = true
+			return curr, true
 		}
 		if curr == start {
-			// Nothing found. We should always find a free port
-			// because maxPorts < -4096 - MinInt32.
-			panic(fmt.Sprintf("No free port found in %+v", proto))
+			// Nothing found. This is only possible with a
+			// configured range, since maxPorts is smaller than
+			// defaultSearchRange.
+			if !p.limited {
+				panic(fmt.Sprintf("No free port found in %+v", p.ports))
+			}
+			return 0, false
 		}
 	}
 }
 
-// Release frees the specified port for protocol.
-//
-// Preconditions: port is already allocated.
-func (m *Manager) Release(protocol int, port int32) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// randomPort returns a random port in r, using m.src.
+func (m *Manager) randomPort(r Range) (int32, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(m.src, b[:]); err != nil {
+		return 0, err
+	}
+	// The modulo bias is negligible for a 64-bit random value.
+	return int32(int64(r.Min) + int64(binary.LittleEndian.Uint64(b[:])%r.Size())), nil
+}
 
-	proto, ok := m.ports[protocol]
+// Release frees the specified port for protocol in ns, whether it was obtained
+// with Allocate or Reserve.
+//
+// Preconditions: port is allocated to owner. Releasing a port twice, or a
+// port held by another owner, panics: the second release could otherwise free
+// a port that has since been handed to a different socket.
+func (m *Manager) Release(ns *inet.Namespace, protocol int, port int32, owner Owner) {
+	k := protocolKey{ns, protocol}
+	m.mu.RLock()
+	p, ok := m.protocols[k]
+	m.mu.RUnlock()
 	if !ok {
 		panic(fmt.Sprintf("Released port %d for protocol %d which has no allocations", port, protocol))
 	}
 
-	if _, ok := proto[port]; !ok {
+	p.mu.Lock()
+	holder, ok := p.ports[port]
+	if !ok {
+		p.mu.Unlock()
 		panic(fmt.Sprintf("Released port %d for protocol %d is not allocated", port, protocol))
 	}
+	if holder != owner {
+		p.mu.Unlock()
+		panic(fmt.Sprintf("Released port %d for protocol %d is held by a different owner (%T)", port, protocol, holder))
+	}
+	m.release(k, p, port)
+	unused := p.unused()
+	p.mu.Unlock()
+
+	if unused {
+		m.removeIfUnused(k, p)
+	}
+}
+
+// release marks port as free in p, the port state for k.
+//
+// Preconditions: p.mu is held. port is allocated.
+func (m *Manager) release(k protocolKey, p *protocolPorts, port int32) {
+	delete(p.ports, port)
+	if !m.randomSearch && p.searchRange().Contains(port) {
+		p.released[port] = struct{}{}
+	}
+	countAllocated(k.protocol, -1)
+	m.notify(func(o Observer) { o.PortReleased(k.ns, k.protocol, port) })
+}
+
+// ReapOrphans releases every allocated port for which alive returns false and
+// returns the number of ports released. It recovers ports leaked by sockets
+// that were destroyed without calling Release.
+//
+// alive is called with the protocol's lock held, so it must not call back into
+// the Manager.
+func (m *Manager) ReapOrphans(alive func(ns *inet.Namespace, protocol int, port int32) bool) int {
+	m.mu.RLock()
+	protocols := make(map[protocolKey]*protocolPorts, len(m.protocols))
+	for k, p := range m.protocols {
+		protocols[k] = p
+	}
+	m.mu.RUnlock()
 
-	delete(proto, port)
+	reaped := 0
+	for k, p := range protocols {
+		p.mu.Lock()
+		for port := range p.ports {
+			// Port 0 belongs to the kernel, not to a socket.
+			if port == 0 || alive(k.ns, k.protocol, port) {
+				continue
+			}
+			m.release(k, p, port)
+			reaped++
+		}
+		unused := p.unused()
+		p.mu.Unlock()
+
+		if unused {
+			m.removeIfUnused(k, p)
+		}
+	}
+	reapedPorts.IncrementBy(uint64(reaped))
+	return reaped
 }
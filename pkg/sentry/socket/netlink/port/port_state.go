@@ -0,0 +1,96 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package port
+
+import (
+	"gvisor.dev/gvisor/pkg/rand"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+)
+
+// beforeSave is invoked by stateify.
+func (m *Manager) beforeSave() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	m.ports = make(map[*inet.Namespace]map[int]map[int32]Owner)
+	m.ranges = make(map[*inet.Namespace]map[int]Range)
+	for k, p := range m.protocols {
+		p.mu.Lock()
+		ports := make(map[int32]Owner, len(p.ports))
+		for port, owner := range p.ports {
+			ports[port] = owner
+		}
+		if m.ports[k.ns] == nil {
+			m.ports[k.ns] = make(map[int]map[int32]Owner)
+		}
+		m.ports[k.ns][k.protocol] = ports
+		if p.limited {
+			if m.ranges[k.ns] == nil {
+				m.ranges[k.ns] = make(map[int]Range)
+			}
+			m.ranges[k.ns][k.protocol] = p.r
+		}
+		p.mu.Unlock()
+	}
+}
+
+// afterLoad is invoked by stateify.
+func (m *Manager) afterLoad() {
+	m.protocols = make(map[protocolKey]*protocolPorts)
+	m.observers = make(map[Observer]struct{})
+	m.src = rand.Reader
+	for ns, protocols := range m.ports {
+		for protocol, ports := range protocols {
+			p := newProtocolPorts()
+			p.ports = ports
+			m.protocols[protocolKey{ns, protocol}] = p
+			for port := range ports {
+				if port != 0 {
+					countAllocated(protocol, 1)
+				}
+			}
+		}
+	}
+	for ns, ranges := range m.ranges {
+		for protocol, r := range ranges {
+			k := protocolKey{ns, protocol}
+			p, ok := m.protocols[k]
+			if !ok {
+				p = newProtocolPorts()
+				m.protocols[k] = p
+			}
+			p.r = r
+			p.limited = true
+		}
+	}
+	m.ports = nil
+	m.ranges = nil
+
+	// Resume searches after the lowest port found by a search before save.
+	// Released ports are not tracked across save/restore; the search will
+	// find them again once it wraps around.
+	for _, p := range m.protocols {
+		sr := p.searchRange()
+		for port := range p.ports {
+			if !sr.Contains(port) {
+				continue
+			}
+			if !p.hasCursor || port < p.cursor {
+				p.cursor = port
+				p.hasCursor = true
+			}
+		}
+	}
+}
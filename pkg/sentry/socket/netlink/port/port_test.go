@@ -15,14 +15,37 @@
 package port
 
 import (
+	"encoding/binary"
+	"io"
+	"reflect"
+	"sort"
+	"sync/atomic"
 	"testing"
+
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserror"
 )
 
+// testOwner owns the ports allocated by tests that don't care about ownership.
+var testOwner = new(int)
+
+// testNS is the network namespace of tests that don't care about namespaces.
+var testNS = inet.NewRootNamespace(nil, nil)
+
+// newSequential returns a Manager that searches for free ports linearly, so
+// that tests can predict the ports it hands out.
+func newSequential() *Manager {
+	m := New()
+	m.randomSearch = false
+	return m
+}
+
 func TestAllocateHint(t *testing.T) {
 	m := New()
 
 	// We can get the hint port.
-	p, ok := m.Allocate(0, 1)
+	p, ok := m.Allocate(testNS, 0, 1, testOwner)
 	if !ok {
 		t.Errorf("m.Allocate got !ok want ok")
 	}
@@ -31,7 +54,7 @@ func TestAllocateHint(t *testing.T) {
 	}
 
 	// Hint is taken.
-	p, ok = m.Allocate(0, 1)
+	p, ok = m.Allocate(testNS, 0, 1, testOwner)
 	if !ok {
 		t.Errorf("m.Allocate got !ok want ok")
 	}
@@ -40,7 +63,7 @@ func TestAllocateHint(t *testing.T) {
 	}
 
 	// Hint is available for a different protocol.
-	p, ok = m.Allocate(1, 1)
+	p, ok = m.Allocate(testNS, 1, 1, testOwner)
 	if !ok {
 		t.Errorf("m.Allocate got !ok want ok")
 	}
@@ -48,10 +71,10 @@ func TestAllocateHint(t *testing.T) {
 		t.Errorf("m.Allocate(1, 1) got %d want 1", p)
 	}
 
-	m.Release(0, 1)
+	m.Release(testNS, 0, 1, testOwner)
 
 	// Hint is available again after release.
-	p, ok = m.Allocate(0, 1)
+	p, ok = m.Allocate(testNS, 0, 1, testOwner)
 	if !ok {
 		t.Errorf("m.Allocate got !ok want ok")
 	}
@@ -65,7 +88,7 @@ func TestAllocateExhausted(t *testing.T) {
 
 	// Fill all ports (0 is already reserved).
 	for i := int32(1); i < maxPorts; i++ {
-		p, ok := m.Allocate(0, i)
+		p, ok := m.Allocate(testNS, 0, i, testOwner)
 		if !ok {
 			t.Fatalf("m.Allocate got !ok want ok")
 		}
@@ -75,8 +98,770 @@ func TestAllocateExhausted(t *testing.T) {
 	}
 
 	// Now no more can be allocated.
-	p, ok := m.Allocate(0, 1)
+	p, ok := m.Allocate(testNS, 0, 1, testOwner)
 	if ok {
 		t.Errorf("m.Allocate got %d, ok want !ok", p)
 	}
 }
+
+func TestReserve(t *testing.T) {
+	m := New()
+
+	// A free port can be reserved.
+	p, err := m.Reserve(testNS, 0, 1, testOwner)
+	if err != nil {
+		t.Fatalf("m.Reserve(0, 1) got err %v want nil", err)
+	}
+	if p != 1 {
+		t.Errorf("m.Reserve(0, 1) got %d want 1", p)
+	}
+
+	// It can't be reserved twice.
+	if _, err := m.Reserve(testNS, 0, 1, testOwner); err != syserror.EADDRINUSE {
+		t.Errorf("m.Reserve(0, 1) got err %v want %v", err, syserror.EADDRINUSE)
+	}
+
+	// Port 0 belongs to the kernel.
+	if _, err := m.Reserve(testNS, 0, 0, testOwner); err != syserror.EADDRINUSE {
+		t.Errorf("m.Reserve(0, 0) got err %v want %v", err, syserror.EADDRINUSE)
+	}
+
+	// Allocate doesn't hand out a reserved port.
+	if p, ok := m.Allocate(testNS, 0, 1, testOwner); !ok || p == 1 {
+		t.Errorf("m.Allocate(0, 1) got %d, %t want anything else, true", p, ok)
+	}
+
+	// Release makes it available again.
+	m.Release(testNS, 0, 1, testOwner)
+	if _, err := m.Reserve(testNS, 0, 1, testOwner); err != nil {
+		t.Errorf("m.Reserve(0, 1) after release got err %v want nil", err)
+	}
+}
+
+func TestAllocateWith(t *testing.T) {
+	for _, fallbackRandom := range []bool{false, true} {
+		m := New()
+
+		// A free preferred port is taken.
+		p, err := m.AllocateWith(testNS, 0, 1, fallbackRandom, testOwner)
+		if err != nil {
+			t.Fatalf("m.AllocateWith(0, 1, %t) got err %v want nil", fallbackRandom, err)
+		}
+		if p != 1 {
+			t.Errorf("m.AllocateWith(0, 1, %t) got %d want 1", fallbackRandom, p)
+		}
+
+		// A taken preferred port fails, or falls back to another port.
+		p, err = m.AllocateWith(testNS, 0, 1, fallbackRandom, testOwner)
+		if !fallbackRandom {
+			if err != syserror.EADDRINUSE {
+				t.Errorf("m.AllocateWith(0, 1, false) got %d, err %v want err %v", p, err, syserror.EADDRINUSE)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("m.AllocateWith(0, 1, true) got err %v want nil", err)
+		}
+		if p == 1 || p == 0 {
+			t.Errorf("m.AllocateWith(0, 1, true) got %d want anything but 0 or 1", p)
+		}
+	}
+}
+
+func TestAllocateWithExhausted(t *testing.T) {
+	for _, fallbackRandom := range []bool{false, true} {
+		m := newSequential()
+		if err := m.SetRange(testNS, 0, Range{Min: -2, Max: -1}); err != nil {
+			t.Fatalf("m.SetRange failed: %v", err)
+		}
+		for _, port := range []int32{-1, -2} {
+			if _, err := m.Reserve(testNS, 0, port, testOwner); err != nil {
+				t.Fatalf("m.Reserve(0, %d) got err %v want nil", port, err)
+			}
+		}
+
+		// With the range full, a free preferred port is only taken if the
+		// range doesn't apply, and there is nothing to fall back to.
+		p, err := m.AllocateWith(testNS, 0, 1, fallbackRandom, testOwner)
+		if fallbackRandom {
+			if err != syserror.EADDRINUSE {
+				t.Errorf("m.AllocateWith(0, 1, true) got %d, err %v want err %v", p, err, syserror.EADDRINUSE)
+			}
+		} else if err != nil || p != 1 {
+			t.Errorf("m.AllocateWith(0, 1, false) got %d, err %v want 1, nil", p, err)
+		}
+		if p, err := m.AllocateWith(testNS, 0, -1, fallbackRandom, testOwner); err != syserror.EADDRINUSE {
+			t.Errorf("m.AllocateWith(0, -1, %t) got %d, err %v want err %v", fallbackRandom, p, err, syserror.EADDRINUSE)
+		}
+	}
+}
+
+func TestAllocateSearch(t *testing.T) {
+	m := newSequential()
+
+	// Take the hint so that subsequent allocations must search.
+	if _, ok := m.Allocate(testNS, 0, 1, testOwner); !ok {
+		t.Fatalf("m.Allocate got !ok want ok")
+	}
+
+	// Searches walk down from the top of the search range.
+	for want := int32(maxSearchPort); want > maxSearchPort-10; want-- {
+		p, ok := m.Allocate(testNS, 0, 1, testOwner)
+		if !ok {
+			t.Fatalf("m.Allocate got !ok want ok")
+		}
+		if p != want {
+			t.Fatalf("m.Allocate(0, 1) got %d want %d", p, want)
+		}
+	}
+
+	// Released ports are handed out again before searching further.
+	m.Release(testNS, 0, maxSearchPort-3, testOwner)
+	if p, _ := m.Allocate(testNS, 0, 1, testOwner); p != maxSearchPort-3 {
+		t.Errorf("m.Allocate(0, 1) got %d want %d", p, maxSearchPort-3)
+	}
+	if p, _ := m.Allocate(testNS, 0, 1, testOwner); p != maxSearchPort-10 {
+		t.Errorf("m.Allocate(0, 1) got %d want %d", p, maxSearchPort-10)
+	}
+
+	// A released port taken by its hint is no longer reused.
+	m.Release(testNS, 0, maxSearchPort, testOwner)
+	if p, _ := m.Allocate(testNS, 0, maxSearchPort, testOwner); p != maxSearchPort {
+		t.Errorf("m.Allocate(0, %d) got %d want %d", maxSearchPort, p, maxSearchPort)
+	}
+	if p, _ := m.Allocate(testNS, 0, 1, testOwner); p != maxSearchPort-11 {
+		t.Errorf("m.Allocate(0, 1) got %d want %d", p, maxSearchPort-11)
+	}
+}
+
+func TestAllocateSearchWraps(t *testing.T) {
+	m := newSequential()
+	m.Allocate(testNS, 0, 1, testOwner)
+	p := m.protocol(protocolKey{testNS, 0})
+	p.cursor = minSearchPort + 1
+	p.hasCursor = true
+
+	for _, want := range []int32{minSearchPort, maxSearchPort} {
+		p, ok := m.Allocate(testNS, 0, 1, testOwner)
+		if !ok {
+			t.Fatalf("m.Allocate got !ok want ok")
+		}
+		if p != want {
+			t.Errorf("m.Allocate(0, 1) got %d want %d", p, want)
+		}
+	}
+}
+
+func TestAfterLoad(t *testing.T) {
+	m := newSequential()
+	m.Allocate(testNS, 0, 1, testOwner)
+	for i := 0; i < 5; i++ {
+		m.Allocate(testNS, 0, 1, testOwner)
+	}
+	m.Release(testNS, 0, maxSearchPort-1, testOwner)
+
+	// Simulate a save/restore, which loses the nosave fields.
+	m.beforeSave()
+	m.protocols = nil
+	m.afterLoad()
+
+	if p, _ := m.Allocate(testNS, 0, 1, testOwner); p != maxSearchPort-5 {
+		t.Errorf("m.Allocate(0, 1) after load got %d want %d", p, maxSearchPort-5)
+	}
+}
+
+func TestAllocateRandom(t *testing.T) {
+	m := New()
+
+	// Take the hint so that subsequent allocations must search.
+	if _, ok := m.Allocate(testNS, 0, 1, testOwner); !ok {
+		t.Fatalf("m.Allocate got !ok want ok")
+	}
+
+	const n = 100
+	ports := make([]int32, 0, n)
+	for i := 0; i < n; i++ {
+		p, ok := m.Allocate(testNS, 0, 1, testOwner)
+		if !ok {
+			t.Fatalf("m.Allocate got !ok want ok")
+		}
+		if !defaultSearchRange.Contains(p) {
+			t.Fatalf("m.Allocate(0, 1) got %d want in %+v", p, defaultSearchRange)
+		}
+		ports = append(ports, p)
+	}
+
+	// A linear search hands out monotonic ports. n random ports are
+	// monotonic with probability 2/n!.
+	increasing, decreasing := true, true
+	for i := 1; i < len(ports); i++ {
+		if ports[i] <= ports[i-1] {
+			increasing = false
+		}
+		if ports[i] >= ports[i-1] {
+			decreasing = false
+		}
+	}
+	if increasing || decreasing {
+		t.Errorf("m.Allocate(0, 1) got monotonic ports %v", ports)
+	}
+}
+
+// TestReleasedBounded checks that allocating and releasing ports repeatedly
+// doesn't grow the set of released ports.
+func TestReleasedBounded(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		m    *Manager
+		max  int
+	}{
+		{
+			// Random searches don't track released ports.
+			name: "random",
+			m:    New(),
+			max:  0,
+		},
+		{
+			// Sequential searches reuse the released port.
+			name: "sequential",
+			m:    newSequential(),
+			max:  1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := tc.m
+			// Take the hint so that subsequent allocations must search.
+			if _, ok := m.Allocate(testNS, 0, 1, testOwner); !ok {
+				t.Fatalf("m.Allocate got !ok want ok")
+			}
+			pp := m.protocol(protocolKey{testNS, 0})
+			for i := 0; i < 1000; i++ {
+				p, ok := m.Allocate(testNS, 0, 1, testOwner)
+				if !ok {
+					t.Fatalf("m.Allocate got !ok want ok")
+				}
+				m.Release(testNS, 0, p, testOwner)
+			}
+			pp.mu.Lock()
+			defer pp.mu.Unlock()
+			if got := len(pp.released); got > tc.max {
+				t.Errorf("len(released) after churn got %d want <= %d", got, tc.max)
+			}
+		})
+	}
+}
+
+// uint64Source is a deterministic random source that produces the little
+// endian encodings of values, followed by io.EOF.
+type uint64Source struct {
+	values []uint64
+}
+
+// Read implements io.Reader.Read.
+func (s *uint64Source) Read(b []byte) (int, error) {
+	if len(s.values) == 0 {
+		return 0, io.EOF
+	}
+	var v [8]byte
+	binary.LittleEndian.PutUint64(v[:], s.values[0])
+	s.values = s.values[1:]
+	return copy(b, v[:]), nil
+}
+
+func TestAllocateWithSource(t *testing.T) {
+	m := NewManagerWithSource(&uint64Source{values: []uint64{3, 13, 3, 7}})
+	if err := m.SetRange(testNS, 0, Range{Min: 100, Max: 109}); err != nil {
+		t.Fatalf("m.SetRange failed: %v", err)
+	}
+
+	// The hint is out of range, so each allocation picks random ports until
+	// one is free: 103, then 103 twice more before 107.
+	var ports []int32
+	for i := 0; i < 2; i++ {
+		p, ok := m.Allocate(testNS, 0, 1, testOwner)
+		if !ok {
+			t.Fatalf("m.Allocate got !ok want ok")
+		}
+		ports = append(ports, p)
+	}
+	if want := []int32{103, 107}; !reflect.DeepEqual(ports, want) {
+		t.Errorf("m.Allocate got ports %v want %v", ports, want)
+	}
+
+	// Once the source fails, Allocate falls back to searching.
+	p, ok := m.Allocate(testNS, 0, 1, testOwner)
+	if !ok {
+		t.Fatalf("m.Allocate got !ok want ok")
+	}
+	if p == 103 || p == 107 || !(Range{Min: 100, Max: 109}).Contains(p) {
+		t.Errorf("m.Allocate got port %d, want a free port in [100, 109]", p)
+	}
+}
+
+func TestAllocateNamespaces(t *testing.T) {
+	m := New()
+	otherNS := inet.NewNamespace(testNS)
+
+	// The same port can be allocated in each namespace.
+	for _, ns := range []*inet.Namespace{testNS, otherNS} {
+		if p, ok := m.Allocate(ns, 0, 1, testOwner); !ok || p != 1 {
+			t.Errorf("m.Allocate(0, 1) got %d, %t want 1, true", p, ok)
+		}
+		if _, err := m.Reserve(ns, 0, 2, testOwner); err != nil {
+			t.Errorf("m.Reserve(0, 2) got err %v want nil", err)
+		}
+	}
+
+	// Releasing a port in one namespace leaves the other's allocated.
+	m.Release(testNS, 0, 1, testOwner)
+	if p, ok := m.Allocate(testNS, 0, 1, testOwner); !ok || p != 1 {
+		t.Errorf("m.Allocate(0, 1) after release got %d, %t want 1, true", p, ok)
+	}
+	if _, err := m.Reserve(otherNS, 0, 1, testOwner); err != syserror.EADDRINUSE {
+		t.Errorf("m.Reserve(0, 1) in other namespace got err %v want %v", err, syserror.EADDRINUSE)
+	}
+
+	// Orphans are reaped per namespace.
+	n := m.ReapOrphans(func(ns *inet.Namespace, protocol int, port int32) bool {
+		return ns == testNS
+	})
+	if n != 2 {
+		t.Errorf("m.ReapOrphans got %d want 2", n)
+	}
+	if _, err := m.Reserve(testNS, 0, 2, testOwner); err != syserror.EADDRINUSE {
+		t.Errorf("m.Reserve(0, 2) got err %v want %v", err, syserror.EADDRINUSE)
+	}
+	if _, err := m.Reserve(otherNS, 0, 2, testOwner); err != nil {
+		t.Errorf("m.Reserve(0, 2) in other namespace got err %v want nil", err)
+	}
+}
+
+// hasNamespace returns true if m has port state for ns.
+func (m *Manager) hasNamespace(ns *inet.Namespace) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for k := range m.protocols {
+		if k.ns == ns {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNamespaceRemoved(t *testing.T) {
+	m := New()
+
+	// A namespace's state is dropped once its last socket releases its port.
+	released := inet.NewNamespace(testNS)
+	p, ok := m.Allocate(released, 0, 1, testOwner)
+	if !ok {
+		t.Fatalf("m.Allocate got !ok want ok")
+	}
+	m.Release(released, 0, p, testOwner)
+
+	// Orphans are dropped in the same way.
+	reaped := inet.NewNamespace(testNS)
+	if _, ok := m.Allocate(reaped, 0, 1, testOwner); !ok {
+		t.Fatalf("m.Allocate got !ok want ok")
+	}
+	m.ReapOrphans(func(ns *inet.Namespace, _ int, _ int32) bool {
+		return ns != reaped
+	})
+
+	// A configured range is kept even without any sockets.
+	limited := inet.NewNamespace(testNS)
+	if err := m.SetRange(limited, 0, Range{Min: 10, Max: 19}); err != nil {
+		t.Fatalf("m.SetRange got err %v want nil", err)
+	}
+
+	for _, s := range m.Stats() {
+		if s.Namespace == released || s.Namespace == reaped {
+			t.Errorf("m.Stats got %+v for a namespace without sockets", s)
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		ns   *inet.Namespace
+		want bool
+	}{
+		{"released", released, false},
+		{"reaped", reaped, false},
+		{"limited", limited, true},
+	} {
+		if got := m.hasNamespace(tc.ns); got != tc.want {
+			t.Errorf("m.hasNamespace(%s) got %t want %t", tc.name, got, tc.want)
+		}
+	}
+
+	// Ports can be allocated again after the state is dropped.
+	if p, ok := m.Allocate(released, 0, 1, testOwner); !ok || p != 1 {
+		t.Errorf("m.Allocate(0, 1) got %d, %t want 1, true", p, ok)
+	}
+}
+
+// TestNamespaceRemovedConcurrent checks that ports allocated while a protocol's
+// state is being removed are not lost.
+func TestNamespaceRemovedConcurrent(t *testing.T) {
+	const goroutines = 4
+	m := New()
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(hint int32) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				p, ok := m.Allocate(testNS, 0, hint, testOwner)
+				if !ok {
+					t.Errorf("m.Allocate got !ok want ok")
+					return
+				}
+				// Release panics if p was allocated in removed state.
+				m.Release(testNS, 0, p, testOwner)
+			}
+		}(int32(i + 1))
+	}
+	wg.Wait()
+
+	if m.hasNamespace(testNS) {
+		t.Errorf("m.hasNamespace got true after all ports were released")
+	}
+}
+
+func TestAllocateRange(t *testing.T) {
+	m := New()
+	if err := m.SetRange(testNS, 0, Range{Min: 10, Max: 12}); err != nil {
+		t.Fatalf("m.SetRange got err %v want nil", err)
+	}
+
+	// A hint outside of the range is ignored.
+	p, ok := m.Allocate(testNS, 0, 100, testOwner)
+	if !ok {
+		t.Fatalf("m.Allocate got !ok want ok")
+	}
+	if p < 10 || p > 12 {
+		t.Errorf("m.Allocate(0, 100) got %d want in [10, 12]", p)
+	}
+
+	// The rest of the range can be allocated, after which allocation fails.
+	for i := 0; i < 2; i++ {
+		if p, ok := m.Allocate(testNS, 0, 100, testOwner); !ok || p < 10 || p > 12 {
+			t.Errorf("m.Allocate(0, 100) got %d, %t want in [10, 12], true", p, ok)
+		}
+	}
+	if p, ok := m.Allocate(testNS, 0, 100, testOwner); ok {
+		t.Errorf("m.Allocate(0, 100) got %d, ok want !ok", p)
+	}
+
+	// Released ports become available again.
+	m.Release(testNS, 0, 11, testOwner)
+	if p, ok := m.Allocate(testNS, 0, 100, testOwner); !ok || p != 11 {
+		t.Errorf("m.Allocate(0, 100) got %d, %t want 11, true", p, ok)
+	}
+
+	// Other protocols are unaffected.
+	if p, ok := m.Allocate(testNS, 1, 100, testOwner); !ok || p != 100 {
+		t.Errorf("m.Allocate(1, 100) got %d, %t want 100, true", p, ok)
+	}
+}
+
+func TestSetRangeInvalid(t *testing.T) {
+	m := New()
+	if err := m.SetRange(testNS, 0, Range{Min: 2, Max: 1}); err != syserror.EINVAL {
+		t.Errorf("m.SetRange got err %v want %v", err, syserror.EINVAL)
+	}
+}
+
+func TestReapOrphans(t *testing.T) {
+	m := New()
+	m.Allocate(testNS, 0, 1, testOwner)
+	m.Allocate(testNS, 0, 2, testOwner)
+	m.Allocate(testNS, 1, 1, testOwner)
+
+	// Only port 2 of protocol 0 still has a socket.
+	var checked []int32
+	n := m.ReapOrphans(func(_ *inet.Namespace, protocol int, port int32) bool {
+		checked = append(checked, port)
+		return protocol == 0 && port == 2
+	})
+	if n != 2 {
+		t.Errorf("m.ReapOrphans got %d want 2", n)
+	}
+	for _, port := range checked {
+		if port == 0 {
+			t.Errorf("m.ReapOrphans checked the kernel's port 0")
+		}
+	}
+
+	// Reaped ports can be allocated again, live ones can't.
+	if p, ok := m.Allocate(testNS, 0, 1, testOwner); !ok || p != 1 {
+		t.Errorf("m.Allocate(0, 1) got %d, %t want 1, true", p, ok)
+	}
+	if p, ok := m.Allocate(testNS, 1, 1, testOwner); !ok || p != 1 {
+		t.Errorf("m.Allocate(1, 1) got %d, %t want 1, true", p, ok)
+	}
+	if p, _ := m.Allocate(testNS, 0, 2, testOwner); p == 2 {
+		t.Errorf("m.Allocate(0, 2) got 2 want anything else")
+	}
+}
+
+type portEvent struct {
+	allocated bool
+	protocol  int
+	port      int32
+}
+
+type recordingObserver struct {
+	events []portEvent
+}
+
+func (o *recordingObserver) PortAllocated(_ *inet.Namespace, protocol int, port int32) {
+	o.events = append(o.events, portEvent{true, protocol, port})
+}
+
+func (o *recordingObserver) PortReleased(_ *inet.Namespace, protocol int, port int32) {
+	o.events = append(o.events, portEvent{false, protocol, port})
+}
+
+func TestObserver(t *testing.T) {
+	m := New()
+	o := &recordingObserver{}
+	m.RegisterObserver(o)
+
+	m.Allocate(testNS, 0, 1, testOwner)
+	m.Reserve(testNS, 1, 2, testOwner)
+	m.Release(testNS, 0, 1, testOwner)
+
+	m.UnregisterObserver(o)
+	m.Allocate(testNS, 0, 3, testOwner)
+
+	want := []portEvent{
+		{true, 0, 1},
+		{true, 1, 2},
+		{false, 0, 1},
+	}
+	if len(o.events) != len(want) {
+		t.Fatalf("got events %+v want %+v", o.events, want)
+	}
+	for i := range want {
+		if o.events[i] != want[i] {
+			t.Errorf("event %d got %+v want %+v", i, o.events[i], want[i])
+		}
+	}
+}
+
+func TestSaveRestoreRange(t *testing.T) {
+	m := New()
+	if err := m.SetRange(testNS, 0, Range{Min: 10, Max: 11}); err != nil {
+		t.Fatalf("m.SetRange got err %v want nil", err)
+	}
+	m.Allocate(testNS, 0, 10, testOwner)
+
+	m.beforeSave()
+	m.protocols = nil
+	m.afterLoad()
+
+	// The allocated port and the range both survive.
+	if p, ok := m.Allocate(testNS, 0, 100, testOwner); !ok || p != 11 {
+		t.Errorf("m.Allocate(0, 100) got %d, %t want 11, true", p, ok)
+	}
+	if p, ok := m.Allocate(testNS, 0, 100, testOwner); ok {
+		t.Errorf("m.Allocate(0, 100) got %d, ok want !ok", p)
+	}
+}
+
+// expectPanic calls fn and fails t if it does not panic.
+func expectPanic(t *testing.T, desc string, fn func()) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("%s did not panic", desc)
+		}
+	}()
+	fn()
+}
+
+func TestReleaseTwice(t *testing.T) {
+	m := New()
+	p, _ := m.Allocate(testNS, 0, 1, testOwner)
+	m.Release(testNS, 0, p, testOwner)
+	expectPanic(t, "second Release", func() { m.Release(testNS, 0, p, testOwner) })
+}
+
+func TestReleaseWrongOwner(t *testing.T) {
+	m := New()
+	first, second := new(int), new(int)
+
+	// first releases its port, which is then handed to second. A stale
+	// release by first must not free second's port.
+	p, _ := m.Allocate(testNS, 0, 1, first)
+	m.Release(testNS, 0, p, first)
+	if got, _ := m.Allocate(testNS, 0, 1, second); got != p {
+		t.Fatalf("m.Allocate(0, 1) got %d want %d", got, p)
+	}
+	expectPanic(t, "stale Release", func() { m.Release(testNS, 0, p, first) })
+
+	// The port is still allocated.
+	if got, _ := m.Allocate(testNS, 0, 1, first); got == p {
+		t.Errorf("m.Allocate(0, 1) got %d, which is held by another owner", got)
+	}
+
+	// Port 0 belongs to the kernel.
+	expectPanic(t, "Release of port 0", func() { m.Release(testNS, 0, 0, first) })
+}
+
+// snapshot returns a copy of the ports allocated in m, in ascending order, by
+// network namespace and protocol.
+func (m *Manager) snapshot() map[protocolKey][]int32 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	allocs := make(map[protocolKey][]int32, len(m.protocols))
+	for k, p := range m.protocols {
+		p.mu.Lock()
+		ports := make([]int32, 0, len(p.ports))
+		for port := range p.ports {
+			ports = append(ports, port)
+		}
+		p.mu.Unlock()
+		sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+		allocs[k] = ports
+	}
+	return allocs
+}
+
+func TestSaveRestoreFreshManager(t *testing.T) {
+	m := newSequential()
+	for _, hint := range []int32{1, 1, 1, 100} {
+		m.Allocate(testNS, 0, hint, testOwner)
+	}
+	m.Allocate(testNS, 15, 7, testOwner)
+	if _, err := m.Reserve(testNS, 15, 42, testOwner); err != nil {
+		t.Fatalf("m.Reserve(15, 42) got err %v want nil", err)
+	}
+	m.Release(testNS, 0, maxSearchPort-1, testOwner)
+	otherNS := inet.NewNamespace(testNS)
+	m.Allocate(otherNS, 0, 1, testOwner)
+	want := m.snapshot()
+
+	// Simulate a save/restore into a new Manager, which only receives the
+	// saved fields.
+	m.beforeSave()
+	restored := &Manager{
+		ports:  m.ports,
+		ranges: m.ranges,
+	}
+	restored.afterLoad()
+
+	if got := restored.snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ports after restore got %v want %v", got, want)
+	}
+}
+
+// BenchmarkAllocateParallel allocates and releases ports for four protocols
+// concurrently.
+func BenchmarkAllocateParallel(b *testing.B) {
+	const protocols = 4
+	m := New()
+	var (
+		mu   sync.Mutex
+		next int
+	)
+	b.RunParallel(func(pb *testing.PB) {
+		mu.Lock()
+		protocol := next % protocols
+		next++
+		mu.Unlock()
+
+		for pb.Next() {
+			p, ok := m.Allocate(testNS, protocol, 1, testOwner)
+			if !ok {
+				b.Fatalf("m.Allocate got !ok want ok")
+			}
+			m.Release(testNS, protocol, p, testOwner)
+		}
+	})
+}
+
+func TestStats(t *testing.T) {
+	m := New()
+	if err := m.SetRange(testNS, 1, Range{Min: 10, Max: 19}); err != nil {
+		t.Fatalf("m.SetRange got err %v want nil", err)
+	}
+	for _, hint := range []int32{1, 2, 3} {
+		m.Allocate(testNS, 0, hint, testOwner)
+	}
+	m.Release(testNS, 0, 2, testOwner)
+	m.Allocate(testNS, 1, 10, testOwner)
+	if _, err := m.Reserve(testNS, 1, 100, testOwner); err != nil {
+		t.Fatalf("m.Reserve(1, 100) got err %v want nil", err)
+	}
+	m.Release(testNS, 1, 10, testOwner)
+
+	got := make(map[protocolKey]ProtocolStats)
+	for _, s := range m.Stats() {
+		got[protocolKey{s.Namespace, s.Protocol}] = s
+	}
+	want := map[protocolKey]ProtocolStats{
+		{testNS, 0}: {
+			Namespace: testNS,
+			Protocol:  0,
+			Allocated: 2,
+			RangeSize: defaultSearchRange.Size(),
+		},
+		{testNS, 1}: {
+			Namespace: testNS,
+			Protocol:  1,
+			Allocated: 1,
+			RangeSize: 10,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("m.Stats got %+v want %+v", got, want)
+	}
+}
+
+// TestStatsConcurrent checks that concurrent calls to Stats don't deadlock with
+// each other or with allocations.
+func TestStatsConcurrent(t *testing.T) {
+	const protocols = 4
+	m := New()
+	for protocol := 0; protocol < protocols; protocol++ {
+		m.Allocate(testNS, protocol, 1, testOwner)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < protocols; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.Stats()
+			}
+		}()
+		go func(protocol int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if p, ok := m.Allocate(testNS, protocol, 2, testOwner); ok {
+					m.Release(testNS, protocol, p, testOwner)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestProtocolAllocatedPorts(t *testing.T) {
+	const protocol = 5
+	before := atomic.LoadInt64(&protocolAllocatedPorts[protocol])
+	m := New()
+	p, ok := m.Allocate(testNS, protocol, 1, testOwner)
+	if !ok {
+		t.Fatalf("m.Allocate got !ok want ok")
+	}
+	if got, want := atomic.LoadInt64(&protocolAllocatedPorts[protocol]), before+1; got != want {
+		t.Errorf("protocolAllocatedPorts[%d] after Allocate got %d want %d", protocol, got, want)
+	}
+	m.Release(testNS, protocol, p, testOwner)
+	if got := atomic.LoadInt64(&protocolAllocatedPorts[protocol]); got != before {
+		t.Errorf("protocolAllocatedPorts[%d] after Release got %d want %d", protocol, got, before)
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/device"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	"gvisor.dev/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
@@ -92,6 +93,10 @@ type socketOpsCommon struct {
 	// ports provides netlink port allocation.
 	ports *port.Manager
 
+	// netns is the network namespace in which the socket was created. Its
+	// port is allocated in this namespace.
+	netns *inet.Namespace
+
 	// protocol is the netlink protocol implementation.
 	protocol Protocol
 
@@ -152,6 +157,7 @@ func NewSocket(t *kernel.Task, skType linux.SockType, protocol Protocol) (*Socke
 	return &Socket{
 		socketOpsCommon: socketOpsCommon{
 			ports:          t.Kernel().NetlinkPorts(),
+			netns:          t.NetworkNamespace(),
 			protocol:       protocol,
 			skType:         skType,
 			ep:             ep,
@@ -167,7 +173,7 @@ func (s *socketOpsCommon) Release(ctx context.Context) {
 	s.ep.Close(ctx)
 
 	if s.bound {
-		s.ports.Release(s.protocol.Protocol(), s.portID)
+		s.ports.Release(s.netns, s.protocol.Protocol(), s.portID, s)
 	}
 }
 
@@ -231,9 +237,9 @@ func ExtractSockAddr(b []byte) (*linux.SockAddrNetlink, *syserr.Error) {
 	return &sa, nil
 }
 
-// bindPort binds this socket to a port, preferring 'port' if it is available.
-//
-// port of 0 defaults to the ThreadGroup ID.
+// bindPort binds this socket to a port. A nonzero port is bound exactly, and
+// fails with EADDRINUSE if it is taken. A port of 0 prefers the ThreadGroup ID,
+// falling back to any free port if it is taken.
 //
 // Preconditions: mu is held.
 func (s *socketOpsCommon) bindPort(t *kernel.Task, port int32) *syserr.Error {
@@ -246,12 +252,17 @@ func (s *socketOpsCommon) bindPort(t *kernel.Task, port int32) *syserr.Error {
 		return nil
 	}
 
-	if port == 0 {
-		port = int32(t.ThreadGroup().ID())
-	}
-	port, ok := s.ports.Allocate(s.protocol.Protocol(), port)
-	if !ok {
-		return syserr.ErrBusy
+	if port != 0 {
+		// As in Linux, an explicit port is never replaced by another.
+		if _, err := s.ports.Reserve(s.netns, s.protocol.Protocol(), port, s); err != nil {
+			return syserr.ErrAddressInUse
+		}
+	} else {
+		var ok bool
+		port, ok = s.ports.Allocate(s.netns, s.protocol.Protocol(), int32(t.ThreadGroup().ID()), s)
+		if !ok {
+			return syserr.ErrBusy
+		}
 	}
 
 	s.portID = port
@@ -72,6 +72,7 @@ func NewVFS2(t *kernel.Task, skType linux.SockType, protocol Protocol) (*SocketV
 	fd := &SocketVFS2{
 		socketOpsCommon: socketOpsCommon{
 			ports:          t.Kernel().NetlinkPorts(),
+			netns:          t.NetworkNamespace(),
 			protocol:       protocol,
 			skType:         skType,
 			ep:             ep,
@@ -228,7 +228,10 @@ func mknodAt(t *kernel.Task, dirFD int32, addr hostarch.Addr, mode linux.FileMod
 		}
 
 		// Attempt a creation.
-		perms := fs.FilePermsFromMode(mode &^ linux.FileMode(t.FSContext().Umask()))
+		perms, acls, err := createPermissions(t, d.Inode, mode, false /* isDir */)
+		if err != nil {
+			return err
+		}
 
 		switch mode.FileType() {
 		case 0:
@@ -243,11 +246,22 @@ func mknodAt(t *kernel.Task, dirFD int32, addr hostarch.Addr, mode linux.FileMod
 			if err != nil {
 				return err
 			}
-			file.DecRef(t)
+			defer file.DecRef(t)
+			if err := setInheritedACLs(t, file.Dirent, acls); err != nil {
+				removeCreated(t, root, d, name, false /* isDir */)
+				return err
+			}
 			return nil
 
 		case linux.ModeNamedPipe:
-			return d.CreateFifo(t, root, name, perms)
+			if err := d.CreateFifo(t, root, name, perms); err != nil {
+				return err
+			}
+			if err := setInheritedACLsAt(t, root, d, name, acls); err != nil {
+				removeCreated(t, root, d, name, false /* isDir */)
+				return err
+			}
+			return nil
 
 		case linux.ModeSocket:
 			// While it is possible create a unix domain socket file on linux
@@ -427,7 +441,10 @@ func createAt(t *kernel.Task, dirFD int32, addr hostarch.Addr, flags uint, mode
 			}
 
 			// Attempt a creation.
-			perms := fs.FilePermsFromMode(mode &^ linux.FileMode(t.FSContext().Umask()))
+			perms, acls, err := createPermissions(t, parent.Inode, mode, false /* isDir */)
+			if err != nil {
+				return err
+			}
 			newFile, err = parent.Create(t, root, name, fileFlags, perms)
 			if err != nil {
 				// No luck, bail.
@@ -435,6 +452,10 @@ func createAt(t *kernel.Task, dirFD int32, addr hostarch.Addr, flags uint, mode
 			}
 			defer newFile.DecRef(t)
 			found = newFile.Dirent
+			if err := setInheritedACLs(t, found, acls); err != nil {
+				removeCreated(t, root, parent, name, false /* isDir */)
+				return err
+			}
 		default:
 			return err
 		}
@@ -1193,8 +1214,18 @@ func mkdirAt(t *kernel.Task, dirFD int32, addr hostarch.Addr, mode linux.FileMod
 			}
 
 			// Create the directory.
-			perms := fs.FilePermsFromMode(mode &^ linux.FileMode(t.FSContext().Umask()))
-			return d.CreateDirectory(t, root, name, perms)
+			perms, acls, err := createPermissions(t, d.Inode, mode, true /* isDir */)
+			if err != nil {
+				return err
+			}
+			if err := d.CreateDirectory(t, root, name, perms); err != nil {
+				return err
+			}
+			if err := setInheritedACLsAt(t, root, d, name, acls); err != nil {
+				removeCreated(t, root, d, name, true /* isDir */)
+				return err
+			}
+			return nil
 		}
 	})
 }
@@ -15,30 +15,43 @@
 package linux
 
 import (
+	"encoding/binary"
+	"sort"
 	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/sentry/fsmetric"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/syserror"
 )
 
 // LINT.IfChange
 
 // GetXattr implements linux syscall getxattr(2).
-func GetXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return getXattrFromPath(t, args, true)
+func GetXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrGets, err) }()
+	return getXattrFromPath(t, linux.AT_FDCWD, args, true)
 }
 
 // LGetXattr implements linux syscall lgetxattr(2).
-func LGetXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return getXattrFromPath(t, args, false)
+func LGetXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrGets, err) }()
+	return getXattrFromPath(t, linux.AT_FDCWD, args, false)
 }
 
 // FGetXattr implements linux syscall fgetxattr(2).
-func FGetXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func FGetXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrGets, err) }()
+
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	fd := args[0].Int()
 	nameAddr := args[1].Pointer()
 	valueAddr := args[2].Pointer()
@@ -59,7 +72,13 @@ func FGetXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 	return uintptr(n), nil, nil
 }
 
-func getXattrFromPath(t *kernel.Task, args arch.SyscallArguments, resolveSymlink bool) (uintptr, *kernel.SyscallControl, error) {
+// getXattrFromPath implements getxattr(2) and lgetxattr(2) for the path in
+// args, resolved relative to dirFD.
+func getXattrFromPath(t *kernel.Task, dirFD int32, args arch.SyscallArguments, resolveSymlink bool) (uintptr, *kernel.SyscallControl, error) {
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	pathAddr := args[0].Pointer()
 	nameAddr := args[1].Pointer()
 	valueAddr := args[2].Pointer()
@@ -71,7 +90,9 @@ func getXattrFromPath(t *kernel.Task, args arch.SyscallArguments, resolveSymlink
 	}
 
 	n := 0
-	err = fileOpOn(t, linux.AT_FDCWD, path, resolveSymlink, func(_ *fs.Dirent, d *fs.Dirent, _ uint) error {
+	// As in Linux, a trailing slash causes a final symlink to be followed
+	// even by the l*xattr variants.
+	err = fileOpOn(t, dirFD, path, resolveSymlink || dirPath, func(_ *fs.Dirent, d *fs.Dirent, _ uint) error {
 		if dirPath && !fs.IsDir(d.Inode.StableAttr) {
 			return syserror.ENOTDIR
 		}
@@ -93,55 +114,135 @@ func getXattr(t *kernel.Task, d *fs.Dirent, nameAddr, valueAddr hostarch.Addr, s
 		return 0, err
 	}
 
-	if err := checkXattrPermissions(t, d.Inode, fs.PermMask{Read: true}); err != nil {
+	// A static SELinux label applies to every file, whether or not its
+	// filesystem supports extended attributes. As in Linux, reading it
+	// doesn't require any permissions on the file.
+	if label, ok := staticSELinuxLabel(t, name); ok {
+		return copyOutXattrResult(t, valueAddr, []byte(label), size)
+	}
+
+	if err := checkXattrPermissions(t, d.Inode, name, fs.PermMask{Read: true}); err != nil {
 		return 0, err
 	}
 
-	// TODO(b/148380782): Support xattrs in namespaces other than "user".
-	if !strings.HasPrefix(name, linux.XATTR_USER_PREFIX) {
+	if namespaceForName(name) == xattrNamespaceUnsupported || !d.Inode.SupportsXattrs() {
 		return 0, syserror.EOPNOTSUPP
 	}
 
-	// If getxattr(2) is called with size 0, the size of the value will be
-	// returned successfully even if it is nonzero. In that case, we need to
-	// retrieve the entire attribute value so we can return the correct size.
-	requestedSize := size
-	if size == 0 || size > linux.XATTR_SIZE_MAX {
-		requestedSize = linux.XATTR_SIZE_MAX
+	// Reads from a remote filesystem may block uninterruptibly, so don't
+	// start one if t has already been interrupted.
+	if t.Interrupted() {
+		return 0, syserror.ERESTARTSYS
 	}
 
-	value, err := d.Inode.GetXattr(t, name, requestedSize)
-	if err != nil {
-		return 0, err
+	// ACLs are translated into t's user namespace, so they must always be
+	// retrieved.
+	if namespaceForName(name) == xattrNamespacePOSIXACL {
+		value, err := d.Inode.GetXattrFull(t, name)
+		if err != nil {
+			return 0, syserror.ConvertIntr(err, syserror.ERESTARTSYS)
+		}
+		acl, err := posixACLForReader(t, []byte(value))
+		if err != nil {
+			return 0, err
+		}
+		return copyOutXattrResult(t, valueAddr, acl, size)
 	}
-	n := len(value)
-	if uint64(n) > requestedSize {
-		return 0, syserror.ERANGE
+
+	// File capabilities are translated into t's user namespace, which may
+	// change their size, so they must always be retrieved.
+	if namespaceForName(name) == xattrNamespaceCapability {
+		value, err := d.Inode.GetXattr(t, name, linux.XATTR_SIZE_MAX)
+		if err != nil {
+			return 0, syserror.ConvertIntr(err, syserror.ERESTARTSYS)
+		}
+		caps, err := fileCapsForReader(t, []byte(value))
+		if err != nil {
+			return 0, err
+		}
+		return copyOutXattrResult(t, valueAddr, caps, size)
 	}
 
-	// Don't copy out the attribute value if size is 0.
+	// If getxattr(2) is called with size 0, only the size of the value is
+	// returned, even if it is nonzero. Filesystems may be able to report it
+	// without retrieving the value.
 	if size == 0 {
+		n, err := d.Inode.GetXattrSize(t, name)
+		if err != nil {
+			return 0, syserror.ConvertIntr(err, syserror.ERESTARTSYS)
+		}
+		if n > linux.XATTR_SIZE_MAX {
+			return 0, syserror.ERANGE
+		}
 		return n, nil
 	}
+	value, err := d.Inode.GetXattr(t, name, xattrRequestedSize(size))
+	if err != nil {
+		return 0, syserror.ConvertIntr(err, syserror.ERESTARTSYS)
+	}
+	return copyOutXattrResult(t, valueAddr, []byte(value), size)
+}
 
-	if _, err = t.CopyOutBytes(valueAddr, []byte(value)); err != nil {
+// xattrRequestedSize returns the maximum result size that should be retrieved
+// for a getxattr(2) or listxattr(2) call with the given user buffer size. A
+// size of 0 probes for the size of the result, so the entire result must be
+// retrieved.
+func xattrRequestedSize(size uint64) uint64 {
+	if size == 0 || size > linux.XATTR_SIZE_MAX {
+		return linux.XATTR_SIZE_MAX
+	}
+	return size
+}
+
+// copyOutXattrResult copies data, the result of a getxattr(2) or listxattr(2)
+// call, to the user buffer at addr of the given size and returns the length of
+// data. If size is 0, nothing is copied out and only the length is returned.
+// ERANGE is returned if data does not fit in the buffer, or E2BIG if it could
+// never fit.
+func copyOutXattrResult(t *kernel.Task, addr hostarch.Addr, data []byte, size uint64) (int, error) {
+	n := len(data)
+	// As in Linux, data is compared against the clamped size rather than the
+	// user's: a buffer larger than the maximum can't hold more than the
+	// maximum. If data doesn't fit even then, the buffer wasn't too small;
+	// data was too big.
+	if uint64(n) > xattrRequestedSize(size) {
+		if size >= linux.XATTR_SIZE_MAX {
+			return 0, syserror.E2BIG
+		}
+		return 0, syserror.ERANGE
+	}
+	if size == 0 {
+		return n, nil
+	}
+	// CopyOutBytes only copies less than len(data) if it also returns an
+	// error. As in Linux, a fault partway through the buffer fails the whole
+	// call with EFAULT, even though a prefix of data may have been written.
+	if _, err := t.CopyOutBytes(addr, data); err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
 // SetXattr implements linux syscall setxattr(2).
-func SetXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return setXattrFromPath(t, args, true)
+func SetXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrSets, err) }()
+	return setXattrFromPath(t, linux.AT_FDCWD, args, true)
 }
 
 // LSetXattr implements linux syscall lsetxattr(2).
-func LSetXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return setXattrFromPath(t, args, false)
+func LSetXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrSets, err) }()
+	return setXattrFromPath(t, linux.AT_FDCWD, args, false)
 }
 
 // FSetXattr implements linux syscall fsetxattr(2).
-func FSetXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func FSetXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrSets, err) }()
+
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	fd := args[0].Int()
 	nameAddr := args[1].Pointer()
 	valueAddr := args[2].Pointer()
@@ -155,10 +256,16 @@ func FSetXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 	}
 	defer f.DecRef(t)
 
-	return 0, nil, setXattr(t, f.Dirent, nameAddr, valueAddr, uint64(size), flags)
+	return 0, nil, setXattr(t, f.Dirent, nameAddr, valueAddr, size, flags)
 }
 
-func setXattrFromPath(t *kernel.Task, args arch.SyscallArguments, resolveSymlink bool) (uintptr, *kernel.SyscallControl, error) {
+// setXattrFromPath implements setxattr(2) and lsetxattr(2) for the path in
+// args, resolved relative to dirFD.
+func setXattrFromPath(t *kernel.Task, dirFD int32, args arch.SyscallArguments, resolveSymlink bool) (uintptr, *kernel.SyscallControl, error) {
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	pathAddr := args[0].Pointer()
 	nameAddr := args[1].Pointer()
 	valueAddr := args[2].Pointer()
@@ -170,17 +277,23 @@ func setXattrFromPath(t *kernel.Task, args arch.SyscallArguments, resolveSymlink
 		return 0, nil, err
 	}
 
-	return 0, nil, fileOpOn(t, linux.AT_FDCWD, path, resolveSymlink, func(_ *fs.Dirent, d *fs.Dirent, _ uint) error {
+	return 0, nil, fileOpOn(t, dirFD, path, resolveSymlink || dirPath, func(_ *fs.Dirent, d *fs.Dirent, _ uint) error {
 		if dirPath && !fs.IsDir(d.Inode.StableAttr) {
 			return syserror.ENOTDIR
 		}
 
-		return setXattr(t, d, nameAddr, valueAddr, uint64(size), flags)
+		return setXattr(t, d, nameAddr, valueAddr, size, flags)
 	})
 }
 
 // setXattr implements setxattr(2) from the given *fs.Dirent.
 func setXattr(t *kernel.Task, d *fs.Dirent, nameAddr, valueAddr hostarch.Addr, size uint64, flags uint32) error {
+	// As in Linux, read-only mounts are rejected before the arguments are
+	// examined.
+	if err := d.Inode.CheckWritableMount(); err != nil {
+		return err
+	}
+
 	if flags&^(linux.XATTR_CREATE|linux.XATTR_REPLACE) != 0 {
 		return syserror.EINVAL
 	}
@@ -190,30 +303,82 @@ func setXattr(t *kernel.Task, d *fs.Dirent, nameAddr, valueAddr hostarch.Addr, s
 		return err
 	}
 
-	if err := checkXattrPermissions(t, d.Inode, fs.PermMask{Write: true}); err != nil {
+	if _, ok := staticSELinuxLabel(t, name); ok {
+		return writeStaticSELinuxLabel(t)
+	}
+
+	// Reject unsupported namespaces and filesystems before copying in the
+	// value, so that a bad value pointer can't mask EOPNOTSUPP. Linux
+	// copies in the value first, and so returns EFAULT in that case.
+	ns := namespaceForName(name)
+	if !xattrNamespaceWritable(ns) {
+		return syserror.EOPNOTSUPP
+	}
+
+	if err := checkXattrPermissions(t, d.Inode, name, fs.PermMask{Write: true}); err != nil {
 		return err
 	}
 
+	// As in Linux, file type restrictions on user.* take precedence over
+	// filesystem support, so this is checked after permissions.
+	if !d.Inode.SupportsXattrs() {
+		return syserror.EOPNOTSUPP
+	}
+
+	// size is taken from a size_t argument, which is 64 bits wide on every
+	// supported architecture, so it can't have been truncated before this
+	// check. Once checked, it's small enough for int64 and make().
 	if size > linux.XATTR_SIZE_MAX {
 		return syserror.E2BIG
 	}
+	// Don't allocate a buffer for a value that can't possibly be copied in.
+	if _, ok := t.MemoryManager().CheckIORange(valueAddr, int64(size)); !ok {
+		return syserror.EFAULT
+	}
 	buf := make([]byte, size)
 	if _, err := t.CopyInBytes(valueAddr, buf); err != nil {
 		return err
 	}
 	value := string(buf)
 
-	if !strings.HasPrefix(name, linux.XATTR_USER_PREFIX) {
-		return syserror.EOPNOTSUPP
+	if ns == xattrNamespacePOSIXACL {
+		if err := setPOSIXACL(t, d, name, buf); err != nil {
+			return syserror.ConvertIntr(err, syserror.ERESTARTSYS)
+		}
+		d.InotifyEvent(linux.IN_ATTRIB, 0)
+		return nil
+	}
+	if ns == xattrNamespaceCapability {
+		if !validFileCaps(buf) {
+			return syserror.EINVAL
+		}
+		caps, err := fileCapsForStorage(t, buf)
+		if err != nil {
+			return err
+		}
+		value = string(caps)
 	}
 
-	if err := d.Inode.SetXattr(t, d, name, value, flags); err != nil {
-		return err
+	return setInodeXattr(t, d, name, value, flags)
+}
+
+// setInodeXattr sets name to value on d, once setxattr(2) has validated it,
+// and notifies watches of d.
+func setInodeXattr(ctx context.Context, d *fs.Dirent, name, value string, flags uint32) error {
+	if err := d.Inode.SetXattr(ctx, d, name, value, flags); err != nil {
+		// An interrupted SetXattr leaves the attribute unchanged, so the
+		// syscall can be restarted with the same arguments.
+		return syserror.ConvertIntr(err, syserror.ERESTARTSYS)
 	}
 	d.InotifyEvent(linux.IN_ATTRIB, 0)
 	return nil
 }
 
+// copyInXattrName copies in and validates an extended attribute name.
+//
+// The name is always copied in full before its namespace is examined: as in
+// Linux, EFAULT and ERANGE for an over-long name take precedence over any
+// namespace error. This is cheap, since CopyInString stops at the first NUL.
 func copyInXattrName(t *kernel.Task, nameAddr hostarch.Addr) (string, error) {
 	name, err := t.CopyInString(nameAddr, linux.XATTR_NAME_MAX+1)
 	if err != nil {
@@ -225,42 +390,475 @@ func copyInXattrName(t *kernel.Task, nameAddr hostarch.Addr) (string, error) {
 	if len(name) == 0 {
 		return "", syserror.ERANGE
 	}
+	// Names must not consist solely of a namespace prefix. Compare Linux's
+	// fs/xattr.c:xattr_resolve_name().
+	if name == linux.XATTR_USER_PREFIX || name == linux.XATTR_TRUSTED_PREFIX {
+		return "", syserror.EINVAL
+	}
+	// The sandbox may restrict applications to some namespaces, regardless
+	// of their privileges.
+	if !t.Kernel().XattrNamespaceAllowed(name) {
+		return "", syserror.EOPNOTSUPP
+	}
 	return name, nil
 }
 
-// Restrict xattrs to regular files and directories.
+// xattrNamespace identifies the namespace of an extended attribute name.
+type xattrNamespace int
+
+const (
+	// xattrNamespaceUnsupported is any namespace we don't support.
+	xattrNamespaceUnsupported xattrNamespace = iota
+
+	// xattrNamespaceUser is the "user.*" namespace.
+	xattrNamespaceUser
+
+	// xattrNamespaceTrusted is the "trusted.*" namespace, which is only
+	// accessible to tasks with CAP_SYS_ADMIN.
+	xattrNamespaceTrusted
+
+	// xattrNamespacePOSIXACL is the system.posix_acl_access and
+	// system.posix_acl_default attributes, which are only supported by
+	// filesystems that implement fs.InodePOSIXACLOperations.
+	xattrNamespacePOSIXACL
+
+	// xattrNamespaceSecurity is the "security.*" namespace. It is read-only:
+	// filesystems may expose synthesized labels, but they cannot be changed.
+	xattrNamespaceSecurity
+
+	// xattrNamespaceCapability is the security.capability attribute, which
+	// holds file capabilities. Unlike the rest of the "security.*"
+	// namespace, it may be changed by tasks with CAP_SETFCAP.
+	xattrNamespaceCapability
+)
+
+// namespaceForName classifies name by its namespace prefix.
+func namespaceForName(name string) xattrNamespace {
+	switch {
+	case strings.HasPrefix(name, linux.XATTR_USER_PREFIX):
+		return xattrNamespaceUser
+	case strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX):
+		return xattrNamespaceTrusted
+	case name == linux.XATTR_NAME_POSIX_ACL_ACCESS || name == linux.XATTR_NAME_POSIX_ACL_DEFAULT:
+		return xattrNamespacePOSIXACL
+	case name == linux.XATTR_NAME_CAPS:
+		return xattrNamespaceCapability
+	case strings.HasPrefix(name, linux.XATTR_SECURITY_PREFIX):
+		return xattrNamespaceSecurity
+	default:
+		return xattrNamespaceUnsupported
+	}
+}
+
+// limitXattrRate throttles t's extended attribute syscalls, if the sandbox is
+// configured to do so. It must be called before any other work is done.
+func limitXattrRate(t *kernel.Task) error {
+	return syserror.ConvertIntr(t.LimitXattrRate(), syserror.ERESTARTSYS)
+}
+
+// staticSELinuxLabel returns the static SELinux label configured for the
+// sandbox, and true if name is security.selinux and a label is configured, in
+// which case the label is used in place of any the filesystem may store.
+func staticSELinuxLabel(t *kernel.Task, name string) (string, bool) {
+	label := t.Kernel().SELinuxLabel()
+	return label, label != "" && name == linux.XATTR_NAME_SELINUX
+}
+
+// writeStaticSELinuxLabel implements setxattr(2) and removexattr(2) of a
+// static SELinux label, which can't be changed. Depending on the sandbox
+// configuration, attempts to do so either fail or are silently ignored.
+func writeStaticSELinuxLabel(t *kernel.Task) error {
+	if t.Kernel().IgnoreSELinuxLabelWrites() {
+		return nil
+	}
+	return syserror.EOPNOTSUPP
+}
+
+// xattrNamespaceWritable returns whether xattrs in namespace ns may be set or
+// removed.
+func xattrNamespaceWritable(ns xattrNamespace) bool {
+	return ns != xattrNamespaceUnsupported && ns != xattrNamespaceSecurity
+}
+
+// validFileCaps returns whether value is a valid security.capability value,
+// i.e. a revision 2 struct vfs_cap_data, the format written by setcap(8), or a
+// revision 3 struct vfs_ns_cap_data. Revision 1 can't be set. Compare Linux's
+// security/commoncap.c:validheader().
+//
+// File capabilities are stored but not applied by execve(2). The sentry always
+// sets no_new_privs, under which they couldn't grant an executable any
+// capabilities its caller lacks anyway; see
+// kernel.Task.updateCredsForExecLocked.
+func validFileCaps(value []byte) bool {
+	if len(value) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(value) & linux.VFS_CAP_REVISION_MASK {
+	case linux.VFS_CAP_REVISION_2:
+		return len(value) == linux.XATTR_CAPS_SZ_2
+	case linux.VFS_CAP_REVISION_3:
+		return len(value) == linux.XATTR_CAPS_SZ_3
+	default:
+		return false
+	}
+}
+
+// fileCapsRootID returns the rootid of value, a valid security.capability
+// value. Revision 2 values have an implicit rootid of 0.
+func fileCapsRootID(value []byte) uint32 {
+	if len(value) == linux.XATTR_CAPS_SZ_3 {
+		return binary.LittleEndian.Uint32(value[linux.XATTR_CAPS_SZ_2:])
+	}
+	return 0
+}
+
+// fileCapsWithRevision returns a copy of value, a valid security.capability
+// value, converted to the given revision (2 or 3). rootid is only used for
+// revision 3.
+func fileCapsWithRevision(value []byte, revision, rootid uint32) []byte {
+	size := linux.XATTR_CAPS_SZ_2
+	if revision == linux.VFS_CAP_REVISION_3 {
+		size = linux.XATTR_CAPS_SZ_3
+	}
+	caps := make([]byte, size)
+	magic := binary.LittleEndian.Uint32(value)
+	binary.LittleEndian.PutUint32(caps, revision|magic&linux.VFS_CAP_FLAGS_EFFECTIVE)
+	copy(caps[4:linux.XATTR_CAPS_SZ_2], value[4:linux.XATTR_CAPS_SZ_2])
+	if revision == linux.VFS_CAP_REVISION_3 {
+		binary.LittleEndian.PutUint32(caps[linux.XATTR_CAPS_SZ_2:], rootid)
+	}
+	return caps
+}
+
+// fileCapsForStorage converts value, a valid security.capability value set by
+// t, to the form in which it is stored. Revision 2 values set in the root user
+// namespace are stored unchanged. Otherwise, the capabilities are scoped to
+// the user namespace in which they were set, by storing them as revision 3
+// with rootid translated to a KUID. Compare Linux's
+// security/commoncap.c:cap_convert_nscap().
+func fileCapsForStorage(t *kernel.Task, value []byte) ([]byte, error) {
+	userns := t.UserNamespace()
+	if len(value) == linux.XATTR_CAPS_SZ_2 && userns.Root() == userns {
+		return value, nil
+	}
+	kroot := userns.MapToKUID(auth.UID(fileCapsRootID(value)))
+	if !kroot.Ok() {
+		return nil, syserror.EINVAL
+	}
+	return fileCapsWithRevision(value, linux.VFS_CAP_REVISION_3, uint32(kroot)), nil
+}
+
+// fileCapsForReader converts value, a stored security.capability value, to the
+// form seen by t. Compare Linux's security/commoncap.c:cap_inode_getsecurity().
+func fileCapsForReader(t *kernel.Task, value []byte) ([]byte, error) {
+	if !validFileCaps(value) {
+		return nil, syserror.EINVAL
+	}
+	userns := t.UserNamespace()
+	kroot := auth.KUID(fileCapsRootID(value))
+	// Capabilities scoped to a user namespace whose root is an unprivileged
+	// user in t's user namespace keep their scope.
+	if rootid := kroot.In(userns); rootid.Ok() && rootid != auth.RootUID {
+		return fileCapsWithRevision(value, linux.VFS_CAP_REVISION_3, uint32(rootid)), nil
+	}
+	// Otherwise, they can only be shown, unscoped, if they apply in t's user
+	// namespace.
+	if !kroot.IsRootInAncestor(userns) {
+		return nil, syserror.EOVERFLOW
+	}
+	return fileCapsWithRevision(value, linux.VFS_CAP_REVISION_2, 0), nil
+}
+
+// posixACLForStorage converts value, a POSIX ACL set by t, to the form in
+// which it is stored, with user and group IDs translated to KUIDs and KGIDs.
+// An empty ACL is returned as nil. Compare Linux's
+// fs/posix_acl.c:posix_acl_from_xattr().
+func posixACLForStorage(t *kernel.Task, value []byte) (fs.POSIXACL, error) {
+	// A zero-length value removes the ACL, as does one with no entries.
+	if len(value) == 0 {
+		return nil, nil
+	}
+	acl, err := fs.DecodePOSIXACL(value)
+	if err != nil {
+		return nil, err
+	}
+	userns := t.UserNamespace()
+	for i := range acl {
+		e := &acl[i]
+		switch e.Tag {
+		case linux.ACL_USER:
+			kuid := userns.MapToKUID(auth.UID(e.ID))
+			if !kuid.Ok() {
+				return nil, syserror.EINVAL
+			}
+			e.ID = uint32(kuid)
+		case linux.ACL_GROUP:
+			kgid := userns.MapToKGID(auth.GID(e.ID))
+			if !kgid.Ok() {
+				return nil, syserror.EINVAL
+			}
+			e.ID = uint32(kgid)
+		}
+	}
+	return acl, nil
+}
+
+// posixACLForReader converts value, a stored POSIX ACL, to the form seen by t.
+// As in Linux, user and group IDs that aren't mapped in t's user namespace are
+// shown as -1. Compare Linux's fs/posix_acl.c:posix_acl_to_xattr().
+func posixACLForReader(t *kernel.Task, value []byte) ([]byte, error) {
+	acl, err := fs.DecodePOSIXACL(value)
+	if err != nil {
+		return nil, syserror.EINVAL
+	}
+	userns := t.UserNamespace()
+	for i := range acl {
+		e := &acl[i]
+		switch e.Tag {
+		case linux.ACL_USER:
+			e.ID = uint32(auth.KUID(e.ID).In(userns))
+		case linux.ACL_GROUP:
+			e.ID = uint32(auth.KGID(e.ID).In(userns))
+		}
+	}
+	return acl.Encode(), nil
+}
+
+// setPOSIXACL implements setxattr(2) of the POSIX ACL name on d, which has
+// already passed checkXattrPermissions. As in Linux, flags are ignored.
 //
-// TODO(b/148380782): In Linux, this restriction technically only applies to
-// xattrs in the "user.*" namespace. Make file type checks specific to the
-// namespace once we allow other xattr prefixes.
+// Setting an access ACL also sets the file mode to match the ACL, and an ACL
+// that the mode can represent exactly isn't stored at all. Compare Linux's
+// fs/posix_acl.c:posix_acl_xattr_set() and posix_acl_update_mode().
+func setPOSIXACL(t *kernel.Task, d *fs.Dirent, name string, value []byte) error {
+	acl, err := posixACLForStorage(t, value)
+	if err != nil {
+		return err
+	}
+	if name == linux.XATTR_NAME_POSIX_ACL_ACCESS && acl != nil {
+		uattr, err := d.Inode.UnstableAttr(t)
+		if err != nil {
+			return err
+		}
+		perms, equiv := acl.EquivPermissions(uattr.Perms)
+		if !t.Credentials().InGroup(uattr.Owner.GID) && !d.Inode.CheckCapability(t, linux.CAP_FSETID) {
+			perms.SetGID = false
+		}
+		if !d.Inode.SetPermissions(t, d, perms) {
+			return syserror.EPERM
+		}
+		if equiv {
+			acl = nil
+		}
+	}
+	if acl == nil {
+		if err := d.Inode.RemoveXattr(t, d, name); err != nil && err != syserror.ENODATA {
+			return err
+		}
+		return nil
+	}
+	return d.Inode.SetXattr(t, d, name, string(acl.Encode()), 0 /* flags */)
+}
+
+// inheritedACLs are the POSIX ACLs that a new file inherits from the default
+// ACL of the directory it's created in.
+type inheritedACLs struct {
+	// access is the new file's access ACL, or nil if its mode describes it
+	// exactly.
+	access fs.POSIXACL
+
+	// def is the new file's default ACL. Only directories inherit one.
+	def fs.POSIXACL
+}
+
+// createPermissions returns the permissions of a file created by t in the
+// directory parent with the requested mode, and the ACLs it inherits, which
+// must be set with setInheritedACLs once it exists. If they can't be set, the
+// file must be removed with removeCreated. If parent has a default
+// ACL, it takes the place of t's umask. Compare Linux's
+// fs/posix_acl.c:posix_acl_create().
+func createPermissions(t *kernel.Task, parent *fs.Inode, mode linux.FileMode, isDir bool) (fs.FilePermissions, inheritedACLs, error) {
+	var acls inheritedACLs
+	if !parent.SupportsPOSIXACLs() {
+		return fs.FilePermsFromMode(mode &^ linux.FileMode(t.FSContext().Umask())), acls, nil
+	}
+	value, err := parent.GetXattrFull(t, linux.XATTR_NAME_POSIX_ACL_DEFAULT)
+	if err != nil && err != syserror.ENODATA {
+		return fs.FilePermissions{}, acls, syserror.ConvertIntr(err, syserror.ERESTARTSYS)
+	}
+	var def fs.POSIXACL
+	if err == nil {
+		if def, err = fs.DecodePOSIXACL([]byte(value)); err != nil {
+			return fs.FilePermissions{}, acls, syserror.EIO
+		}
+	}
+	if def == nil {
+		return fs.FilePermsFromMode(mode &^ linux.FileMode(t.FSContext().Umask())), acls, nil
+	}
+
+	access, perms, equiv := def.CreatePermissions(fs.FilePermsFromMode(mode))
+	if !equiv {
+		acls.access = access
+	}
+	if isDir {
+		acls.def = def
+	}
+	return perms, acls, nil
+}
+
+// setInheritedACLs sets acls, returned by createPermissions, on d, a file just
+// created by t.
+func setInheritedACLs(t *kernel.Task, d *fs.Dirent, acls inheritedACLs) error {
+	if acls.access != nil {
+		if err := d.Inode.SetXattr(t, d, linux.XATTR_NAME_POSIX_ACL_ACCESS, string(acls.access.Encode()), 0 /* flags */); err != nil {
+			return err
+		}
+	}
+	if acls.def != nil {
+		if err := d.Inode.SetXattr(t, d, linux.XATTR_NAME_POSIX_ACL_DEFAULT, string(acls.def.Encode()), 0 /* flags */); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setInheritedACLsAt is equivalent to setInheritedACLs for the file name in
+// parent, for file types whose creation doesn't return the new file.
+func setInheritedACLsAt(t *kernel.Task, root, parent *fs.Dirent, name string, acls inheritedACLs) error {
+	if acls.access == nil && acls.def == nil {
+		return nil
+	}
+	d, err := parent.Walk(t, root, name)
+	if err != nil {
+		return err
+	}
+	defer d.DecRef(t)
+	return setInheritedACLs(t, d, acls)
+}
+
+// removeCreated removes the file name, just created by t in parent, after its
+// inherited ACLs couldn't be set, so that the failed creation doesn't leave it
+// behind. Errors are ignored, since the creation has already failed.
+func removeCreated(t *kernel.Task, root, parent *fs.Dirent, name string, isDir bool) {
+	if isDir {
+		parent.RemoveDirectory(t, root, name)
+	} else {
+		parent.Remove(t, root, name, false /* dirPath */)
+	}
+}
+
+// Restrict user.* xattrs to regular files and directories.
 func xattrFileTypeOk(i *fs.Inode) bool {
 	return fs.IsRegular(i.StableAttr) || fs.IsDir(i.StableAttr)
 }
 
-func checkXattrPermissions(t *kernel.Task, i *fs.Inode, perms fs.PermMask) error {
-	// Restrict xattrs to regular files and directories.
-	if !xattrFileTypeOk(i) {
+// checkXattrPermissions checks whether t may access the extended attribute
+// name on i. This is analogous to fs/xattr.c:xattr_permission().
+//
+// As in Linux, errors are reported with the following precedence:
+//
+//  1. Namespace-specific restrictions: trusted.* requires CAP_SYS_ADMIN, and
+//     user.* is only supported on regular files and directories. These fail
+//     with EPERM for writes and ENODATA for reads.
+//  2. Inode permissions (EACCES).
+//
+// Unsupported filesystems fail with EOPNOTSUPP once this returns
+// successfully, as in Linux. So do unsupported namespaces for getXattr, but
+// setXattr and removeXattr reject them before calling this, so that they
+// aren't masked by permission errors or, for setXattr, by a bad value pointer.
+// Writes to read-only mounts fail with EROFS before any of these.
+func checkXattrPermissions(t *kernel.Task, i *fs.Inode, name string, perms fs.PermMask) error {
+	switch namespaceForName(name) {
+	case xattrNamespaceTrusted:
+		// The trusted.* namespace can only be accessed by privileged
+		// users, and is not subject to inode permission checks.
+		if t.HasCapability(linux.CAP_SYS_ADMIN) {
+			return nil
+		}
 		if perms.Write {
 			return syserror.EPERM
 		}
 		return syserror.ENODATA
+	case xattrNamespaceUser:
+		if !xattrFileTypeOk(i) {
+			if perms.Write {
+				return syserror.EPERM
+			}
+			return syserror.ENODATA
+		}
+	case xattrNamespacePOSIXACL:
+		if !i.SupportsPOSIXACLs() {
+			return syserror.EOPNOTSUPP
+		}
+		// As in Linux, ACLs can be read without any permissions on the
+		// file, and changed by its owner regardless of its mode.
+		//
+		// Only directories have default ACLs, which are inherited by
+		// new files created in them. Compare Linux's
+		// fs/posix_acl.c:set_posix_acl().
+		if perms.Write && name == linux.XATTR_NAME_POSIX_ACL_DEFAULT && !fs.IsDir(i.StableAttr) {
+			return syserror.EACCES
+		}
+		// Only the owner may change a file's ACLs.
+		if perms.Write && !i.CheckOwnership(t) {
+			return syserror.EPERM
+		}
+		return nil
+	case xattrNamespaceCapability:
+		// As with other security.* attributes, file capabilities can be
+		// read without any permissions on the file. Changing them
+		// requires CAP_SETFCAP, regardless of the file's mode. Compare
+		// Linux's fs/xattr.c:xattr_permission(),
+		// security/commoncap.c:cap_inode_setxattr() and
+		// cap_inode_removexattr().
+		if perms.Write && !t.HasCapability(linux.CAP_SETFCAP) {
+			return syserror.EPERM
+		}
+		return nil
 	}
 
 	return i.CheckPermission(t, perms)
 }
 
+// xattrVisible returns whether the extended attribute name should be included
+// in a listxattr(2) result for t.
+func xattrVisible(t *kernel.Task, name string) bool {
+	if !t.Kernel().XattrNamespaceAllowed(name) {
+		return false
+	}
+	switch namespaceForName(name) {
+	case xattrNamespaceUser, xattrNamespacePOSIXACL, xattrNamespaceSecurity, xattrNamespaceCapability:
+		return true
+	case xattrNamespaceTrusted:
+		return t.HasCapability(linux.CAP_SYS_ADMIN)
+	default:
+		return false
+	}
+}
+
 // ListXattr implements linux syscall listxattr(2).
-func ListXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return listXattrFromPath(t, args, true)
+func ListXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrLists, err) }()
+	return listXattrFromPath(t, linux.AT_FDCWD, args, true)
 }
 
 // LListXattr implements linux syscall llistxattr(2).
-func LListXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return listXattrFromPath(t, args, false)
+func LListXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrLists, err) }()
+	return listXattrFromPath(t, linux.AT_FDCWD, args, false)
 }
 
 // FListXattr implements linux syscall flistxattr(2).
-func FListXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+//
+// The arguments are (fd, list, size). As in Linux, flistxattr takes no flags
+// and any further arguments are ignored.
+func FListXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrLists, err) }()
+
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	fd := args[0].Int()
 	listAddr := args[1].Pointer()
 	size := uint64(args[2].SizeT())
@@ -280,7 +878,16 @@ func FListXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sy
 	return uintptr(n), nil, nil
 }
 
-func listXattrFromPath(t *kernel.Task, args arch.SyscallArguments, resolveSymlink bool) (uintptr, *kernel.SyscallControl, error) {
+// listXattrFromPath implements listxattr(2) and llistxattr(2) for the path in
+// args, resolved relative to dirFD.
+//
+// The arguments are (path, list, size). As in Linux, listxattr takes no flags
+// and any further arguments are ignored.
+func listXattrFromPath(t *kernel.Task, dirFD int32, args arch.SyscallArguments, resolveSymlink bool) (uintptr, *kernel.SyscallControl, error) {
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	pathAddr := args[0].Pointer()
 	listAddr := args[1].Pointer()
 	size := uint64(args[2].SizeT())
@@ -291,7 +898,7 @@ func listXattrFromPath(t *kernel.Task, args arch.SyscallArguments, resolveSymlin
 	}
 
 	n := 0
-	err = fileOpOn(t, linux.AT_FDCWD, path, resolveSymlink, func(_ *fs.Dirent, d *fs.Dirent, _ uint) error {
+	err = fileOpOn(t, dirFD, path, resolveSymlink || dirPath, func(_ *fs.Dirent, d *fs.Dirent, _ uint) error {
 		if dirPath && !fs.IsDir(d.Inode.StableAttr) {
 			return syserror.ENOTDIR
 		}
@@ -307,75 +914,92 @@ func listXattrFromPath(t *kernel.Task, args arch.SyscallArguments, resolveSymlin
 }
 
 func listXattr(t *kernel.Task, d *fs.Dirent, addr hostarch.Addr, size uint64) (int, error) {
-	if !xattrFileTypeOk(d.Inode) {
-		return 0, nil
-	}
-
-	// If listxattr(2) is called with size 0, the buffer size needed to contain
-	// the xattr list will be returned successfully even if it is nonzero. In
-	// that case, we need to retrieve the entire list so we can compute and
-	// return the correct size.
-	requestedSize := size
-	if size == 0 || size > linux.XATTR_SIZE_MAX {
-		requestedSize = linux.XATTR_SIZE_MAX
-	}
-	xattrs, err := d.Inode.ListXattr(t, requestedSize)
-	if err != nil {
-		return 0, err
-	}
-
-	// TODO(b/148380782): support namespaces other than "user".
-	for x := range xattrs {
-		if !strings.HasPrefix(x, linux.XATTR_USER_PREFIX) {
-			delete(xattrs, x)
+	// Always walk the entire list. If listxattr(2) is called with size 0, the
+	// buffer size needed to contain the xattr list will be returned
+	// successfully even if it is nonzero; in that case the list itself isn't
+	// built. Otherwise, names that t can't see are skipped, and only the
+	// remaining names count towards size, so the filesystem can't be allowed
+	// to fail with ERANGE based on the unfiltered list.
+	listSize := 0
+	var names []string
+	add := func(name string) {
+		if !xattrVisible(t, name) {
+			return
+		}
+		listSize += len(name) + 1
+		if size != 0 && listSize <= linux.XATTR_LIST_MAX {
+			names = append(names, name)
 		}
 	}
-
-	listSize := xattrListSize(xattrs)
-	if listSize > linux.XATTR_SIZE_MAX {
-		return 0, syserror.E2BIG
+	_, labeled := staticSELinuxLabel(t, linux.XATTR_NAME_SELINUX)
+	if xattrFileTypeOk(d.Inode) && d.Inode.SupportsXattrs() {
+		// As in getXattr, don't start a read that may block.
+		if t.Interrupted() {
+			return 0, syserror.ERESTARTSYS
+		}
+		if err := d.Inode.WalkXattrs(t, func(name string) {
+			// A static label replaces any stored by the filesystem.
+			if labeled && name == linux.XATTR_NAME_SELINUX {
+				return
+			}
+			add(name)
+		}); err != nil {
+			return 0, syserror.ConvertIntr(err, syserror.ERESTARTSYS)
+		}
 	}
-	if uint64(listSize) > requestedSize {
-		return 0, syserror.ERANGE
+	if labeled {
+		add(linux.XATTR_NAME_SELINUX)
 	}
 
-	// Don't copy out the attributes if size is 0.
 	if size == 0 {
+		// As in Linux, a probe reports the full size even if it exceeds
+		// XATTR_LIST_MAX, in which case the list can't be retrieved.
 		return listSize, nil
 	}
+	if listSize > linux.XATTR_LIST_MAX {
+		// buf only holds a prefix of the list, so it must not be copied
+		// out. Compare Linux's fs/xattr.c:listxattr().
+		if size >= linux.XATTR_LIST_MAX {
+			return 0, syserror.E2BIG
+		}
+		return 0, syserror.ERANGE
+	}
 
+	// Linux doesn't define the order of the list, and it differs between
+	// filesystems. Sort it, so that it doesn't depend on the filesystem or
+	// on the order of a map that may have been rebuilt by checkpoint/restore.
+	sort.Strings(names)
 	buf := make([]byte, 0, listSize)
-	for x := range xattrs {
-		buf = append(buf, []byte(x)...)
+	for _, name := range names {
+		buf = append(buf, name...)
 		buf = append(buf, 0)
 	}
-	if _, err := t.CopyOutBytes(addr, buf); err != nil {
-		return 0, err
-	}
-
-	return len(buf), nil
-}
-
-func xattrListSize(xattrs map[string]struct{}) int {
-	size := 0
-	for x := range xattrs {
-		size += len(x) + 1
-	}
-	return size
+	return copyOutXattrResult(t, addr, buf, size)
 }
 
 // RemoveXattr implements linux syscall removexattr(2).
-func RemoveXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return removeXattrFromPath(t, args, true)
+func RemoveXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrRemoves, err) }()
+	return removeXattrFromPath(t, linux.AT_FDCWD, args, true)
 }
 
 // LRemoveXattr implements linux syscall lremovexattr(2).
-func LRemoveXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return removeXattrFromPath(t, args, false)
+func LRemoveXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrRemoves, err) }()
+	return removeXattrFromPath(t, linux.AT_FDCWD, args, false)
 }
 
 // FRemoveXattr implements linux syscall fremovexattr(2).
-func FRemoveXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+//
+// The arguments are (fd, name). As in Linux, fremovexattr takes no flags and
+// any further arguments are ignored.
+func FRemoveXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrRemoves, err) }()
+
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	fd := args[0].Int()
 	nameAddr := args[1].Pointer()
 
@@ -389,7 +1013,16 @@ func FRemoveXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 	return 0, nil, removeXattr(t, f.Dirent, nameAddr)
 }
 
-func removeXattrFromPath(t *kernel.Task, args arch.SyscallArguments, resolveSymlink bool) (uintptr, *kernel.SyscallControl, error) {
+// removeXattrFromPath implements removexattr(2) and lremovexattr(2) for the
+// path in args, resolved relative to dirFD.
+//
+// The arguments are (path, name). As in Linux, removexattr takes no flags and
+// any further arguments are ignored.
+func removeXattrFromPath(t *kernel.Task, dirFD int32, args arch.SyscallArguments, resolveSymlink bool) (uintptr, *kernel.SyscallControl, error) {
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	pathAddr := args[0].Pointer()
 	nameAddr := args[1].Pointer()
 
@@ -398,7 +1031,7 @@ func removeXattrFromPath(t *kernel.Task, args arch.SyscallArguments, resolveSyml
 		return 0, nil, err
 	}
 
-	return 0, nil, fileOpOn(t, linux.AT_FDCWD, path, resolveSymlink, func(_ *fs.Dirent, d *fs.Dirent, _ uint) error {
+	return 0, nil, fileOpOn(t, dirFD, path, resolveSymlink || dirPath, func(_ *fs.Dirent, d *fs.Dirent, _ uint) error {
 		if dirPath && !fs.IsDir(d.Inode.StableAttr) {
 			return syserror.ENOTDIR
 		}
@@ -409,22 +1042,47 @@ func removeXattrFromPath(t *kernel.Task, args arch.SyscallArguments, resolveSyml
 
 // removeXattr implements removexattr(2) from the given *fs.Dirent.
 func removeXattr(t *kernel.Task, d *fs.Dirent, nameAddr hostarch.Addr) error {
+	if err := d.Inode.CheckWritableMount(); err != nil {
+		return err
+	}
+
 	name, err := copyInXattrName(t, nameAddr)
 	if err != nil {
 		return err
 	}
 
-	if err := checkXattrPermissions(t, d.Inode, fs.PermMask{Write: true}); err != nil {
-		return err
+	if _, ok := staticSELinuxLabel(t, name); ok {
+		return writeStaticSELinuxLabel(t)
 	}
 
-	if !strings.HasPrefix(name, linux.XATTR_USER_PREFIX) {
+	// As in setXattr, reject unsupported namespaces before checking
+	// permissions, and unsupported filesystems after.
+	if !xattrNamespaceWritable(namespaceForName(name)) {
 		return syserror.EOPNOTSUPP
 	}
 
-	if err := d.Inode.RemoveXattr(t, d, name); err != nil {
+	if err := checkXattrPermissions(t, d.Inode, name, fs.PermMask{Write: true}); err != nil {
 		return err
 	}
+
+	if !d.Inode.SupportsXattrs() {
+		return syserror.EOPNOTSUPP
+	}
+
+	return removeInodeXattr(t, d, name)
+}
+
+// removeInodeXattr removes name from d, once removexattr(2) has validated it,
+// and notifies watches of d.
+func removeInodeXattr(ctx context.Context, d *fs.Dirent, name string) error {
+	if err := d.Inode.RemoveXattr(ctx, d, name); err != nil {
+		// As in Linux, removing an ACL that isn't set succeeds.
+		if err != syserror.ENODATA || namespaceForName(name) != xattrNamespacePOSIXACL {
+			// As with SetXattr, an interrupted RemoveXattr leaves the
+			// attribute in place.
+			return syserror.ConvertIntr(err, syserror.ERESTARTSYS)
+		}
+	}
 	d.InotifyEvent(linux.IN_ATTRIB, 0)
 	return nil
 }
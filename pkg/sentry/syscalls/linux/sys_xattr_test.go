@@ -0,0 +1,98 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/syserror"
+)
+
+// failingXattrInodeOperations fails every extended attribute write with err.
+type failingXattrInodeOperations struct {
+	*fs.MockInodeOperations
+	err error
+}
+
+// SetXattr implements fs.InodeOperations.SetXattr.
+func (i *failingXattrInodeOperations) SetXattr(context.Context, *fs.Inode, string, string, uint32) error {
+	return i.err
+}
+
+// RemoveXattr implements fs.InodeOperations.RemoveXattr.
+func (i *failingXattrInodeOperations) RemoveXattr(context.Context, *fs.Inode, string) error {
+	return i.err
+}
+
+func newFailingXattrDirent(t *testing.T, err error) *fs.Dirent {
+	ctx := contexttest.Context(t)
+	ops := &failingXattrInodeOperations{
+		MockInodeOperations: fs.NewMockInodeOperations(ctx),
+		err:                 err,
+	}
+	inode := fs.NewInode(ctx, ops, fs.NewMockMountSource(nil), fs.StableAttr{Type: fs.RegularFile})
+	d := fs.NewDirent(ctx, inode, "file")
+	t.Cleanup(func() { d.DecRef(ctx) })
+	return d
+}
+
+func TestXattrWriteInterrupted(t *testing.T) {
+	ctx := contexttest.Context(t)
+	for _, tc := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{
+			// An interrupted write left the attribute unchanged, so
+			// the syscall is restarted.
+			name: "interrupted",
+			err:  syserror.ErrInterrupted,
+			want: syserror.ERESTARTSYS,
+		},
+		{
+			name: "other error",
+			err:  syserror.ENOSPC,
+			want: syserror.ENOSPC,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newFailingXattrDirent(t, tc.err)
+			if err := setInodeXattr(ctx, d, "user.test", "value", 0 /* flags */); err != tc.want {
+				t.Errorf("setInodeXattr got error %v, want %v", err, tc.want)
+			}
+			if err := removeInodeXattr(ctx, d, "user.test"); err != tc.want {
+				t.Errorf("removeInodeXattr got error %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRemovePOSIXACLNotSet(t *testing.T) {
+	ctx := contexttest.Context(t)
+	d := newFailingXattrDirent(t, syserror.ENODATA)
+
+	// Removing an ACL that isn't set succeeds, but removing any other
+	// attribute that isn't set doesn't.
+	if err := removeInodeXattr(ctx, d, "system.posix_acl_access"); err != nil {
+		t.Errorf("removeInodeXattr of unset ACL failed: %v", err)
+	}
+	if err := removeInodeXattr(ctx, d, "user.test"); err != syserror.ENODATA {
+		t.Errorf("removeInodeXattr of unset attribute got error %v, want %v", err, syserror.ENODATA)
+	}
+}
@@ -16,10 +16,14 @@ package vfs2
 
 import (
 	"bytes"
+	"sort"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/gohacks"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/fsmetric"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/syserror"
@@ -28,16 +32,22 @@ import (
 )
 
 // ListXattr implements Linux syscall listxattr(2).
-func ListXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func ListXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrLists, err) }()
 	return listxattr(t, args, followFinalSymlink)
 }
 
 // Llistxattr implements Linux syscall llistxattr(2).
-func Llistxattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func Llistxattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrLists, err) }()
 	return listxattr(t, args, nofollowFinalSymlink)
 }
 
 func listxattr(t *kernel.Task, args arch.SyscallArguments, shouldFollowFinalSymlink shouldFollowFinalSymlink) (uintptr, *kernel.SyscallControl, error) {
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	pathAddr := args[0].Pointer()
 	listAddr := args[1].Pointer()
 	size := args[2].SizeT()
@@ -54,9 +64,9 @@ func listxattr(t *kernel.Task, args arch.SyscallArguments, shouldFollowFinalSyml
 
 	names, err := t.Kernel().VFS().ListXattrAt(t, t.Credentials(), &tpop.pop, uint64(size))
 	if err != nil {
-		return 0, nil, err
+		return 0, nil, syserror.ConvertIntr(err, syserror.ERESTARTSYS)
 	}
-	n, err := copyOutXattrNameList(t, listAddr, size, names)
+	n, err := copyOutXattrNameList(t, listAddr, size, withStaticSELinuxLabel(t.Kernel(), names))
 	if err != nil {
 		return 0, nil, err
 	}
@@ -64,7 +74,13 @@ func listxattr(t *kernel.Task, args arch.SyscallArguments, shouldFollowFinalSyml
 }
 
 // Flistxattr implements Linux syscall flistxattr(2).
-func Flistxattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func Flistxattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrLists, err) }()
+
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	fd := args[0].Int()
 	listAddr := args[1].Pointer()
 	size := args[2].SizeT()
@@ -75,7 +91,7 @@ func Flistxattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sy
 	}
 	defer file.DecRef(t)
 
-	names, err := file.ListXattr(t, uint64(size))
+	names, err := fileXattrNames(t, t.Kernel(), file, size)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -87,16 +103,22 @@ func Flistxattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sy
 }
 
 // GetXattr implements Linux syscall getxattr(2).
-func GetXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func GetXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrGets, err) }()
 	return getxattr(t, args, followFinalSymlink)
 }
 
 // Lgetxattr implements Linux syscall lgetxattr(2).
-func Lgetxattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func Lgetxattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrGets, err) }()
 	return getxattr(t, args, nofollowFinalSymlink)
 }
 
 func getxattr(t *kernel.Task, args arch.SyscallArguments, shouldFollowFinalSymlink shouldFollowFinalSymlink) (uintptr, *kernel.SyscallControl, error) {
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	pathAddr := args[0].Pointer()
 	nameAddr := args[1].Pointer()
 	valueAddr := args[2].Pointer()
@@ -117,12 +139,19 @@ func getxattr(t *kernel.Task, args arch.SyscallArguments, shouldFollowFinalSymli
 		return 0, nil, err
 	}
 
-	value, err := t.Kernel().VFS().GetXattrAt(t, t.Credentials(), &tpop.pop, &vfs.GetXattrOptions{
-		Name: name,
-		Size: uint64(size),
-	})
-	if err != nil {
-		return 0, nil, err
+	value, ok := staticSELinuxLabel(t.Kernel(), name)
+	if ok {
+		if err := checkPathExists(t, &tpop.pop); err != nil {
+			return 0, nil, err
+		}
+	} else {
+		value, err = t.Kernel().VFS().GetXattrAt(t, t.Credentials(), &tpop.pop, &vfs.GetXattrOptions{
+			Name: name,
+			Size: uint64(size),
+		})
+		if err != nil {
+			return 0, nil, syserror.ConvertIntr(err, syserror.ERESTARTSYS)
+		}
 	}
 	n, err := copyOutXattrValue(t, valueAddr, size, value)
 	if err != nil {
@@ -132,7 +161,13 @@ func getxattr(t *kernel.Task, args arch.SyscallArguments, shouldFollowFinalSymli
 }
 
 // Fgetxattr implements Linux syscall fgetxattr(2).
-func Fgetxattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func Fgetxattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrGets, err) }()
+
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	fd := args[0].Int()
 	nameAddr := args[1].Pointer()
 	valueAddr := args[2].Pointer()
@@ -149,7 +184,7 @@ func Fgetxattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 		return 0, nil, err
 	}
 
-	value, err := file.GetXattr(t, &vfs.GetXattrOptions{Name: name, Size: uint64(size)})
+	value, err := fileXattr(t, t.Kernel(), file, name, size)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -161,16 +196,22 @@ func Fgetxattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 }
 
 // SetXattr implements Linux syscall setxattr(2).
-func SetXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func SetXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrSets, err) }()
 	return 0, nil, setxattr(t, args, followFinalSymlink)
 }
 
 // Lsetxattr implements Linux syscall lsetxattr(2).
-func Lsetxattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func Lsetxattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrSets, err) }()
 	return 0, nil, setxattr(t, args, nofollowFinalSymlink)
 }
 
 func setxattr(t *kernel.Task, args arch.SyscallArguments, shouldFollowFinalSymlink shouldFollowFinalSymlink) error {
+	if err := limitXattrRate(t); err != nil {
+		return err
+	}
+
 	pathAddr := args[0].Pointer()
 	nameAddr := args[1].Pointer()
 	valueAddr := args[2].Pointer()
@@ -195,20 +236,37 @@ func setxattr(t *kernel.Task, args arch.SyscallArguments, shouldFollowFinalSymli
 	if err != nil {
 		return err
 	}
+	if _, ok := staticSELinuxLabel(t.Kernel(), name); ok {
+		if err := checkPathExists(t, &tpop.pop); err != nil {
+			return err
+		}
+		return writeStaticSELinuxLabel(t.Kernel())
+	}
+	if !knownXattrNamespace(name) {
+		return syserror.EOPNOTSUPP
+	}
 	value, err := copyInXattrValue(t, valueAddr, size)
 	if err != nil {
 		return err
 	}
 
-	return t.Kernel().VFS().SetXattrAt(t, t.Credentials(), &tpop.pop, &vfs.SetXattrOptions{
+	// An interrupted SetXattrAt leaves the attribute unchanged, so the
+	// syscall can be restarted with the same arguments.
+	return syserror.ConvertIntr(t.Kernel().VFS().SetXattrAt(t, t.Credentials(), &tpop.pop, &vfs.SetXattrOptions{
 		Name:  name,
 		Value: value,
 		Flags: uint32(flags),
-	})
+	}), syserror.ERESTARTSYS)
 }
 
 // Fsetxattr implements Linux syscall fsetxattr(2).
-func Fsetxattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func Fsetxattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrSets, err) }()
+
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	fd := args[0].Int()
 	nameAddr := args[1].Pointer()
 	valueAddr := args[2].Pointer()
@@ -229,29 +287,41 @@ func Fsetxattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 	if err != nil {
 		return 0, nil, err
 	}
+	if _, ok := staticSELinuxLabel(t.Kernel(), name); ok {
+		return 0, nil, writeStaticSELinuxLabel(t.Kernel())
+	}
+	if !knownXattrNamespace(name) {
+		return 0, nil, syserror.EOPNOTSUPP
+	}
 	value, err := copyInXattrValue(t, valueAddr, size)
 	if err != nil {
 		return 0, nil, err
 	}
 
-	return 0, nil, file.SetXattr(t, &vfs.SetXattrOptions{
+	return 0, nil, syserror.ConvertIntr(file.SetXattr(t, &vfs.SetXattrOptions{
 		Name:  name,
 		Value: value,
 		Flags: uint32(flags),
-	})
+	}), syserror.ERESTARTSYS)
 }
 
 // RemoveXattr implements Linux syscall removexattr(2).
-func RemoveXattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func RemoveXattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrRemoves, err) }()
 	return 0, nil, removexattr(t, args, followFinalSymlink)
 }
 
 // Lremovexattr implements Linux syscall lremovexattr(2).
-func Lremovexattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func Lremovexattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrRemoves, err) }()
 	return 0, nil, removexattr(t, args, nofollowFinalSymlink)
 }
 
 func removexattr(t *kernel.Task, args arch.SyscallArguments, shouldFollowFinalSymlink shouldFollowFinalSymlink) error {
+	if err := limitXattrRate(t); err != nil {
+		return err
+	}
+
 	pathAddr := args[0].Pointer()
 	nameAddr := args[1].Pointer()
 
@@ -269,12 +339,27 @@ func removexattr(t *kernel.Task, args arch.SyscallArguments, shouldFollowFinalSy
 	if err != nil {
 		return err
 	}
+	if _, ok := staticSELinuxLabel(t.Kernel(), name); ok {
+		if err := checkPathExists(t, &tpop.pop); err != nil {
+			return err
+		}
+		return writeStaticSELinuxLabel(t.Kernel())
+	}
+	if !knownXattrNamespace(name) {
+		return syserror.EOPNOTSUPP
+	}
 
-	return t.Kernel().VFS().RemoveXattrAt(t, t.Credentials(), &tpop.pop, name)
+	return syserror.ConvertIntr(t.Kernel().VFS().RemoveXattrAt(t, t.Credentials(), &tpop.pop, name), syserror.ERESTARTSYS)
 }
 
 // Fremovexattr implements Linux syscall fremovexattr(2).
-func Fremovexattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+func Fremovexattr(t *kernel.Task, args arch.SyscallArguments) (_ uintptr, _ *kernel.SyscallControl, err error) {
+	defer func() { fsmetric.RecordXattr(fsmetric.XattrRemoves, err) }()
+
+	if err := limitXattrRate(t); err != nil {
+		return 0, nil, err
+	}
+
 	fd := args[0].Int()
 	nameAddr := args[1].Pointer()
 
@@ -288,8 +373,14 @@ func Fremovexattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 	if err != nil {
 		return 0, nil, err
 	}
+	if _, ok := staticSELinuxLabel(t.Kernel(), name); ok {
+		return 0, nil, writeStaticSELinuxLabel(t.Kernel())
+	}
+	if !knownXattrNamespace(name) {
+		return 0, nil, syserror.EOPNOTSUPP
+	}
 
-	return 0, nil, file.RemoveXattr(t, name)
+	return 0, nil, syserror.ConvertIntr(file.RemoveXattr(t, name), syserror.ERESTARTSYS)
 }
 
 func copyInXattrName(t *kernel.Task, nameAddr hostarch.Addr) (string, error) {
@@ -303,15 +394,126 @@ func copyInXattrName(t *kernel.Task, nameAddr hostarch.Addr) (string, error) {
 	if len(name) == 0 {
 		return "", syserror.ERANGE
 	}
+	// Names must not consist solely of a namespace prefix. Compare Linux's
+	// fs/xattr.c:xattr_resolve_name().
+	if name == linux.XATTR_USER_PREFIX || name == linux.XATTR_TRUSTED_PREFIX {
+		return "", syserror.EINVAL
+	}
+	// The sandbox may restrict applications to some namespaces, regardless
+	// of their privileges.
+	if !t.Kernel().XattrNamespaceAllowed(name) {
+		return "", syserror.EOPNOTSUPP
+	}
 	return name, nil
 }
 
+// knownXattrNamespace returns true if name is in a namespace that some
+// filesystem may support. setxattr checks this before copying in the value, so
+// that a bad value pointer can't mask EOPNOTSUPP; Linux copies in the value
+// first, and so returns EFAULT in that case. removexattr checks it at the same
+// point, so that both report unknown namespaces before permission errors.
+func knownXattrNamespace(name string) bool {
+	return strings.HasPrefix(name, linux.XATTR_USER_PREFIX) ||
+		strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX) ||
+		strings.HasPrefix(name, linux.XATTR_SECURITY_PREFIX) ||
+		strings.HasPrefix(name, linux.XATTR_SYSTEM_PREFIX)
+}
+
+// limitXattrRate throttles t's extended attribute syscalls, if the sandbox is
+// configured to do so. It must be called before any other work is done.
+func limitXattrRate(t *kernel.Task) error {
+	return syserror.ConvertIntr(t.LimitXattrRate(), syserror.ERESTARTSYS)
+}
+
+// selinuxLabelConfig is the static SELinux label configuration of the
+// sandbox. It is implemented by *kernel.Kernel, and lets the helpers below be
+// tested without one.
+type selinuxLabelConfig interface {
+	SELinuxLabel() string
+	IgnoreSELinuxLabelWrites() bool
+}
+
+// staticSELinuxLabel returns the static SELinux label configured for the
+// sandbox, and true if name is security.selinux and a label is configured, in
+// which case the label is used in place of any the filesystem may store.
+func staticSELinuxLabel(c selinuxLabelConfig, name string) (string, bool) {
+	label := c.SELinuxLabel()
+	return label, label != "" && name == linux.XATTR_NAME_SELINUX
+}
+
+// writeStaticSELinuxLabel implements setxattr(2) and removexattr(2) of a
+// static SELinux label, which can't be changed. Depending on the sandbox
+// configuration, attempts to do so either fail or are silently ignored.
+func writeStaticSELinuxLabel(c selinuxLabelConfig) error {
+	if c.IgnoreSELinuxLabelWrites() {
+		return nil
+	}
+	return syserror.EOPNOTSUPP
+}
+
+// withStaticSELinuxLabel returns names, a list of extended attribute names,
+// with security.selinux included if a static SELinux label is configured.
+func withStaticSELinuxLabel(c selinuxLabelConfig, names []string) []string {
+	if _, ok := staticSELinuxLabel(c, linux.XATTR_NAME_SELINUX); !ok {
+		return names
+	}
+	for _, name := range names {
+		if name == linux.XATTR_NAME_SELINUX {
+			return names
+		}
+	}
+	return append(names, linux.XATTR_NAME_SELINUX)
+}
+
+// fileXattr returns the value of file's extended attribute name for
+// fgetxattr(2), where size is the size of the user's buffer.
+func fileXattr(ctx context.Context, c selinuxLabelConfig, file *vfs.FileDescription, name string, size uint) (string, error) {
+	if label, ok := staticSELinuxLabel(c, name); ok {
+		return label, nil
+	}
+	value, err := file.GetXattr(ctx, &vfs.GetXattrOptions{Name: name, Size: uint64(size)})
+	if err != nil {
+		// Reads have no side effects, so they can always be restarted.
+		return "", syserror.ConvertIntr(err, syserror.ERESTARTSYS)
+	}
+	return value, nil
+}
+
+// fileXattrNames returns the names of file's extended attributes for
+// flistxattr(2), where size is the size of the user's buffer.
+func fileXattrNames(ctx context.Context, c selinuxLabelConfig, file *vfs.FileDescription, size uint) ([]string, error) {
+	names, err := file.ListXattr(ctx, uint64(size))
+	if err != nil {
+		return nil, syserror.ConvertIntr(err, syserror.ERESTARTSYS)
+	}
+	return withStaticSELinuxLabel(c, names), nil
+}
+
+// checkPathExists returns an error if pop can't be resolved. Since a static
+// SELinux label isn't stored by any filesystem, operations on it use this to
+// fail in the same way as other extended attribute operations on a missing
+// or inaccessible file.
+func checkPathExists(t *kernel.Task, pop *vfs.PathOperation) error {
+	vd, err := t.Kernel().VFS().GetDentryAt(t, t.Credentials(), pop, &vfs.GetDentryOptions{})
+	if err != nil {
+		return err
+	}
+	vd.DecRef(t)
+	return nil
+}
+
 func copyOutXattrNameList(t *kernel.Task, listAddr hostarch.Addr, size uint, names []string) (int, error) {
 	if size > linux.XATTR_LIST_MAX {
 		size = linux.XATTR_LIST_MAX
 	}
+	// Linux doesn't define the order of the list, and it differs between
+	// filesystems. Sort it, so that it doesn't depend on the filesystem.
+	sort.Strings(names)
 	var buf bytes.Buffer
 	for _, name := range names {
+		if !t.Kernel().XattrNamespaceAllowed(name) {
+			continue
+		}
 		buf.WriteString(name)
 		buf.WriteByte(0)
 	}
@@ -329,6 +531,8 @@ func copyOutXattrNameList(t *kernel.Task, listAddr hostarch.Addr, size uint, nam
 }
 
 func copyInXattrValue(t *kernel.Task, valueAddr hostarch.Addr, size uint) (string, error) {
+	// size_t and uint are both 64 bits wide on every supported architecture,
+	// so size is exactly what the application passed.
 	if size > linux.XATTR_SIZE_MAX {
 		return "", syserror.E2BIG
 	}
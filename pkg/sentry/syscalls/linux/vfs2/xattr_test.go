@@ -0,0 +1,274 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs2
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserror"
+)
+
+// testLabelConfig implements selinuxLabelConfig.
+type testLabelConfig struct {
+	label        string
+	ignoreWrites bool
+}
+
+// SELinuxLabel implements selinuxLabelConfig.SELinuxLabel.
+func (c testLabelConfig) SELinuxLabel() string {
+	return c.label
+}
+
+// IgnoreSELinuxLabelWrites implements
+// selinuxLabelConfig.IgnoreSELinuxLabelWrites.
+func (c testLabelConfig) IgnoreSELinuxLabelWrites() bool {
+	return c.ignoreWrites
+}
+
+// xattrTestFD is a FileDescriptionImpl whose extended attributes are xattrs,
+// or whose extended attribute operations fail with err if it is set.
+type xattrTestFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.NoLockFD
+
+	xattrs map[string]string
+	err    error
+}
+
+func newXattrTestFD(t *testing.T, xattrs map[string]string, err error) *vfs.FileDescription {
+	ctx := contexttest.Context(t)
+	vfsObj := &vfs.VirtualFilesystem{}
+	if err := vfsObj.Init(ctx); err != nil {
+		t.Fatalf("VFS init: %v", err)
+	}
+	vd := vfsObj.NewAnonVirtualDentry("xattrTestFD")
+	defer vd.DecRef(ctx)
+	fd := &xattrTestFD{xattrs: xattrs, err: err}
+	fd.vfsfd.Init(fd, linux.O_RDONLY, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{})
+	t.Cleanup(func() { fd.vfsfd.DecRef(ctx) })
+	return &fd.vfsfd
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *xattrTestFD) Release(context.Context) {}
+
+// Stat implements vfs.FileDescriptionImpl.Stat.
+func (fd *xattrTestFD) Stat(context.Context, vfs.StatOptions) (linux.Statx, error) {
+	return linux.Statx{}, nil
+}
+
+// SetStat implements vfs.FileDescriptionImpl.SetStat.
+func (fd *xattrTestFD) SetStat(context.Context, vfs.SetStatOptions) error {
+	return syserror.EPERM
+}
+
+// GetXattr implements vfs.FileDescriptionImpl.GetXattr.
+func (fd *xattrTestFD) GetXattr(_ context.Context, opts vfs.GetXattrOptions) (string, error) {
+	if fd.err != nil {
+		return "", fd.err
+	}
+	value, ok := fd.xattrs[opts.Name]
+	if !ok {
+		return "", syserror.ENODATA
+	}
+	return value, nil
+}
+
+// ListXattr implements vfs.FileDescriptionImpl.ListXattr.
+func (fd *xattrTestFD) ListXattr(context.Context, uint64) ([]string, error) {
+	if fd.err != nil {
+		return nil, fd.err
+	}
+	names := make([]string, 0, len(fd.xattrs))
+	for name := range fd.xattrs {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func TestFileXattrInterrupted(t *testing.T) {
+	ctx := contexttest.Context(t)
+	for _, tc := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{
+			// Reads are restarted if they are interrupted.
+			name: "interrupted",
+			err:  syserror.ErrInterrupted,
+			want: syserror.ERESTARTSYS,
+		},
+		{
+			name: "other error",
+			err:  syserror.EIO,
+			want: syserror.EIO,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			file := newXattrTestFD(t, nil, tc.err)
+			if _, err := fileXattr(ctx, testLabelConfig{}, file, "user.test", 0 /* size */); err != tc.want {
+				t.Errorf("fileXattr got error %v, want %v", err, tc.want)
+			}
+			if _, err := fileXattrNames(ctx, testLabelConfig{}, file, 0 /* size */); err != tc.want {
+				t.Errorf("fileXattrNames got error %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+const testLabel = "system_u:object_r:container_file_t:s0"
+
+func TestFileXattrStaticLabel(t *testing.T) {
+	ctx := contexttest.Context(t)
+	file := newXattrTestFD(t, map[string]string{
+		linux.XATTR_NAME_SELINUX: "stored",
+		"user.test":              "value",
+	}, nil)
+
+	for _, tc := range []struct {
+		name   string
+		config testLabelConfig
+		want   string
+	}{
+		{
+			name: "no label",
+			want: "stored",
+		},
+		{
+			// The label replaces the one stored by the filesystem.
+			name:   "label",
+			config: testLabelConfig{label: testLabel},
+			want:   testLabel,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := fileXattr(ctx, tc.config, file, linux.XATTR_NAME_SELINUX, linux.XATTR_SIZE_MAX); err != nil || got != tc.want {
+				t.Errorf("fileXattr(%q) got (%q, %v), want (%q, nil)", linux.XATTR_NAME_SELINUX, got, err, tc.want)
+			}
+			// Other attributes are unaffected.
+			if got, err := fileXattr(ctx, tc.config, file, "user.test", linux.XATTR_SIZE_MAX); err != nil || got != "value" {
+				t.Errorf("fileXattr(%q) got (%q, %v), want (%q, nil)", "user.test", got, err, "value")
+			}
+		})
+	}
+
+	// The label applies even if the file can't store attributes.
+	unsupported := newXattrTestFD(t, nil, syserror.EOPNOTSUPP)
+	if got, err := fileXattr(ctx, testLabelConfig{label: testLabel}, unsupported, linux.XATTR_NAME_SELINUX, linux.XATTR_SIZE_MAX); err != nil || got != testLabel {
+		t.Errorf("fileXattr on unsupported file got (%q, %v), want (%q, nil)", got, err, testLabel)
+	}
+}
+
+func TestFileXattrNamesStaticLabel(t *testing.T) {
+	ctx := contexttest.Context(t)
+	config := testLabelConfig{label: testLabel}
+	for _, tc := range []struct {
+		name   string
+		xattrs map[string]string
+		want   []string
+	}{
+		{
+			name:   "added",
+			xattrs: map[string]string{"user.test": "value"},
+			want:   []string{linux.XATTR_NAME_SELINUX, "user.test"},
+		},
+		{
+			// A label stored by the filesystem isn't listed twice.
+			name: "stored",
+			xattrs: map[string]string{
+				linux.XATTR_NAME_SELINUX: "stored",
+				"user.test":              "value",
+			},
+			want: []string{linux.XATTR_NAME_SELINUX, "user.test"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			file := newXattrTestFD(t, tc.xattrs, nil)
+			got, err := fileXattrNames(ctx, config, file, linux.XATTR_LIST_MAX)
+			if err != nil {
+				t.Fatalf("fileXattrNames failed: %v", err)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("fileXattrNames got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	// Without a label, only the stored names are listed.
+	file := newXattrTestFD(t, map[string]string{"user.test": "value"}, nil)
+	got, err := fileXattrNames(ctx, testLabelConfig{}, file, linux.XATTR_LIST_MAX)
+	if want := []string{"user.test"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("fileXattrNames without label got (%v, %v), want (%v, nil)", got, err, want)
+	}
+}
+
+func TestWriteStaticLabel(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config testLabelConfig
+		xattr  string
+		static bool
+		want   error
+	}{
+		{
+			name:   "no label",
+			xattr:  linux.XATTR_NAME_SELINUX,
+			static: false,
+		},
+		{
+			name:   "other attribute",
+			config: testLabelConfig{label: testLabel},
+			xattr:  "security.test",
+			static: false,
+		},
+		{
+			name:   "label",
+			config: testLabelConfig{label: testLabel},
+			xattr:  linux.XATTR_NAME_SELINUX,
+			static: true,
+			want:   syserror.EOPNOTSUPP,
+		},
+		{
+			name:   "label ignoring writes",
+			config: testLabelConfig{label: testLabel, ignoreWrites: true},
+			xattr:  linux.XATTR_NAME_SELINUX,
+			static: true,
+			want:   nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// setxattr(2) and removexattr(2) only pass static labels to
+			// writeStaticSELinuxLabel.
+			if _, static := staticSELinuxLabel(tc.config, tc.xattr); static != tc.static {
+				t.Fatalf("staticSELinuxLabel(%q) got %t, want %t", tc.xattr, static, tc.static)
+			}
+			if !tc.static {
+				return
+			}
+			if err := writeStaticSELinuxLabel(tc.config); err != tc.want {
+				t.Errorf("writeStaticSELinuxLabel got error %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
@@ -38,6 +38,7 @@ var (
 	ECONNREFUSED = error(unix.ECONNREFUSED)
 	ECONNRESET   = error(unix.ECONNRESET)
 	EDEADLK      = error(unix.EDEADLK)
+	EDQUOT       = error(unix.EDQUOT)
 	EEXIST       = error(unix.EEXIST)
 	EFAULT       = error(unix.EFAULT)
 	EFBIG        = error(unix.EFBIG)
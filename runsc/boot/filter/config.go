@@ -70,9 +70,15 @@ var allowedSyscalls = seccomp.SyscallRules{
 			seccomp.EqualTo(unix.F_GETFD),
 		},
 	},
-	unix.SYS_FSTAT:     {},
-	unix.SYS_FSYNC:     {},
-	unix.SYS_FTRUNCATE: {},
+	// The xattr syscalls are used on host-backed files, and only ever with
+	// names in the user namespace.
+	unix.SYS_FGETXATTR:    {},
+	unix.SYS_FLISTXATTR:   {},
+	unix.SYS_FREMOVEXATTR: {},
+	unix.SYS_FSETXATTR:    {},
+	unix.SYS_FSTAT:        {},
+	unix.SYS_FSYNC:        {},
+	unix.SYS_FTRUNCATE:    {},
 	unix.SYS_FUTEX: []seccomp.Rule{
 		{
 			seccomp.MatchAny{},
@@ -344,6 +344,11 @@ func New(args Args) (*Loader, error) {
 		RootIPCNamespace:            kernel.NewIPCNamespace(creds.UserNamespace),
 		RootAbstractSocketNamespace: kernel.NewAbstractSocketNamespace(),
 		PIDNamespace:                kernel.NewRootPIDNamespace(creds.UserNamespace),
+		AllowedXattrNamespaces:      args.Conf.AllowedXattrNamespaces(),
+		SELinuxLabel:                args.Conf.SELinuxLabel,
+		IgnoreSELinuxLabelWrites:    args.Conf.SELinuxLabelIgnoreWrites,
+		XattrRateLimit:              args.Conf.XattrRateLimit,
+		XattrRateLimitBlock:         args.Conf.XattrRateLimitBlock,
 	}); err != nil {
 		return nil, fmt.Errorf("initializing kernel: %w", err)
 	}
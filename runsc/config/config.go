@@ -19,7 +19,9 @@ package config
 
 import (
 	"fmt"
+	"strings"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/refs"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
 )
@@ -178,6 +180,30 @@ type Config struct {
 	// Mounts the cgroup filesystem backed by the sentry's cgroupfs.
 	Cgroupfs bool `flag:"cgroupfs"`
 
+	// XattrNamespaces is the set of extended attribute namespaces
+	// (comma-separated values, e.g. "user,security") that applications may
+	// access, even if they are privileged. If empty, all namespaces are
+	// allowed.
+	XattrNamespaces string `flag:"xattr-namespaces"`
+
+	// SELinuxLabel is a static SELinux context returned verbatim for the
+	// security.selinux extended attribute of every file. If empty, no label
+	// is synthesized.
+	SELinuxLabel string `flag:"selinux-label"`
+
+	// SELinuxLabelIgnoreWrites causes attempts to set or remove
+	// security.selinux to succeed without effect, rather than failing with
+	// EOPNOTSUPP. It requires SELinuxLabel.
+	SELinuxLabelIgnoreWrites bool `flag:"selinux-label-ignore-writes"`
+
+	// XattrRateLimit is the maximum number of extended attribute syscalls
+	// that each task may make per second. If 0, the rate is unlimited.
+	XattrRateLimit int `flag:"xattr-rate-limit"`
+
+	// XattrRateLimitBlock causes tasks that exceed XattrRateLimit to block
+	// until they may proceed, rather than failing with EAGAIN.
+	XattrRateLimitBlock bool `flag:"xattr-rate-limit-block"`
+
 	// TestOnlyAllowRunAsCurrentUserWithoutChroot should only be used in
 	// tests. It allows runsc to start the sandbox process as the current
 	// user, and without chrooting the sandbox process. This can be
@@ -199,9 +225,34 @@ func (c *Config) validate() error {
 	if c.NumNetworkChannels <= 0 {
 		return fmt.Errorf("num_network_channels must be > 0, got: %d", c.NumNetworkChannels)
 	}
+	for _, ns := range c.AllowedXattrNamespaces() {
+		switch ns {
+		case "security", "system", "trusted", "user":
+		default:
+			return fmt.Errorf("invalid xattr namespace %q", ns)
+		}
+	}
+	if len(c.SELinuxLabel) > linux.XATTR_SIZE_MAX {
+		return fmt.Errorf("selinux-label must be at most %d bytes, got: %d", linux.XATTR_SIZE_MAX, len(c.SELinuxLabel))
+	}
+	if c.SELinuxLabelIgnoreWrites && len(c.SELinuxLabel) == 0 {
+		return fmt.Errorf("selinux-label-ignore-writes requires selinux-label")
+	}
+	if c.XattrRateLimit < 0 {
+		return fmt.Errorf("xattr-rate-limit must be >= 0, got: %d", c.XattrRateLimit)
+	}
 	return nil
 }
 
+// AllowedXattrNamespaces returns the extended attribute namespaces listed in
+// c.XattrNamespaces, or nil if all namespaces are allowed.
+func (c *Config) AllowedXattrNamespaces() []string {
+	if len(c.XattrNamespaces) == 0 {
+		return nil
+	}
+	return strings.Split(c.XattrNamespaces, ",")
+}
+
 // FileAccessType tells how the filesystem is accessed.
 type FileAccessType int
 
@@ -15,6 +15,7 @@
 package config
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
@@ -169,6 +170,34 @@ func TestValidationFail(t *testing.T) {
 			},
 			error: "num_network_channels must be > 0",
 		},
+		{
+			name: "xattr-namespaces",
+			flags: map[string]string{
+				"xattr-namespaces": "user,foo",
+			},
+			error: `invalid xattr namespace "foo"`,
+		},
+		{
+			name: "selinux-label-ignore-writes",
+			flags: map[string]string{
+				"selinux-label-ignore-writes": "true",
+			},
+			error: "selinux-label-ignore-writes requires selinux-label",
+		},
+		{
+			name: "selinux-label",
+			flags: map[string]string{
+				"selinux-label": strings.Repeat("a", 65537),
+			},
+			error: "selinux-label must be at most 65536 bytes",
+		},
+		{
+			name: "xattr-rate-limit",
+			flags: map[string]string{
+				"xattr-rate-limit": "-1",
+			},
+			error: "xattr-rate-limit must be >= 0",
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			for name, val := range tc.flags {
@@ -184,6 +213,27 @@ func TestValidationFail(t *testing.T) {
 	}
 }
 
+func TestAllowedXattrNamespaces(t *testing.T) {
+	c, err := NewFromFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.AllowedXattrNamespaces(); got != nil {
+		t.Errorf("AllowedXattrNamespaces() got %v by default, want nil", got)
+	}
+
+	flag.CommandLine.Lookup("xattr-namespaces").Value.Set("user,security")
+	defer setDefault("xattr-namespaces")
+	c, err = NewFromFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"user", "security"}
+	if got := c.AllowedXattrNamespaces(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AllowedXattrNamespaces() got %v, want %v", got, want)
+	}
+}
+
 func TestOverride(t *testing.T) {
 	c, err := NewFromFlags()
 	if err != nil {
@@ -270,3 +320,26 @@ func TestOverrideError(t *testing.T) {
 		})
 	}
 }
+
+func TestSELinuxLabel(t *testing.T) {
+	c, err := NewFromFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.SELinuxLabel != "" || c.SELinuxLabelIgnoreWrites {
+		t.Errorf("SELinuxLabel, SELinuxLabelIgnoreWrites got %q, %t by default, want \"\", false", c.SELinuxLabel, c.SELinuxLabelIgnoreWrites)
+	}
+
+	const label = "system_u:object_r:container_file_t:s0"
+	flag.CommandLine.Lookup("selinux-label").Value.Set(label)
+	defer setDefault("selinux-label")
+	flag.CommandLine.Lookup("selinux-label-ignore-writes").Value.Set("true")
+	defer setDefault("selinux-label-ignore-writes")
+	c, err = NewFromFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.SELinuxLabel != label || !c.SELinuxLabelIgnoreWrites {
+		t.Errorf("SELinuxLabel, SELinuxLabelIgnoreWrites got %q, %t, want %q, true", c.SELinuxLabel, c.SELinuxLabelIgnoreWrites, label)
+	}
+}
@@ -77,6 +77,11 @@ func RegisterFlags() {
 		flag.Bool("vfs2", false, "enables VFSv2. This uses the new VFS layer that is faster than the previous one.")
 		flag.Bool("fuse", false, "TEST ONLY; use while FUSE in VFSv2 is landing. This allows the use of the new experimental FUSE filesystem.")
 		flag.Bool("cgroupfs", false, "Automatically mount cgroupfs.")
+		flag.String("xattr-namespaces", "", "comma-separated list of extended attribute namespaces (security, system, trusted, user) that applications may access. If empty, all namespaces are allowed.")
+		flag.String("selinux-label", "", "static SELinux context returned for the security.selinux extended attribute of every file.")
+		flag.Bool("selinux-label-ignore-writes", false, "allow applications to set or remove security.selinux without effect when --selinux-label is set, instead of failing with EOPNOTSUPP.")
+		flag.Int("xattr-rate-limit", 0, "maximum number of extended attribute syscalls that each task may make per second. 0 means unlimited.")
+		flag.Bool("xattr-rate-limit-block", false, "block tasks that exceed --xattr-rate-limit until they may proceed, instead of failing with EAGAIN.")
 
 		// Flags that control sandbox runtime behavior: network related.
 		flag.Var(networkTypePtr(NetworkSandbox), "network", "specifies which network to use: sandbox (default), host, none. Using network inside the sandbox is more secure because it's isolated from the host network.")
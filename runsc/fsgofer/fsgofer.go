@@ -813,10 +813,12 @@ func (l *localFile) GetXattr(name string, size uint64) (string, error) {
 		return "", unix.EOPNOTSUPP
 	}
 	buffer := make([]byte, size)
-	if _, err := unix.Fgetxattr(l.file.FD(), name, buffer); err != nil {
+	n, err := unix.Fgetxattr(l.file.FD(), name, buffer)
+	if err != nil {
 		return "", err
 	}
-	return string(buffer), nil
+	// Values are opaque bytes, and may be shorter than the buffer.
+	return string(buffer[:n]), nil
 }
 
 func (l *localFile) SetXattr(name string, value string, flags uint32) error {
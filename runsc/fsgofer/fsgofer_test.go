@@ -601,6 +601,25 @@ func TestSetGetXattr(t *testing.T) {
 	})
 }
 
+func TestGetXattrOpaqueValue(t *testing.T) {
+	runCustom(t, []uint32{unix.S_IFREG}, []Config{{ROMount: false, EnableVerityXattr: true}}, func(t *testing.T, s state) {
+		name := "user.merkle.offset"
+		value := "\x00a\x00b\x00"
+		if err := s.file.SetXattr(name, value, 0 /* flags */); err != nil {
+			t.Fatalf("%v: SetXattr failed, err: %v", s, err)
+		}
+		// The value is returned exactly, with its NULs and without padding
+		// to the buffer size.
+		got, err := s.file.GetXattr(name, 100)
+		if err != nil {
+			t.Fatalf("%v: GetXattr failed, err: %v", s, err)
+		}
+		if got != value {
+			t.Errorf("%v: GetXattr got %q, want %q", s, got, value)
+		}
+	})
+}
+
 func TestLink(t *testing.T) {
 	if !specutils.HasCapabilities(capability.CAP_DAC_READ_SEARCH) {
 		t.Skipf("Link test requires CAP_DAC_READ_SEARCH, running as %d", os.Getuid())
@@ -16,9 +16,14 @@
 
 #include <errno.h>
 #include <fcntl.h>
+#include <linux/capability.h>
+#include <string.h>
 #include <sys/eventfd.h>
+#include <sys/mount.h>
 #include <sys/resource.h>
+#include <sys/syscall.h>
 #include <sys/time.h>
+#include <sys/xattr.h>
 #include <unistd.h>
 
 #include <iostream>
@@ -27,6 +32,7 @@
 #include <vector>
 
 #include "gtest/gtest.h"
+#include "absl/flags/flag.h"
 #include "absl/strings/match.h"
 #include "absl/strings/numbers.h"
 #include "absl/strings/str_cat.h"
@@ -34,14 +40,18 @@
 #include "absl/strings/string_view.h"
 #include "absl/synchronization/mutex.h"
 #include "absl/types/optional.h"
+#include "test/util/capability_util.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/fs_util.h"
+#include "test/util/mount_util.h"
 #include "test/util/multiprocess_util.h"
 #include "test/util/posix_error.h"
 #include "test/util/temp_path.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
 
+ABSL_FLAG(int32_t, scratch_uid, 65534, "scratch UID");
+
 namespace gvisor {
 namespace testing {
 
@@ -483,6 +493,61 @@ TEST(ExecStateTest, ItimerPreserved) {
   kill.Release();
 }
 
+// File capabilities are ignored for executables on nosuid mounts, though they
+// can still be read. Compare Linux's security/commoncap.c:get_file_caps().
+TEST(ExecStateTest, FileCapsIgnoredOnNosuidMount) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SETFCAP)));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SETUID)));
+
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir.path(), "tmpfs", MS_NOSUID, "mode=0755", 0));
+
+  const std::string contents =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents(RunfilePath(kStateWorkload)));
+  auto const file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(dir.path(), contents, 0755));
+
+  // Equivalent to "setcap cap_net_raw+ep".
+  struct vfs_cap_data caps = {};
+  caps.magic_etc = VFS_CAP_REVISION_2 | VFS_CAP_FLAGS_EFFECTIVE;
+  caps.data[0].permitted = 1 << CAP_NET_RAW;
+  ASSERT_THAT(setxattr(file.path().c_str(), "security.capability", &caps,
+                       XATTR_CAPS_SZ_2, /*flags=*/0),
+              SyscallSucceeds());
+
+  struct vfs_cap_data got = {};
+  EXPECT_THAT(getxattr(file.path().c_str(), "security.capability", &got,
+                       sizeof(got)),
+              SyscallSucceedsWithValue(XATTR_CAPS_SZ_2));
+  EXPECT_EQ(memcmp(&got, &caps, XATTR_CAPS_SZ_2), 0);
+
+  // Drop all capabilities before execve, so that any the workload has come
+  // from the file. Use syscall instead of glibc's setresuid, which isn't safe
+  // to call after fork.
+  const int uid = absl::GetFlag(FLAGS_scratch_uid);
+  auto drop_privileges = [uid] {
+    if (syscall(SYS_setresuid, uid, uid, uid) < 0) {
+      _exit(errno);
+    }
+  };
+
+  ExecveArray argv = {file.path(), "CheckNoCaps"};
+  pid_t child;
+  int execve_errno;
+  auto kill = ASSERT_NO_ERRNO_AND_VALUE(ForkAndExec(
+      file.path(), argv, {}, drop_privileges, &child, &execve_errno));
+  ASSERT_EQ(0, execve_errno);
+
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(child, &status, 0), SyscallSucceeds());
+  EXPECT_EQ(0, status);
+
+  // Process cleanup no longer needed.
+  kill.Release();
+}
+
 TEST(ProcSelfExe, ChangesAcrossExecve) {
   // See exec_proc_exe_workload for more details. We simply
   // assert that the /proc/self/exe link changes across execve.
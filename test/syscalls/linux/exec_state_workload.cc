@@ -12,12 +12,14 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <linux/capability.h>
 #include <signal.h>
 #include <stdint.h>
 #include <stdio.h>
 #include <stdlib.h>
 #include <sys/auxv.h>
 #include <sys/prctl.h>
+#include <sys/syscall.h>
 #include <sys/time.h>
 
 #include <iostream>
@@ -99,6 +101,26 @@ int CheckItimerEnabled(uint32_t timer) {
   return 0;
 }
 
+// Verify that the process has no permitted or effective capabilities.
+int CheckNoCaps() {
+  struct __user_cap_header_struct header = {_LINUX_CAPABILITY_VERSION_3, 0};
+  struct __user_cap_data_struct caps[_LINUX_CAPABILITY_U32S_3] = {};
+  int ret = syscall(SYS_capget, &header, &caps);
+  if (ret < 0) {
+    perror("capget");
+    return 1;
+  }
+
+  for (const auto& c : caps) {
+    if (c.permitted || c.effective) {
+      std::cerr << "unexpected capabilities: permitted " << std::hex
+                << c.permitted << " effective " << c.effective << std::endl;
+      return 1;
+    }
+  }
+  return 0;
+}
+
 int PrintExecFn() {
   unsigned long execfn = getauxval(AT_EXECFN);
   if (!execfn) {
@@ -127,6 +149,7 @@ void usage(const std::string& prog) {
             << "\t" << prog << " CheckSigHandler <signo> <handler addr (hex)>\n"
             << "\t" << prog << " CheckSigBlocked <signo>\n"
             << "\t" << prog << " CheckTimerDisabled <timer>\n"
+            << "\t" << prog << " CheckNoCaps\n"
             << "\t" << prog << " PrintExecFn\n"
             << "\t" << prog << " PrintExecName" << std::endl;
 }
@@ -190,6 +213,10 @@ int main(int argc, char** argv) {
     return CheckItimerEnabled(timer);
   }
 
+  if (func == "CheckNoCaps") {
+    return CheckNoCaps();
+  }
+
   if (func == "PrintExecFn") {
     // N.B. This will be called as an interpreter script, with the script passed
     // as the third argument. We don't care about that script.
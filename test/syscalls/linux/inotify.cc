@@ -14,6 +14,7 @@
 
 #include <fcntl.h>
 #include <libgen.h>
+#include <linux/capability.h>
 #include <sched.h>
 #include <sys/epoll.h>
 #include <sys/inotify.h>
@@ -33,6 +34,7 @@
 #include "absl/synchronization/mutex.h"
 #include "absl/time/clock.h"
 #include "absl/time/time.h"
+#include "test/util/capability_util.h"
 #include "test/util/epoll_util.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/fs_util.h"
@@ -1968,6 +1970,79 @@ TEST(Inotify, Xattr) {
   EXPECT_THAT(events, Are({Event(IN_ATTRIB, wd)}));
 }
 
+// Failed extended attribute changes don't generate events.
+TEST(Inotify, XattrFailed) {
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const std::string path = file.path();
+  // TODO(b/166162845): Only gVisor tmpfs currently supports arbitrary xattrs.
+  SKIP_IF(IsRunningOnGvisor() && !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(path)));
+
+  const FileDescriptor inotify_fd =
+      ASSERT_NO_ERRNO_AND_VALUE(InotifyInit1(IN_NONBLOCK));
+  const int wd = ASSERT_NO_ERRNO_AND_VALUE(
+      InotifyAddWatch(inotify_fd.get(), path, IN_ALL_EVENTS));
+
+  const char* cpath = path.c_str();
+  const char* name = "user.test";
+  int val = 123;
+  ASSERT_THAT(setxattr(cpath, name, &val, sizeof(val), XATTR_CREATE),
+              SyscallSucceeds());
+  std::vector<Event> events =
+      ASSERT_NO_ERRNO_AND_VALUE(DrainEvents(inotify_fd.get()));
+  EXPECT_THAT(events, Are({Event(IN_ATTRIB, wd)}));
+
+  EXPECT_THAT(setxattr(cpath, name, &val, sizeof(val), XATTR_CREATE),
+              SyscallFailsWithErrno(EEXIST));
+  EXPECT_THAT(setxattr(cpath, "user.missing", &val, sizeof(val),
+                       XATTR_REPLACE),
+              SyscallFailsWithErrno(ENODATA));
+  EXPECT_THAT(removexattr(cpath, "user.missing"),
+              SyscallFailsWithErrno(ENODATA));
+  events = ASSERT_NO_ERRNO_AND_VALUE(DrainEvents(inotify_fd.get()));
+  EXPECT_THAT(events, Are({}));
+
+  // Without CAP_SYS_ADMIN, the trusted.* namespace is off limits.
+  AutoCapability cap(CAP_SYS_ADMIN, false);
+  EXPECT_THAT(setxattr(cpath, "trusted.test", &val, sizeof(val),
+                       /*flags=*/0),
+              SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(removexattr(cpath, "trusted.test"),
+              SyscallFailsWithErrno(EPERM));
+  events = ASSERT_NO_ERRNO_AND_VALUE(DrainEvents(inotify_fd.get()));
+  EXPECT_THAT(events, Are({}));
+}
+
+// Extended attribute changes through any hard link generate events on the
+// watch shared by all of the file's links.
+TEST(Inotify, XattrHardlinks) {
+  // Inotify does not work properly with hard links in gofer and overlay fs.
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(GetAbsoluteTestTmpdir())));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const TempPath file2(NewTempAbsPath());
+  ASSERT_THAT(link(file.path().c_str(), file2.path().c_str()),
+              SyscallSucceeds());
+
+  const FileDescriptor inotify_fd =
+      ASSERT_NO_ERRNO_AND_VALUE(InotifyInit1(IN_NONBLOCK));
+  const int wd = ASSERT_NO_ERRNO_AND_VALUE(
+      InotifyAddWatch(inotify_fd.get(), file2.path(), IN_ALL_EVENTS));
+
+  const char* name = "user.test";
+  int val = 123;
+  ASSERT_THAT(setxattr(file.path().c_str(), name, &val, sizeof(val),
+                       /*flags=*/0),
+              SyscallSucceeds());
+  std::vector<Event> events =
+      ASSERT_NO_ERRNO_AND_VALUE(DrainEvents(inotify_fd.get()));
+  EXPECT_THAT(events, Are({Event(IN_ATTRIB, wd)}));
+
+  ASSERT_THAT(removexattr(file2.path().c_str(), name), SyscallSucceeds());
+  events = ASSERT_NO_ERRNO_AND_VALUE(DrainEvents(inotify_fd.get()));
+  EXPECT_THAT(events, Are({Event(IN_ATTRIB, wd)}));
+}
+
 TEST(Inotify, Exec) {
   SKIP_IF(IsRunningWithVFS1());
   const FileDescriptor fd =
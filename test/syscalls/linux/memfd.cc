@@ -19,6 +19,7 @@
 #include <string.h>
 #include <sys/mman.h>
 #include <sys/syscall.h>
+#include <sys/xattr.h>
 
 #include <vector>
 
@@ -537,6 +538,36 @@ TEST(MemfdTest, MultipleWritableAndNonWritableRefsToSameFileRegion) {
   m2.reset();
 }
 
+// memfds support user.* extended attributes like other tmpfs files.
+TEST(MemfdTest, Xattr) {
+  const FileDescriptor memfd =
+      ASSERT_NO_ERRNO_AND_VALUE(MemfdCreate(kMemfdName, 0));
+  const char name[] = "user.test";
+  const char value[] = "memfd";
+  int ret = fsetxattr(memfd.get(), name, value, sizeof(value), /*flags=*/0);
+  // Linux only supports user.* extended attributes on shmem files since 6.6.
+  if (!IsRunningOnGvisor() && ret < 0 && errno == EOPNOTSUPP) {
+    GTEST_SKIP() << "user.* xattrs not supported on memfds";
+  }
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  char buf[sizeof(value)] = {};
+  EXPECT_THAT(fgetxattr(memfd.get(), name, buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(value)));
+  EXPECT_STREQ(buf, value);
+
+  // The attribute is also visible through the memfd's /proc/self/fd link.
+  const std::string path = absl::StrFormat("/proc/self/fd/%d", memfd.get());
+  memset(buf, 0, sizeof(buf));
+  EXPECT_THAT(getxattr(path.c_str(), name, buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(value)));
+  EXPECT_STREQ(buf, value);
+
+  EXPECT_THAT(fremovexattr(memfd.get(), name), SyscallSucceeds());
+  EXPECT_THAT(fgetxattr(memfd.get(), name, nullptr, 0),
+              SyscallFailsWithErrno(ENODATA));
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
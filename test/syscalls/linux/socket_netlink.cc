@@ -81,6 +81,35 @@ TEST_P(NetlinkTest, AutomaticPort) {
   EXPECT_EQ(addr.nl_pid, getpid());
 }
 
+// Binding to an explicit port that is already in use fails, rather than
+// falling back to another port.
+TEST_P(NetlinkTest, ExplicitPortInUse) {
+  const int protocol = GetParam();
+
+  FileDescriptor fd1 =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_NETLINK, SOCK_RAW, protocol));
+  FileDescriptor fd2 =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_NETLINK, SOCK_RAW, protocol));
+
+  // Use a negative port, which isn't the PID of any process.
+  struct sockaddr_nl addr = {};
+  addr.nl_family = AF_NETLINK;
+  addr.nl_pid = static_cast<uint32_t>(-1234567);
+
+  ASSERT_THAT(
+      bind(fd1.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)),
+      SyscallSucceeds());
+  EXPECT_THAT(
+      bind(fd2.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)),
+      SyscallFailsWithErrno(EADDRINUSE));
+
+  // The second socket can still be bound elsewhere.
+  addr.nl_pid = 0;
+  EXPECT_THAT(
+      bind(fd2.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)),
+      SyscallSucceeds());
+}
+
 // Calling connect automatically binds to an automatic port.
 TEST_P(NetlinkTest, ConnectBinds) {
   const int protocol = GetParam();
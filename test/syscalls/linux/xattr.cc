@@ -15,23 +15,43 @@
 #include <errno.h>
 #include <fcntl.h>
 #include <limits.h>
+#include <linux/capability.h>
+#include <sched.h>
+#include <stdint.h>
+#include <string.h>
+#include <sys/mman.h>
+#include <sys/mount.h>
+#include <sys/socket.h>
+#include <sys/stat.h>
+#include <sys/syscall.h>
+#include <sys/sysmacros.h>
 #include <sys/types.h>
+#include <sys/un.h>
 #include <sys/xattr.h>
 #include <unistd.h>
 
+#include <algorithm>
+#include <atomic>
+#include <functional>
 #include <string>
 #include <vector>
 
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
 #include "absl/container/flat_hash_set.h"
+#include "absl/strings/str_cat.h"
 #include "test/syscalls/linux/file_base.h"
 #include "test/util/capability_util.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/fs_util.h"
+#include "test/util/memory_util.h"
+#include "test/util/mount_util.h"
+#include "test/util/multiprocess_util.h"
 #include "test/util/posix_error.h"
 #include "test/util/temp_path.h"
+#include "test/util/temp_umask.h"
 #include "test/util/test_util.h"
+#include "test/util/thread_util.h"
 
 namespace gvisor {
 namespace testing {
@@ -39,6 +59,7 @@ namespace testing {
 namespace {
 
 using ::gvisor::testing::IsTmpfs;
+using ::testing::Ge;
 
 class XattrTest : public FileTest {};
 
@@ -94,6 +115,57 @@ TEST_F(XattrTest, XattrLargeName) {
   EXPECT_THAT(removexattr(path, name.c_str()), SyscallFailsWithErrno(ERANGE));
 }
 
+TEST_F(XattrTest, XattrNameMaxBoundary) {
+  // TODO(b/166162845): Only gVisor tmpfs currently supports arbitrary names.
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+
+  const char* path = test_file_name_.c_str();
+  std::string name = "user.";
+  name += std::string(XATTR_NAME_MAX - name.length(), 'a');
+  ASSERT_EQ(name.length(), XATTR_NAME_MAX);
+
+  EXPECT_THAT(setxattr(path, name.c_str(), nullptr, 0, /*flags=*/0),
+              SyscallSucceeds());
+  EXPECT_THAT(getxattr(path, name.c_str(), nullptr, 0),
+              SyscallSucceedsWithValue(0));
+  EXPECT_THAT(removexattr(path, name.c_str()), SyscallSucceeds());
+}
+
+TEST_F(XattrTest, XattrPrefixOnlyName) {
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.";
+  EXPECT_THAT(setxattr(path, name, nullptr, 0, /*flags=*/0),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(getxattr(path, name, nullptr, 0), SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(removexattr(path, name), SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_F(XattrTest, XattrWhitespaceName) {
+  // TODO(b/166162845): Only gVisor tmpfs currently supports arbitrary names.
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user. \t ";
+  char val = 'a';
+  EXPECT_THAT(setxattr(path, name, &val, sizeof(val), /*flags=*/0),
+              SyscallSucceeds());
+
+  // The name is stored verbatim, not trimmed.
+  EXPECT_THAT(getxattr(path, "user.", nullptr, 0),
+              SyscallFailsWithErrno(EINVAL));
+  char list[sizeof(name)];
+  EXPECT_THAT(listxattr(path, list, sizeof(list)),
+              SyscallSucceedsWithValue(sizeof(name)));
+  EXPECT_STREQ(list, name);
+
+  char buf = '-';
+  EXPECT_THAT(getxattr(path, name, &buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  EXPECT_EQ(buf, val);
+}
+
 TEST_F(XattrTest, XattrInvalidPrefix) {
   const char* path = test_file_name_.c_str();
   std::string name(XATTR_NAME_MAX, 'a');
@@ -105,6 +177,58 @@ TEST_F(XattrTest, XattrInvalidPrefix) {
               SyscallFailsWithErrno(EOPNOTSUPP));
 }
 
+// The namespace is checked before the value is copied in.
+TEST_F(XattrTest, XattrInvalidPrefixBadValue) {
+  // Linux copies in the value first, so this fails with EFAULT there.
+  SKIP_IF(!IsRunningOnGvisor());
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "invalid.test";
+  void* const bad_value = reinterpret_cast<void*>(1);
+  EXPECT_THAT(setxattr(path, name, bad_value, 1, /*flags=*/0),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(test_file_name_.c_str(), O_RDWR));
+  EXPECT_THAT(fsetxattr(fd.get(), name, bad_value, 1, /*flags=*/0),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+}
+
+// Do not allow save/restore cycles while the test file is inaccessible, as
+// the restore will fail to open it.
+TEST_F(XattrTest, XattrInvalidPrefixWithoutPermission) {
+  // Linux checks permissions first, so this fails with EACCES there.
+  SKIP_IF(!IsRunningOnGvisor());
+
+  // Drop capabilities that allow us to override file permissions.
+  AutoCapability cap1(CAP_DAC_OVERRIDE, false);
+  AutoCapability cap2(CAP_DAC_READ_SEARCH, false);
+
+  DisableSave ds;
+  ASSERT_NO_ERRNO(testing::Chmod(test_file_name_, 0));
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "invalid.test";
+  char val = 'a';
+  EXPECT_THAT(setxattr(path, name, &val, sizeof(val), /*flags=*/0),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+  EXPECT_THAT(removexattr(path, name), SyscallFailsWithErrno(EOPNOTSUPP));
+}
+
+// Filesystem support is also checked before the value is copied in.
+TEST(XattrUnsupportedTest, BadValue) {
+  // Linux copies in the value first, so this fails with EFAULT there. VFS1
+  // /dev/null doesn't support extended attributes.
+  SKIP_IF(!IsRunningOnGvisor() || !IsRunningWithVFS1());
+  // user.* isn't supported on device files at all, so use trusted.*.
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  void* const bad_value = reinterpret_cast<void*>(1);
+  EXPECT_THAT(
+      setxattr("/dev/null", "trusted.test", bad_value, 1, /*flags=*/0),
+      SyscallFailsWithErrno(EOPNOTSUPP));
+}
+
 // Do not allow save/restore cycles after making the test file read-only, as
 // the restore will fail to open it with r/w permissions.
 TEST_F(XattrTest, XattrReadOnly) {
@@ -164,6 +288,73 @@ TEST_F(XattrTest, XattrWriteOnly) {
   EXPECT_THAT(removexattr(path, name), SyscallSucceeds());
 }
 
+// fgetxattr checks the inode's read permission, not the fd's open mode, so it
+// works through a write-only fd.
+TEST_F(XattrTest, FGetXattrWriteOnlyFD) {
+  const char name[] = "user.test";
+  char val = 'a';
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(test_file_name_, O_WRONLY));
+  ASSERT_THAT(fsetxattr(fd.get(), name, &val, sizeof(val), /*flags=*/0),
+              SyscallSucceeds());
+
+  char buf = 0;
+  EXPECT_THAT(fgetxattr(fd.get(), name, &buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  EXPECT_EQ(buf, val);
+}
+
+// Conversely, a write-only fd doesn't grant read access to the attributes of a
+// file whose mode denies it. Do not allow save/restore cycles after making the
+// test file write-only, as the restore will fail to open it with r/w
+// permissions.
+TEST_F(XattrTest, FGetXattrWriteOnlyFDWithoutReadPermission) {
+  // Drop capabilities that allow us to override file and directory permissions.
+  AutoCapability cap1(CAP_DAC_OVERRIDE, false);
+  AutoCapability cap2(CAP_DAC_READ_SEARCH, false);
+
+  DisableSave ds;
+  const char name[] = "user.test";
+  char val = 'a';
+  ASSERT_THAT(setxattr(test_file_name_.c_str(), name, &val, sizeof(val),
+                       /*flags=*/0),
+              SyscallSucceeds());
+  ASSERT_NO_ERRNO(testing::Chmod(test_file_name_, S_IWUSR));
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(test_file_name_, O_WRONLY));
+
+  char buf = 0;
+  EXPECT_THAT(fgetxattr(fd.get(), name, &buf, sizeof(buf)),
+              SyscallFailsWithErrno(EACCES));
+}
+
+// Do not allow save/restore cycles after making the test file inaccessible, as
+// the restore will fail to open it with r/w permissions.
+TEST_F(XattrTest, XattrWithDACOverride) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_DAC_OVERRIDE)) ||
+          !ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_CHOWN)));
+
+  // Give the file to another user and remove all permissions, so that only
+  // CAP_DAC_OVERRIDE allows access to its xattrs.
+  DisableSave ds;
+  ASSERT_THAT(chown(test_file_name_.c_str(), geteuid() + 1, getegid() + 1),
+              SyscallSucceeds());
+  ASSERT_NO_ERRNO(testing::Chmod(test_file_name_, 0));
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  char val = 'a';
+  size_t size = sizeof(val);
+
+  EXPECT_THAT(setxattr(path, name, &val, size, /*flags=*/0), SyscallSucceeds());
+
+  char buf = '-';
+  EXPECT_THAT(getxattr(path, name, &buf, size), SyscallSucceedsWithValue(size));
+  EXPECT_EQ(buf, val);
+
+  EXPECT_THAT(removexattr(path, name), SyscallSucceeds());
+}
+
 TEST_F(XattrTest, XattrTrustedWithNonadmin) {
   // TODO(b/148380782): Support setxattr and getxattr with "trusted" prefix.
   SKIP_IF(IsRunningOnGvisor());
@@ -177,6 +368,254 @@ TEST_F(XattrTest, XattrTrustedWithNonadmin) {
   EXPECT_THAT(getxattr(path, name, nullptr, 0), SyscallFailsWithErrno(ENODATA));
 }
 
+TEST_F(XattrTest, XattrOnReadOnlyMount) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir.path(), "tmpfs", MS_RDONLY, "mode=0777", 0));
+
+  const char* path = dir.path().c_str();
+  char val = 'a';
+
+  // EROFS takes precedence over namespace checks.
+  for (const char* name : {"user.test", "trusted.test", "invalid.test"}) {
+    EXPECT_THAT(setxattr(path, name, &val, sizeof(val), /*flags=*/0),
+                SyscallFailsWithErrno(EROFS));
+    EXPECT_THAT(removexattr(path, name), SyscallFailsWithErrno(EROFS));
+  }
+
+  // Reads are unaffected.
+  EXPECT_THAT(listxattr(path, nullptr, 0), SyscallSucceeds());
+  EXPECT_THAT(getxattr(path, "trusted.test", nullptr, 0),
+              SyscallFailsWithErrno(ENODATA));
+}
+
+TEST_F(XattrTest, POSIXACLUnsupported) {
+  // Only VFS1 tmpfs supports POSIX ACLs in gVisor, while the host filesystem
+  // may.
+  SKIP_IF(!IsRunningOnGvisor() ||
+          (IsRunningWithVFS1() &&
+           ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_))));
+
+  const char* path = test_file_name_.c_str();
+  for (const char* name :
+       {"system.posix_acl_access", "system.posix_acl_default"}) {
+    EXPECT_THAT(setxattr(path, name, nullptr, 0, /*flags=*/0),
+                SyscallFailsWithErrno(EOPNOTSUPP));
+    EXPECT_THAT(getxattr(path, name, nullptr, 0),
+                SyscallFailsWithErrno(EOPNOTSUPP));
+    EXPECT_THAT(removexattr(path, name), SyscallFailsWithErrno(EOPNOTSUPP));
+  }
+}
+
+// kACLUndefinedID is the ID of ACL entries that don't name a user or group.
+constexpr uint32_t kACLUndefinedID = 0xffffffff;
+
+// PosixACLXattr returns the xattr representation of an ACL with only the
+// minimal entries, granting the given permissions to the file's owner, group
+// and others. See acl(5) and Linux's include/uapi/linux/posix_acl_xattr.h.
+std::string PosixACLXattr(uint16_t user_perms, uint16_t group_perms,
+                          uint16_t other_perms) {
+  struct {
+    uint32_t version;
+    struct {
+      uint16_t tag;
+      uint16_t perm;
+      uint32_t id;
+    } entries[3];
+  } acl = {
+      .version = 2,
+      .entries = {{.tag = 0x01 /* ACL_USER_OBJ */,
+                   .perm = user_perms,
+                   .id = kACLUndefinedID},
+                  {.tag = 0x04 /* ACL_GROUP_OBJ */,
+                   .perm = group_perms,
+                   .id = kACLUndefinedID},
+                  {.tag = 0x20 /* ACL_OTHER */,
+                   .perm = other_perms,
+                   .id = kACLUndefinedID}},
+  };
+  return std::string(reinterpret_cast<const char*>(&acl), sizeof(acl));
+}
+
+// PosixACLXattrWithUser returns the xattr representation of an ACL like that
+// of PosixACLXattr, which also grants user_perms to uid, limited by a mask
+// granting mask_perms.
+std::string PosixACLXattrWithUser(uint16_t user_perms, uint32_t uid,
+                                  uint16_t group_perms, uint16_t mask_perms,
+                                  uint16_t other_perms) {
+  struct {
+    uint32_t version;
+    struct {
+      uint16_t tag;
+      uint16_t perm;
+      uint32_t id;
+    } entries[5];
+  } acl = {
+      .version = 2,
+      .entries = {{.tag = 0x01 /* ACL_USER_OBJ */,
+                   .perm = user_perms,
+                   .id = kACLUndefinedID},
+                  {.tag = 0x02 /* ACL_USER */, .perm = user_perms, .id = uid},
+                  {.tag = 0x04 /* ACL_GROUP_OBJ */,
+                   .perm = group_perms,
+                   .id = kACLUndefinedID},
+                  {.tag = 0x10 /* ACL_MASK */,
+                   .perm = mask_perms,
+                   .id = kACLUndefinedID},
+                  {.tag = 0x20 /* ACL_OTHER */,
+                   .perm = other_perms,
+                   .id = kACLUndefinedID}},
+  };
+  return std::string(reinterpret_cast<const char*>(&acl), sizeof(acl));
+}
+
+TEST_F(XattrTest, POSIXACLAccessSetsMode) {
+  const char* path = test_file_name_.c_str();
+  ASSERT_THAT(chmod(path, 0777), SyscallSucceeds());
+  const std::string acl = PosixACLXattr(06, 04, 0);
+  int ret = setxattr(path, "system.posix_acl_access", acl.data(), acl.size(),
+                     /*flags=*/0);
+  SKIP_IF(ret < 0 && errno == EOPNOTSUPP);
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  struct stat st;
+  ASSERT_THAT(stat(path, &st), SyscallSucceeds());
+  EXPECT_EQ(st.st_mode & 0777, 0640);
+
+  // The ACL is fully described by the mode, so it isn't stored.
+  EXPECT_THAT(getxattr(path, "system.posix_acl_access", nullptr, 0),
+              SyscallFailsWithErrno(ENODATA));
+  // Removing a missing ACL succeeds.
+  EXPECT_THAT(removexattr(path, "system.posix_acl_access"), SyscallSucceeds());
+}
+
+TEST_F(XattrTest, POSIXACLInvalid) {
+  const char* path = test_file_name_.c_str();
+  const std::string acl = PosixACLXattr(06, 04, 0);
+  int ret = setxattr(path, "system.posix_acl_access", acl.data(), acl.size(),
+                     /*flags=*/0);
+  SKIP_IF(ret < 0 && errno == EOPNOTSUPP);
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  // Truncated values are invalid.
+  EXPECT_THAT(setxattr(path, "system.posix_acl_access", acl.data(), 2,
+                       /*flags=*/0),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(setxattr(path, "system.posix_acl_access", acl.data(),
+                       acl.size() - 1, /*flags=*/0),
+              SyscallFailsWithErrno(EINVAL));
+
+  // So are unknown versions.
+  std::string bad_version = acl;
+  bad_version[0] = 1;
+  EXPECT_THAT(setxattr(path, "system.posix_acl_access", bad_version.data(),
+                       bad_version.size(), /*flags=*/0),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+}
+
+// Do not allow save/restore cycles while the test file is inaccessible, as
+// the restore will fail to open it.
+TEST_F(XattrTest, POSIXACLIgnoresMode) {
+  // Drop capabilities that allow us to override file permissions.
+  AutoCapability cap1(CAP_DAC_OVERRIDE, false);
+  AutoCapability cap2(CAP_DAC_READ_SEARCH, false);
+
+  const char* path = test_file_name_.c_str();
+  const std::string acl = PosixACLXattr(06, 04, 04);
+  int ret = setxattr(path, "system.posix_acl_access", acl.data(), acl.size(),
+                     /*flags=*/0);
+  SKIP_IF(ret < 0 && errno == EOPNOTSUPP);
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  // The owner may read and change ACLs regardless of the file's mode.
+  DisableSave ds;
+  ASSERT_NO_ERRNO(testing::Chmod(test_file_name_, 0));
+  EXPECT_THAT(getxattr(path, "system.posix_acl_access", nullptr, 0),
+              SyscallFailsWithErrno(ENODATA));
+  EXPECT_THAT(setxattr(path, "system.posix_acl_access", acl.data(),
+                       acl.size(), /*flags=*/0),
+              SyscallSucceeds());
+  EXPECT_THAT(removexattr(path, "system.posix_acl_access"), SyscallSucceeds());
+}
+
+TEST_F(XattrTest, POSIXACLDefaultOnNonDirectory) {
+  const char* path = test_file_name_.c_str();
+  const std::string acl = PosixACLXattr(07, 05, 0);
+  int ret = setxattr(path, "system.posix_acl_access", acl.data(), acl.size(),
+                     /*flags=*/0);
+  SKIP_IF(ret < 0 && errno == EOPNOTSUPP);
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  EXPECT_THAT(setxattr(path, "system.posix_acl_default", acl.data(),
+                       acl.size(), /*flags=*/0),
+              SyscallFailsWithErrno(EACCES));
+}
+
+TEST_F(XattrTest, POSIXACLDefaultInherited) {
+  const TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const std::string acl = PosixACLXattr(07, 05, 0);
+  int ret = setxattr(dir.path().c_str(), "system.posix_acl_default",
+                     acl.data(), acl.size(), /*flags=*/0);
+  SKIP_IF(ret < 0 && errno == EOPNOTSUPP);
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  // The default ACL, rather than the umask, limits the new file's mode.
+  TempUmask mask(022);
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Open(JoinPath(dir.path(), "file"), O_CREAT | O_RDWR, 0666));
+  const struct stat st = ASSERT_NO_ERRNO_AND_VALUE(Fstat(fd.get()));
+  EXPECT_EQ(st.st_mode & 0777, 0640);
+}
+
+TEST_F(XattrTest, POSIXACLDefaultInheritedByDirectory) {
+  const TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const std::string acl = PosixACLXattr(07, 05, 0);
+  int ret = setxattr(dir.path().c_str(), "system.posix_acl_default",
+                     acl.data(), acl.size(), /*flags=*/0);
+  SKIP_IF(ret < 0 && errno == EOPNOTSUPP);
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  TempUmask mask(0);
+  const std::string subdir = JoinPath(dir.path(), "subdir");
+  ASSERT_THAT(mkdir(subdir.c_str(), 0777), SyscallSucceeds());
+  const struct stat st = ASSERT_NO_ERRNO_AND_VALUE(Stat(subdir));
+  EXPECT_EQ(st.st_mode & 0777, 0750);
+
+  // New directories also inherit the default ACL itself.
+  std::string buf(acl.size(), '\0');
+  EXPECT_THAT(getxattr(subdir.c_str(), "system.posix_acl_default", buf.data(),
+                       buf.size()),
+              SyscallSucceedsWithValue(acl.size()));
+  EXPECT_EQ(buf, acl);
+}
+
+// A file whose inherited ACLs can't be stored must not be created.
+TEST_F(XattrTest, POSIXACLDefaultInheritFails) {
+  // Only gVisor's VFS1 tmpfs limits the size of a file's xattrs, and supports
+  // POSIX ACLs.
+  SKIP_IF(!IsRunningOnGvisor() || !IsRunningWithVFS1());
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  // The directory's default ACL fits in the quota, but a new subdirectory's
+  // access and default ACLs together don't.
+  const std::string acl = PosixACLXattrWithUser(07, getuid(), 05, 07, 0);
+  const std::string quota =
+      absl::StrCat("xattr_quota=", strlen("system.posix_acl_default") +
+                                       acl.size() + acl.size() / 2);
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir.path(), "tmpfs", 0, absl::StrCat("mode=0777,", quota), 0));
+  ASSERT_THAT(setxattr(dir.path().c_str(), "system.posix_acl_default",
+                       acl.data(), acl.size(), /*flags=*/0),
+              SyscallSucceeds());
+
+  const std::string subdir = JoinPath(dir.path(), "subdir");
+  EXPECT_THAT(mkdir(subdir.c_str(), 0777), SyscallFailsWithErrno(EDQUOT));
+  EXPECT_THAT(access(subdir.c_str(), F_OK), SyscallFailsWithErrno(ENOENT));
+}
+
 TEST_F(XattrTest, XattrOnDirectory) {
   TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
   const char name[] = "user.test";
@@ -232,6 +671,148 @@ TEST_F(XattrTest, XattrOnInvalidFileTypes) {
   EXPECT_THAT(removexattr(path, name), SyscallFailsWithErrno(EPERM));
 }
 
+// Checks the errors returned for xattr operations on a file type that does not
+// support user.* xattrs. File type restrictions take precedence over namespace
+// support, so an unsupported namespace fails with EOPNOTSUPP only once the
+// (permitted) inode permission check has passed.
+void ExpectSpecialFileXattrErrors(const char* path) {
+  const char user_name[] = "user.test";
+  EXPECT_THAT(setxattr(path, user_name, nullptr, 0, /*flags=*/0),
+              SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(getxattr(path, user_name, nullptr, 0),
+              SyscallFailsWithErrno(ENODATA));
+  EXPECT_THAT(removexattr(path, user_name), SyscallFailsWithErrno(EPERM));
+
+  const char invalid_name[] = "invalid.test";
+  EXPECT_THAT(setxattr(path, invalid_name, nullptr, 0, /*flags=*/0),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+  EXPECT_THAT(getxattr(path, invalid_name, nullptr, 0),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+  EXPECT_THAT(removexattr(path, invalid_name),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+}
+
+TEST_F(XattrTest, XattrErrorPrecedenceOnFifo) {
+  // Use tmpfs, where creation of named pipes is supported.
+  const std::string fifo = NewTempAbsPathInDir("/dev/shm");
+  ASSERT_THAT(mknod(fifo.c_str(), S_IFIFO | S_IRUSR | S_IWUSR, 0),
+              SyscallSucceeds());
+  ExpectSpecialFileXattrErrors(fifo.c_str());
+}
+
+TEST_F(XattrTest, XattrErrorPrecedenceOnSocket) {
+  const std::string path = NewTempAbsPathInDir("/dev/shm");
+  struct sockaddr_un addr = {};
+  addr.sun_family = AF_UNIX;
+  ASSERT_LT(path.size(), sizeof(addr.sun_path));
+  memcpy(addr.sun_path, path.c_str(), path.size());
+
+  int fd;
+  ASSERT_THAT(fd = socket(AF_UNIX, SOCK_STREAM, 0), SyscallSucceeds());
+  FileDescriptor sock(fd);
+  ASSERT_THAT(
+      bind(sock.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)),
+      SyscallSucceeds());
+  ASSERT_NO_ERRNO(testing::Chmod(path, S_IRUSR | S_IWUSR));
+  ExpectSpecialFileXattrErrors(path.c_str());
+  ASSERT_THAT(unlink(path.c_str()), SyscallSucceeds());
+}
+
+TEST_F(XattrTest, XattrErrorPrecedenceOnDevice) {
+  // Opening /dev/null for reading and writing is permitted for everyone.
+  ExpectSpecialFileXattrErrors("/dev/null");
+}
+
+// user.* xattrs are only permitted on regular files and directories. On every
+// other file type, writes fail with EPERM and reads with ENODATA. The l*
+// variants are used throughout so that symlinks are checked themselves.
+TEST_F(XattrTest, UserXattrByFileType) {
+  struct FileType {
+    const char* desc;
+    mode_t mode;
+    bool supported;
+  };
+  const FileType kFileTypes[] = {
+      {"regular file", S_IFREG, true},  {"directory", S_IFDIR, true},
+      {"symlink", S_IFLNK, false},      {"fifo", S_IFIFO, false},
+      {"socket", S_IFSOCK, false},      {"char device", S_IFCHR, false},
+      {"block device", S_IFBLK, false},
+  };
+  const char name[] = "user.test";
+  for (const FileType& ft : kFileTypes) {
+    SCOPED_TRACE(ft.desc);
+    // Use tmpfs, where most file types can be created.
+    std::string path = NewTempAbsPathInDir("/dev/shm");
+    bool created = true;
+    FileDescriptor sock;
+    switch (ft.mode) {
+      case S_IFDIR:
+        ASSERT_THAT(mkdir(path.c_str(), 0755), SyscallSucceeds());
+        break;
+      case S_IFLNK:
+        ASSERT_THAT(symlink("target", path.c_str()), SyscallSucceeds());
+        break;
+      case S_IFSOCK: {
+        // gVisor doesn't support creating sockets with mknod(2).
+        struct sockaddr_un addr = {};
+        addr.sun_family = AF_UNIX;
+        ASSERT_LT(path.size(), sizeof(addr.sun_path));
+        memcpy(addr.sun_path, path.c_str(), path.size());
+        int fd;
+        ASSERT_THAT(fd = socket(AF_UNIX, SOCK_STREAM, 0), SyscallSucceeds());
+        sock = FileDescriptor(fd);
+        ASSERT_THAT(bind(sock.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                         sizeof(addr)),
+                    SyscallSucceeds());
+        break;
+      }
+      case S_IFCHR:
+        // gVisor doesn't support creating device nodes, so use an existing
+        // one that anyone may read and write.
+        path = "/dev/null";
+        created = false;
+        break;
+      case S_IFBLK:
+        // Creating device nodes requires CAP_MKNOD.
+        if (mknod(path.c_str(), ft.mode | 0644, makedev(7, 0)) < 0) {
+          ASSERT_EQ(errno, EPERM);
+          continue;
+        }
+        break;
+      default:
+        ASSERT_THAT(mknod(path.c_str(), ft.mode | 0644, 0), SyscallSucceeds());
+        break;
+    }
+    const char* p = path.c_str();
+    auto cleanup = [&] {
+      if (created) {
+        EXPECT_THAT(ft.mode == S_IFDIR ? rmdir(p) : unlink(p),
+                    SyscallSucceeds());
+      }
+    };
+
+    if (ft.supported) {
+      int ret = lsetxattr(p, name, nullptr, 0, /*flags=*/0);
+      // Linux tmpfs only supports user xattrs since 6.6.
+      if (ret < 0 && errno == EOPNOTSUPP && !IsRunningOnGvisor()) {
+        cleanup();
+        continue;
+      }
+      EXPECT_THAT(ret, SyscallSucceeds());
+      EXPECT_THAT(lgetxattr(p, name, nullptr, 0), SyscallSucceedsWithValue(0));
+      EXPECT_THAT(lremovexattr(p, name), SyscallSucceeds());
+    } else {
+      EXPECT_THAT(lsetxattr(p, name, nullptr, 0, /*flags=*/0),
+                  SyscallFailsWithErrno(EPERM));
+      EXPECT_THAT(lremovexattr(p, name), SyscallFailsWithErrno(EPERM));
+    }
+    EXPECT_THAT(lgetxattr(p, name, nullptr, 0),
+                SyscallFailsWithErrno(ENODATA));
+    EXPECT_THAT(llistxattr(p, nullptr, 0), SyscallSucceedsWithValue(0));
+    cleanup();
+  }
+}
+
 TEST_F(XattrTest, SetXattrSizeSmallerThanValue) {
   const char* path = test_file_name_.c_str();
   const char name[] = "user.test";
@@ -274,6 +855,83 @@ TEST_F(XattrTest, SetXattrSizeTooLarge) {
   EXPECT_THAT(getxattr(path, name, nullptr, 0), SyscallFailsWithErrno(ENODATA));
 }
 
+// Sizes that would be truncated to a small value by a 32-bit size_t must still
+// be rejected as too large rather than wrapping.
+TEST_F(XattrTest, SetXattrSizeAbove32Bits) {
+  SKIP_IF(sizeof(size_t) < sizeof(uint64_t));
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  char val = 'a';
+  const size_t kSizes[] = {
+      static_cast<size_t>(uint64_t{1} << 32),
+      static_cast<size_t>((uint64_t{1} << 32) + 1),
+      static_cast<size_t>((uint64_t{1} << 32) + XATTR_SIZE_MAX),
+      SIZE_MAX,
+  };
+  for (size_t size : kSizes) {
+    EXPECT_THAT(setxattr(path, name, &val, size, /*flags=*/0),
+                SyscallFailsWithErrno(E2BIG))
+        << "size " << size;
+  }
+
+  EXPECT_THAT(getxattr(path, name, nullptr, 0), SyscallFailsWithErrno(ENODATA));
+}
+
+// A buffer size above XATTR_SIZE_MAX is clamped, and a small value is
+// retrieved in full; only its length is written to the buffer.
+TEST_F(XattrTest, GetXattrHugeSizeSmallValue) {
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  const char val[] = "value";
+  ASSERT_THAT(setxattr(path, name, val, sizeof(val), /*flags=*/0),
+              SyscallSucceeds());
+
+  const size_t kSizes[] = {
+      XATTR_SIZE_MAX,
+      XATTR_SIZE_MAX + 1,
+      size_t{1} << 20,
+      SIZE_MAX,
+  };
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_RDONLY));
+  for (size_t size : kSizes) {
+    std::vector<char> buf(sizeof(val) + 1, '-');
+    EXPECT_THAT(getxattr(path, name, buf.data(), size),
+                SyscallSucceedsWithValue(sizeof(val)))
+        << "size " << size;
+    EXPECT_EQ(memcmp(buf.data(), val, sizeof(val)), 0) << "size " << size;
+    EXPECT_EQ(buf[sizeof(val)], '-') << "size " << size;
+
+    EXPECT_THAT(fgetxattr(fd.get(), name, buf.data(), size),
+                SyscallSucceedsWithValue(sizeof(val)))
+        << "size " << size;
+  }
+}
+
+// Linux copies in and validates the name before checking the value's size, so
+// an oversized name fails with ERANGE on every xattr syscall, even when the
+// value is also too large.
+TEST_F(XattrTest, SetXattrNameAndSizeTooLarge) {
+  const char* path = test_file_name_.c_str();
+  std::string name = "user.";
+  name += std::string(XATTR_NAME_MAX + 1 - name.length(), 'a');
+
+  size_t size = XATTR_SIZE_MAX + 1;
+  std::vector<char> val(size);
+  EXPECT_THAT(setxattr(path, name.c_str(), val.data(), size, /*flags=*/0),
+              SyscallFailsWithErrno(ERANGE));
+  EXPECT_THAT(lsetxattr(path, name.c_str(), val.data(), size, /*flags=*/0),
+              SyscallFailsWithErrno(ERANGE));
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_RDWR));
+  EXPECT_THAT(fsetxattr(fd.get(), name.c_str(), val.data(), size, /*flags=*/0),
+              SyscallFailsWithErrno(ERANGE));
+
+  EXPECT_THAT(getxattr(path, name.c_str(), val.data(), size),
+              SyscallFailsWithErrno(ERANGE));
+  EXPECT_THAT(fgetxattr(fd.get(), name.c_str(), val.data(), size),
+              SyscallFailsWithErrno(ERANGE));
+}
+
 TEST_F(XattrTest, SetXattrNullValueAndNonzeroSize) {
   const char* path = test_file_name_.c_str();
   const char name[] = "user.test";
@@ -283,6 +941,17 @@ TEST_F(XattrTest, SetXattrNullValueAndNonzeroSize) {
   EXPECT_THAT(getxattr(path, name, nullptr, 0), SyscallFailsWithErrno(ENODATA));
 }
 
+TEST_F(XattrTest, SetXattrBadValueAddressAndLargeSize) {
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  // An address range that can never be valid user memory.
+  void* val = reinterpret_cast<void*>(~uintptr_t{0} - XATTR_SIZE_MAX / 2);
+  EXPECT_THAT(setxattr(path, name, val, XATTR_SIZE_MAX, /*flags=*/0),
+              SyscallFailsWithErrno(EFAULT));
+
+  EXPECT_THAT(getxattr(path, name, nullptr, 0), SyscallFailsWithErrno(ENODATA));
+}
+
 TEST_F(XattrTest, SetXattrNullValueAndZeroSize) {
   const char* path = test_file_name_.c_str();
   const char name[] = "user.test";
@@ -336,6 +1005,28 @@ TEST_F(XattrTest, SetXattrReplaceWithLarger) {
   EXPECT_EQ(buf, val);
 }
 
+TEST_F(XattrTest, SetXattrReplaceWithEmpty) {
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  std::vector<char> val = {'a', 'a'};
+  EXPECT_THAT(setxattr(path, name, val.data(), val.size(), /*flags=*/0),
+              SyscallSucceeds());
+  EXPECT_THAT(setxattr(path, name, val.data(), 0, XATTR_REPLACE),
+              SyscallSucceeds());
+
+  // The attribute still exists, but with an empty value.
+  std::vector<char> buf = {'-', '-'};
+  std::vector<char> expected_buf = {'-', '-'};
+  EXPECT_THAT(getxattr(path, name, buf.data(), buf.size()),
+              SyscallSucceedsWithValue(0));
+  EXPECT_EQ(buf, expected_buf);
+
+  char list[sizeof(name)];
+  EXPECT_THAT(listxattr(path, list, sizeof(list)),
+              SyscallSucceedsWithValue(sizeof(name)));
+  EXPECT_STREQ(list, name);
+}
+
 TEST_F(XattrTest, SetXattrCreateFlag) {
   const char* path = test_file_name_.c_str();
   const char name[] = "user.test";
@@ -359,6 +1050,37 @@ TEST_F(XattrTest, SetXattrReplaceFlag) {
   EXPECT_THAT(getxattr(path, name, nullptr, 0), SyscallSucceedsWithValue(0));
 }
 
+// Linux accepts XATTR_CREATE and XATTR_REPLACE together rather than failing
+// with EINVAL. Since no attribute both exists and doesn't, the call never
+// succeeds, and the value is left unchanged.
+TEST_F(XattrTest, SetXattrCreateAndReplaceFlags) {
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  char val = 'a';
+  EXPECT_THAT(setxattr(path, name, &val, sizeof(val),
+                       XATTR_CREATE | XATTR_REPLACE),
+              SyscallFailsWithErrno(ENODATA));
+  EXPECT_THAT(getxattr(path, name, nullptr, 0),
+              SyscallFailsWithErrno(ENODATA));
+
+  EXPECT_THAT(setxattr(path, name, &val, sizeof(val), XATTR_CREATE),
+              SyscallSucceeds());
+  char new_val = 'b';
+  EXPECT_THAT(setxattr(path, name, &new_val, sizeof(new_val),
+                       XATTR_CREATE | XATTR_REPLACE),
+              SyscallFailsWithErrno(EEXIST));
+
+  char buf = '-';
+  EXPECT_THAT(getxattr(path, name, &buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  EXPECT_EQ(buf, val);
+  EXPECT_THAT(setxattr(path, name, &new_val, sizeof(new_val), XATTR_REPLACE),
+              SyscallSucceeds());
+  EXPECT_THAT(getxattr(path, name, &buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  EXPECT_EQ(buf, new_val);
+}
+
 TEST_F(XattrTest, SetXattrInvalidFlags) {
   const char* path = test_file_name_.c_str();
   int invalid_flags = 0xff;
@@ -405,6 +1127,38 @@ TEST_F(XattrTest, GetXattrSizeLargerThanValue) {
   EXPECT_EQ(buf, expected_buf);
 }
 
+// A buffer one byte too small must fail without copying anything, rather than
+// silently truncating the value.
+TEST_F(XattrTest, GetXattrSizeOneByteShort) {
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  const std::string val = "abcdefgh";
+  EXPECT_THAT(setxattr(path, name, val.data(), val.size(), /*flags=*/0),
+              SyscallSucceeds());
+
+  std::vector<char> buf(val.size(), '-');
+  const std::vector<char> expected_buf = buf;
+  EXPECT_THAT(getxattr(path, name, buf.data(), val.size() - 1),
+              SyscallFailsWithErrno(ERANGE));
+  EXPECT_EQ(buf, expected_buf);
+}
+
+// A buffer of exactly the value's size receives the whole value.
+TEST_F(XattrTest, GetXattrSizeExact) {
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  const std::string val = "abcdefgh";
+  EXPECT_THAT(setxattr(path, name, val.data(), val.size(), /*flags=*/0),
+              SyscallSucceeds());
+
+  // The extra byte checks that nothing is written past the value.
+  std::vector<char> buf(val.size() + 1, '-');
+  EXPECT_THAT(getxattr(path, name, buf.data(), val.size()),
+              SyscallSucceedsWithValue(val.size()));
+  EXPECT_EQ(std::string(buf.data(), val.size()), val);
+  EXPECT_EQ(buf[val.size()], '-');
+}
+
 TEST_F(XattrTest, GetXattrZeroSize) {
   const char* path = test_file_name_.c_str();
   const char name[] = "user.test";
@@ -434,17 +1188,92 @@ TEST_F(XattrTest, GetXattrSizeTooLarge) {
   EXPECT_EQ(buf, expected_buf);
 }
 
-TEST_F(XattrTest, GetXattrNullValue) {
+// Buffer sizes beyond 32 bits are clamped to XATTR_SIZE_MAX, not truncated.
+TEST_F(XattrTest, GetXattrSizeAbove32Bits) {
+  SKIP_IF(sizeof(size_t) < sizeof(uint64_t));
+
   const char* path = test_file_name_.c_str();
   const char name[] = "user.test";
   char val = 'a';
-  size_t size = sizeof(val);
-  EXPECT_THAT(setxattr(path, name, &val, size, /*flags=*/0), SyscallSucceeds());
-
+  EXPECT_THAT(setxattr(path, name, &val, sizeof(val), /*flags=*/0),
+              SyscallSucceeds());
+
+  // Truncated to 32 bits, this size would be 0 and only probe the size.
+  const size_t size = static_cast<size_t>(uint64_t{1} << 32);
+  char buf = '-';
+  EXPECT_THAT(getxattr(path, name, &buf, size),
+              SyscallSucceedsWithValue(sizeof(val)));
+  EXPECT_EQ(buf, val);
+
+  buf = '-';
+  EXPECT_THAT(getxattr(path, name, &buf, SIZE_MAX),
+              SyscallSucceedsWithValue(sizeof(val)));
+  EXPECT_EQ(buf, val);
+}
+
+TEST_F(XattrTest, GetXattrSizeMaxValue) {
+  // TODO(b/166162845): Only gVisor tmpfs currently supports arbitrary xattrs.
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  std::vector<char> val(XATTR_SIZE_MAX, 'a');
+  // Some filesystems stipulate a lower size limit.
+  if (setxattr(path, name, val.data(), val.size(), /*flags=*/0) < 0) {
+    SKIP_IF(errno == ENOSPC || errno == E2BIG);
+    FAIL() << "unexpected errno from setxattr: " << errno;
+  }
+
+  // A buffer of exactly the value size is large enough.
+  std::vector<char> buf(XATTR_SIZE_MAX + 1, '-');
+  EXPECT_THAT(getxattr(path, name, buf.data(), XATTR_SIZE_MAX),
+              SyscallSucceedsWithValue(XATTR_SIZE_MAX));
+  EXPECT_TRUE(std::equal(val.begin(), val.end(), buf.begin()));
+
+  // So is a larger one, and the true value length is returned.
+  EXPECT_THAT(getxattr(path, name, buf.data(), XATTR_SIZE_MAX + 1),
+              SyscallSucceedsWithValue(XATTR_SIZE_MAX));
+
+  // One byte short is not.
+  EXPECT_THAT(getxattr(path, name, buf.data(), XATTR_SIZE_MAX - 1),
+              SyscallFailsWithErrno(ERANGE));
+}
+
+TEST_F(XattrTest, GetXattrNullValue) {
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  char val = 'a';
+  size_t size = sizeof(val);
+  EXPECT_THAT(setxattr(path, name, &val, size, /*flags=*/0), SyscallSucceeds());
+
   EXPECT_THAT(getxattr(path, name, nullptr, size),
               SyscallFailsWithErrno(EFAULT));
 }
 
+TEST_F(XattrTest, GetXattrValueSpansUnmappedPage) {
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  const std::string val(16, 'a');
+  EXPECT_THAT(setxattr(path, name, val.data(), val.size(), /*flags=*/0),
+              SyscallSucceeds());
+
+  // Place the buffer so that only its first half is mapped.
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(2 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  ASSERT_THAT(munmap(reinterpret_cast<void*>(m.addr() + kPageSize), kPageSize),
+              SyscallSucceeds());
+  char* buf = reinterpret_cast<char*>(m.addr() + kPageSize - val.size() / 2);
+  EXPECT_THAT(getxattr(path, name, buf, val.size()),
+              SyscallFailsWithErrno(EFAULT));
+
+  // The attribute is unaffected.
+  std::vector<char> got(val.size());
+  EXPECT_THAT(getxattr(path, name, got.data(), got.size()),
+              SyscallSucceedsWithValue(val.size()));
+  EXPECT_EQ(std::string(got.begin(), got.end()), val);
+}
+
 TEST_F(XattrTest, GetXattrNullValueAndZeroSize) {
   const char* path = test_file_name_.c_str();
   const char name[] = "user.test";
@@ -467,6 +1296,31 @@ TEST_F(XattrTest, GetXattrNonexistentName) {
   EXPECT_THAT(getxattr(path, name, nullptr, 0), SyscallFailsWithErrno(ENODATA));
 }
 
+// A missing attribute fails with ENODATA and leaves the buffer untouched,
+// unlike an attribute with an empty value, which succeeds with length 0.
+TEST_F(XattrTest, GetXattrNonexistentNameWithBuffer) {
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  char buf = '-';
+  EXPECT_THAT(getxattr(path, name, &buf, sizeof(buf)),
+              SyscallFailsWithErrno(ENODATA));
+  EXPECT_THAT(lgetxattr(path, name, &buf, sizeof(buf)),
+              SyscallFailsWithErrno(ENODATA));
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_RDONLY));
+  EXPECT_THAT(fgetxattr(fd.get(), name, &buf, sizeof(buf)),
+              SyscallFailsWithErrno(ENODATA));
+  EXPECT_EQ(buf, '-');
+
+  ASSERT_THAT(setxattr(path, name, nullptr, 0, /*flags=*/0), SyscallSucceeds());
+  EXPECT_THAT(getxattr(path, name, &buf, sizeof(buf)),
+              SyscallSucceedsWithValue(0));
+  EXPECT_EQ(buf, '-');
+
+  // Another name is still missing.
+  EXPECT_THAT(getxattr(path, "user.test2", &buf, sizeof(buf)),
+              SyscallFailsWithErrno(ENODATA));
+}
+
 TEST_F(XattrTest, ListXattr) {
   const char* path = test_file_name_.c_str();
   const std::string name = "user.test";
@@ -493,6 +1347,74 @@ TEST_F(XattrTest, ListXattr) {
   EXPECT_EQ(got, expected);
 }
 
+// gVisor returns names in sorted order, regardless of the order in which they
+// were set. Linux doesn't define the order.
+TEST_F(XattrTest, ListXattrSorted) {
+  SKIP_IF(!IsRunningOnGvisor());
+
+  const char* path = test_file_name_.c_str();
+  const std::vector<std::string> names = {"user.c", "user.a", "user.bb",
+                                          "user.b", "user.ab"};
+  size_t size = 0;
+  for (const auto& name : names) {
+    ASSERT_THAT(setxattr(path, name.c_str(), nullptr, 0, /*flags=*/0),
+                SyscallSucceeds());
+    size += name.size() + 1;
+  }
+
+  // Sorting doesn't change the size of the list.
+  EXPECT_THAT(listxattr(path, nullptr, 0), SyscallSucceedsWithValue(size));
+
+  std::vector<char> list(size);
+  ASSERT_THAT(listxattr(path, list.data(), list.size()),
+              SyscallSucceedsWithValue(size));
+  std::vector<std::string> got;
+  for (char* p = list.data(); p < list.data() + list.size();
+       p += strlen(p) + 1) {
+    got.push_back(std::string{p});
+  }
+
+  std::vector<std::string> expected = names;
+  std::sort(expected.begin(), expected.end());
+  EXPECT_EQ(got, expected);
+}
+
+// Each name in the list is followed by exactly one NUL, which counts towards
+// the returned length. Nothing is written past the end of the list.
+TEST_F(XattrTest, ListXattrExactLayout) {
+  const char* path = test_file_name_.c_str();
+  const std::vector<std::string> names = {"user.a", "user.test"};
+  size_t size = 0;
+  for (const auto& name : names) {
+    ASSERT_THAT(setxattr(path, name.c_str(), nullptr, 0, /*flags=*/0),
+                SyscallSucceeds());
+    size += name.size() + 1;
+  }
+  ASSERT_EQ(size, strlen("user.a") + 1 + strlen("user.test") + 1);
+
+  EXPECT_THAT(listxattr(path, nullptr, 0), SyscallSucceedsWithValue(size));
+
+  // One byte short of the list, the missing final NUL doesn't fit.
+  std::vector<char> list(size + 1, '-');
+  EXPECT_THAT(listxattr(path, list.data(), size - 1),
+              SyscallFailsWithErrno(ERANGE));
+
+  ASSERT_THAT(listxattr(path, list.data(), list.size()),
+              SyscallSucceedsWithValue(size));
+  EXPECT_EQ(list[size - 1], '\0');
+  EXPECT_EQ(list[size], '-');
+  EXPECT_EQ(std::count(list.begin(), list.begin() + size, '\0'),
+            static_cast<std::ptrdiff_t>(names.size()));
+
+  // The order of names isn't defined, so compare them as a set.
+  absl::flat_hash_set<std::string> got;
+  for (const char* p = list.data(); p < list.data() + size;
+       p += strlen(p) + 1) {
+    got.insert(p);
+  }
+  EXPECT_EQ(got, absl::flat_hash_set<std::string>(names.begin(), names.end()));
+}
+
 TEST_F(XattrTest, ListXattrNoXattrs) {
   const char* path = test_file_name_.c_str();
 
@@ -526,6 +1448,87 @@ TEST_F(XattrTest, ListXattrSizeTooSmall) {
               SyscallFailsWithErrno(ERANGE));
 }
 
+// A list longer than XATTR_LIST_MAX can be probed, but not retrieved.
+TEST_F(XattrTest, ListXattrExceedsListMax) {
+  const char* path = test_file_name_.c_str();
+  size_t list_size = 0;
+  for (int i = 0; list_size <= XATTR_LIST_MAX; i++) {
+    // Long names keep the number of attributes needed small.
+    std::string name = absl::StrCat("user.", i, "-");
+    name.resize(XATTR_NAME_MAX, 'a');
+    // Some filesystems limit the total size of a file's xattrs.
+    if (setxattr(path, name.c_str(), nullptr, 0, /*flags=*/0) < 0) {
+      SKIP_IF(errno == ENOSPC || errno == E2BIG || errno == EDQUOT);
+      FAIL() << "unexpected errno from setxattr: " << errno;
+    }
+    list_size += name.size() + 1;
+  }
+
+  // The file may have other attributes that are also listed.
+  EXPECT_THAT(listxattr(path, nullptr, 0),
+              SyscallSucceedsWithValue(Ge(list_size)));
+
+  std::vector<char> buf(XATTR_LIST_MAX + 1);
+  EXPECT_THAT(listxattr(path, buf.data(), buf.size()),
+              SyscallFailsWithErrno(E2BIG));
+  EXPECT_THAT(listxattr(path, buf.data(), XATTR_LIST_MAX),
+              SyscallFailsWithErrno(E2BIG));
+  EXPECT_THAT(listxattr(path, buf.data(), XATTR_LIST_MAX - 1),
+              SyscallFailsWithErrno(ERANGE));
+}
+
+// Each listxattr call sees a consistent set of names, even if the set changes
+// between a size probe and the call that retrieves the list. In that case, the
+// list either still fits or retrieval fails with ERANGE, and the caller must
+// probe again.
+TEST_F(XattrTest, ListXattrConcurrentModification) {
+  // TODO(b/166162845): Only gVisor tmpfs currently supports arbitrary xattrs.
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+
+  const std::string path = test_file_name_;
+  std::atomic<bool> done(false);
+  ScopedThread modifier([&] {
+    for (int i = 0; !done.load(); i = (i + 1) % 16) {
+      // Alternately add and remove each attribute.
+      const std::string name = absl::StrCat("user.concurrent", i);
+      if (setxattr(path.c_str(), name.c_str(), nullptr, 0, XATTR_CREATE) < 0) {
+        removexattr(path.c_str(), name.c_str());
+      }
+    }
+  });
+
+  // Failures end the loop rather than the test, so that the modifier is
+  // always stopped.
+  for (int i = 0; i < 1000 && !HasFailure(); i++) {
+    const ssize_t size = listxattr(path.c_str(), nullptr, 0);
+    EXPECT_THAT(size, SyscallSucceeds());
+    if (size <= 0) {
+      continue;
+    }
+    std::vector<char> list(size);
+    const ssize_t n = listxattr(path.c_str(), list.data(), list.size());
+    if (n < 0) {
+      EXPECT_EQ(errno, ERANGE);
+      continue;
+    }
+
+    // The list must be a well-formed sequence of distinct names.
+    list.resize(n);
+    absl::flat_hash_set<std::string> names;
+    for (size_t pos = 0; pos < list.size() && !HasFailure();) {
+      const size_t len = strnlen(list.data() + pos, list.size() - pos);
+      EXPECT_GT(len, 0);
+      EXPECT_LT(pos + len, list.size()) << "name is not NUL-terminated";
+      const std::string name(list.data() + pos, len);
+      EXPECT_TRUE(names.insert(name).second) << "duplicate name " << name;
+      pos += len + 1;
+    }
+  }
+  done.store(true);
+  modifier.Join();
+}
+
 TEST_F(XattrTest, ListXattrZeroSize) {
   const char* path = test_file_name_.c_str();
   const char name[] = "user.test";
@@ -534,6 +1537,66 @@ TEST_F(XattrTest, ListXattrZeroSize) {
               SyscallSucceedsWithValue(sizeof(name)));
 }
 
+TEST_F(XattrTest, ListXattrProbeThenRead) {
+  const char* path = test_file_name_.c_str();
+
+  // With no attributes, the probe returns 0 rather than failing.
+  EXPECT_THAT(listxattr(path, nullptr, 0), SyscallSucceedsWithValue(0));
+
+  const std::string name = "user.test";
+  const std::string name2 = "user.test2";
+  EXPECT_THAT(setxattr(path, name.c_str(), nullptr, 0, /*flags=*/0),
+              SyscallSucceeds());
+  EXPECT_THAT(setxattr(path, name2.c_str(), nullptr, 0, /*flags=*/0),
+              SyscallSucceeds());
+
+  // The probed size accounts for the trailing NUL of every name, so a buffer
+  // of exactly that size must be accepted.
+  int size = 0;
+  ASSERT_THAT(size = listxattr(path, nullptr, 0),
+              SyscallSucceedsWithValue(name.size() + 1 + name2.size() + 1));
+  std::vector<char> list(size);
+  EXPECT_THAT(listxattr(path, list.data(), list.size()),
+              SyscallSucceedsWithValue(size));
+}
+
+// Unlike getxattr(2), the list variants take no name: their arguments are
+// (path or fd, list, size). Garbage in the argument slots used by getxattr for
+// the value and flags must be ignored.
+TEST_F(XattrTest, ListXattrArgumentLayout) {
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  EXPECT_THAT(setxattr(path, name, nullptr, 0, /*flags=*/0), SyscallSucceeds());
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, 0));
+
+  const uintptr_t kBadAddr = 1;
+  const uintptr_t kBadFlags = ~uintptr_t{0};
+  char list[sizeof(name)] = {};
+  EXPECT_THAT(syscall(SYS_listxattr, path, list, sizeof(list), kBadAddr,
+                      kBadFlags),
+              SyscallSucceedsWithValue(sizeof(name)));
+  EXPECT_STREQ(list, name);
+
+  memset(list, 0, sizeof(list));
+  EXPECT_THAT(syscall(SYS_llistxattr, path, list, sizeof(list), kBadAddr,
+                      kBadFlags),
+              SyscallSucceedsWithValue(sizeof(name)));
+  EXPECT_STREQ(list, name);
+
+  memset(list, 0, sizeof(list));
+  EXPECT_THAT(syscall(SYS_flistxattr, fd.get(), list, sizeof(list), kBadAddr,
+                      kBadFlags),
+              SyscallSucceedsWithValue(sizeof(name)));
+  EXPECT_STREQ(list, name);
+
+  // The size is taken from the third argument, not the fourth as for
+  // getxattr(2).
+  EXPECT_THAT(syscall(SYS_flistxattr, fd.get(), list, 0, sizeof(list)),
+              SyscallSucceedsWithValue(sizeof(name)));
+  EXPECT_THAT(syscall(SYS_flistxattr, fd.get(), list, 1, sizeof(list)),
+              SyscallFailsWithErrno(ERANGE));
+}
+
 TEST_F(XattrTest, RemoveXattr) {
   const char* path = test_file_name_.c_str();
   const char name[] = "user.test";
@@ -564,6 +1627,111 @@ TEST_F(XattrTest, LXattrOnSymlink) {
               SyscallFailsWithErrno(EPERM));
 }
 
+TEST_F(XattrTest, TrailingSlashOnFile) {
+  const std::string path = test_file_name_ + "/";
+  const char name[] = "user.test";
+  char val = 'a';
+  EXPECT_THAT(setxattr(path.c_str(), name, &val, sizeof(val), /*flags=*/0),
+              SyscallFailsWithErrno(ENOTDIR));
+  EXPECT_THAT(getxattr(path.c_str(), name, nullptr, 0),
+              SyscallFailsWithErrno(ENOTDIR));
+  EXPECT_THAT(listxattr(path.c_str(), nullptr, 0),
+              SyscallFailsWithErrno(ENOTDIR));
+  EXPECT_THAT(removexattr(path.c_str(), name),
+              SyscallFailsWithErrno(ENOTDIR));
+  EXPECT_THAT(lgetxattr(path.c_str(), name, nullptr, 0),
+              SyscallFailsWithErrno(ENOTDIR));
+}
+
+TEST_F(XattrTest, TrailingSlashOnDirectory) {
+  TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const std::string path = dir.path() + "/";
+  const char name[] = "user.test";
+  char val = 'a';
+  EXPECT_THAT(setxattr(path.c_str(), name, &val, sizeof(val), /*flags=*/0),
+              SyscallSucceeds());
+
+  char buf = '-';
+  EXPECT_THAT(getxattr(path.c_str(), name, &buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  EXPECT_EQ(buf, val);
+  char list[sizeof(name)];
+  EXPECT_THAT(listxattr(path.c_str(), list, sizeof(list)),
+              SyscallSucceedsWithValue(sizeof(name)));
+  EXPECT_STREQ(list, name);
+  EXPECT_THAT(removexattr(path.c_str(), name), SyscallSucceeds());
+}
+
+// A trailing slash causes the l variants to follow a final symlink.
+TEST_F(XattrTest, TrailingSlashOnSymlinkToDirectory) {
+  TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  TempPath link = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateSymlinkTo(GetAbsoluteTestTmpdir(), dir.path()));
+  const std::string path = link.path() + "/";
+  const char name[] = "user.test";
+  char val = 'a';
+  EXPECT_THAT(lsetxattr(path.c_str(), name, &val, sizeof(val), /*flags=*/0),
+              SyscallSucceeds());
+
+  char buf = '-';
+  EXPECT_THAT(getxattr(dir.path().c_str(), name, &buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  EXPECT_EQ(buf, val);
+  buf = '-';
+  EXPECT_THAT(lgetxattr(path.c_str(), name, &buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  EXPECT_EQ(buf, val);
+  char list[sizeof(name)];
+  EXPECT_THAT(llistxattr(path.c_str(), list, sizeof(list)),
+              SyscallSucceedsWithValue(sizeof(name)));
+  EXPECT_STREQ(list, name);
+
+  // Without the trailing slash, the link itself is accessed.
+  EXPECT_THAT(lgetxattr(link.path().c_str(), name, nullptr, 0),
+              SyscallFailsWithErrno(ENODATA));
+
+  EXPECT_THAT(lremovexattr(path.c_str(), name), SyscallSucceeds());
+  EXPECT_THAT(getxattr(dir.path().c_str(), name, nullptr, 0),
+              SyscallFailsWithErrno(ENODATA));
+}
+
+TEST_F(XattrTest, TrailingSlashOnSymlinkToFile) {
+  TempPath link = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateSymlinkTo(GetAbsoluteTestTmpdir(), test_file_name_));
+  const std::string path = link.path() + "/";
+  const char name[] = "user.test";
+  EXPECT_THAT(getxattr(path.c_str(), name, nullptr, 0),
+              SyscallFailsWithErrno(ENOTDIR));
+  EXPECT_THAT(lgetxattr(path.c_str(), name, nullptr, 0),
+              SyscallFailsWithErrno(ENOTDIR));
+}
+
+TEST_F(XattrTest, LXattrOnSymlinkToFile) {
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  TempPath link = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateSymlinkTo(GetAbsoluteTestTmpdir(), test_file_name_));
+
+  // The non-l variants follow the link and operate on the regular file.
+  char val = 'a';
+  EXPECT_THAT(setxattr(link.path().c_str(), name, &val, sizeof(val), 0),
+              SyscallSucceeds());
+  char buf = '-';
+  EXPECT_THAT(getxattr(path, name, &buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  EXPECT_EQ(buf, val);
+
+  // The l variants operate on the link itself, which cannot have user.*
+  // xattrs.
+  EXPECT_THAT(lsetxattr(link.path().c_str(), name, &val, sizeof(val), 0),
+              SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(lgetxattr(link.path().c_str(), name, &buf, sizeof(buf)),
+              SyscallFailsWithErrno(ENODATA));
+
+  // The file's xattr is untouched.
+  EXPECT_THAT(removexattr(path, name), SyscallSucceeds());
+}
+
 TEST_F(XattrTest, LXattrOnNonsymlink) {
   const char* path = test_file_name_.c_str();
   const char name[] = "user.test";
@@ -607,6 +1775,93 @@ TEST_F(XattrTest, XattrWithFD) {
   EXPECT_THAT(fremovexattr(fd.get(), name), SyscallSucceeds());
 }
 
+// An attribute set through a file descriptor survives fsync and is visible
+// through a fresh open of the same file.
+TEST_F(XattrTest, XattrPersistsAfterFsync) {
+  const char* path = test_file_name_.c_str();
+  const char name[] = "user.test";
+  const char val[] = "persisted";
+  {
+    const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_RDWR));
+    ASSERT_THAT(fsetxattr(fd.get(), name, val, sizeof(val), /*flags=*/0),
+                SyscallSucceeds());
+    ASSERT_THAT(fsync(fd.get()), SyscallSucceeds());
+  }
+
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_RDONLY));
+  char buf[sizeof(val)] = {};
+  EXPECT_THAT(fgetxattr(fd.get(), name, buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(val)));
+  EXPECT_STREQ(buf, val);
+}
+
+// Extended attributes belong to the inode, so changes through one hard link
+// are visible through the others.
+TEST_F(XattrTest, XattrHardlinks) {
+  const char* path = test_file_name_.c_str();
+  const TempPath link_path(NewTempAbsPath());
+  ASSERT_THAT(link(path, link_path.path().c_str()), SyscallSucceeds());
+  const char* path2 = link_path.path().c_str();
+
+  const char name[] = "user.test";
+  char val = 'a';
+  ASSERT_THAT(setxattr(path, name, &val, sizeof(val), /*flags=*/0),
+              SyscallSucceeds());
+  char buf = 0;
+  EXPECT_THAT(getxattr(path2, name, &buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  EXPECT_EQ(buf, val);
+
+  ASSERT_THAT(removexattr(path2, name), SyscallSucceeds());
+  EXPECT_THAT(getxattr(path, name, nullptr, 0), SyscallFailsWithErrno(ENODATA));
+  EXPECT_THAT(getxattr(path2, name, nullptr, 0),
+              SyscallFailsWithErrno(ENODATA));
+  EXPECT_THAT(listxattr(path, nullptr, 0), SyscallSucceedsWithValue(0));
+}
+
+// An unlinked file can no longer be found by path, but its extended attributes
+// can still be accessed through an open file descriptor.
+TEST_F(XattrTest, XattrUnlinkedFile) {
+  const std::string path = test_file_name_;
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(path.c_str(), O_RDWR));
+  const char name[] = "user.test";
+  int val = 1234;
+  size_t size = sizeof(val);
+  ASSERT_THAT(fsetxattr(fd.get(), name, &val, size, /*flags=*/0),
+              SyscallSucceeds());
+  UnlinkFile();
+
+  int buf = 0;
+  EXPECT_THAT(setxattr(path.c_str(), name, &val, size, /*flags=*/0),
+              SyscallFailsWithErrno(ENOENT));
+  EXPECT_THAT(getxattr(path.c_str(), name, &buf, size),
+              SyscallFailsWithErrno(ENOENT));
+  EXPECT_THAT(listxattr(path.c_str(), nullptr, 0),
+              SyscallFailsWithErrno(ENOENT));
+  EXPECT_THAT(removexattr(path.c_str(), name), SyscallFailsWithErrno(ENOENT));
+
+  EXPECT_THAT(fgetxattr(fd.get(), name, &buf, size),
+              SyscallSucceedsWithValue(size));
+  EXPECT_EQ(buf, val);
+
+  val = 5678;
+  EXPECT_THAT(fsetxattr(fd.get(), name, &val, size, XATTR_REPLACE),
+              SyscallSucceeds());
+  EXPECT_THAT(fgetxattr(fd.get(), name, &buf, size),
+              SyscallSucceedsWithValue(size));
+  EXPECT_EQ(buf, val);
+
+  char list[sizeof(name)];
+  EXPECT_THAT(flistxattr(fd.get(), list, sizeof(list)),
+              SyscallSucceedsWithValue(sizeof(name)));
+  EXPECT_STREQ(list, name);
+
+  EXPECT_THAT(fremovexattr(fd.get(), name), SyscallSucceeds());
+  EXPECT_THAT(fgetxattr(fd.get(), name, nullptr, 0),
+              SyscallFailsWithErrno(ENODATA));
+}
+
 TEST_F(XattrTest, XattrWithOPath) {
   SKIP_IF(IsRunningWithVFS1());
   const FileDescriptor fd =
@@ -629,9 +1884,6 @@ TEST_F(XattrTest, XattrWithOPath) {
 }
 
 TEST_F(XattrTest, TrustedNamespaceWithCapSysAdmin) {
-  // Trusted namespace not supported in VFS1.
-  SKIP_IF(IsRunningWithVFS1());
-
   // TODO(b/166162845): Only gVisor tmpfs currently supports trusted namespace.
   SKIP_IF(IsRunningOnGvisor() &&
           !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
@@ -672,9 +1924,6 @@ TEST_F(XattrTest, TrustedNamespaceWithCapSysAdmin) {
 }
 
 TEST_F(XattrTest, TrustedNamespaceWithoutCapSysAdmin) {
-  // Trusted namespace not supported in VFS1.
-  SKIP_IF(IsRunningWithVFS1());
-
   // TODO(b/66162845): Only gVisor tmpfs currently supports trusted namespace.
   SKIP_IF(IsRunningOnGvisor() &&
           !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
@@ -703,6 +1952,311 @@ TEST_F(XattrTest, TrustedNamespaceWithoutCapSysAdmin) {
   EXPECT_THAT(removexattr(path, name), SyscallFailsWithErrno(EPERM));
 }
 
+// XATTR_REPLACE of a nonexistent attribute fails with ENODATA only once the
+// caller is known to be allowed to set it. Otherwise the error would reveal
+// whether attributes the caller can't access exist.
+TEST_F(XattrTest, SetXattrReplaceErrorPrecedence) {
+  // TODO(b/66162845): Only gVisor tmpfs currently supports trusted namespace.
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+
+  const char* path = test_file_name_.c_str();
+  char val = 'a';
+
+  {
+    AutoCapability cap(CAP_SYS_ADMIN, false);
+    EXPECT_THAT(
+        setxattr(path, "trusted.test", &val, sizeof(val), XATTR_REPLACE),
+        SyscallFailsWithErrno(EPERM));
+  }
+
+  // Drop capabilities that allow us to override file permissions.
+  AutoCapability cap1(CAP_DAC_OVERRIDE, false);
+  AutoCapability cap2(CAP_DAC_READ_SEARCH, false);
+  // Do not allow save/restore cycles after making the test file read-only, as
+  // the restore will fail to open it with r/w permissions.
+  DisableSave ds;
+  ASSERT_NO_ERRNO(testing::Chmod(test_file_name_, S_IRUSR));
+  EXPECT_THAT(setxattr(path, "user.test", &val, sizeof(val), XATTR_REPLACE),
+              SyscallFailsWithErrno(EACCES));
+}
+
+TEST_F(XattrTest, ListXattrFiltersTrustedWithoutCapSysAdmin) {
+  // TODO(b/166162845): Only gVisor tmpfs currently supports trusted namespace.
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+
+  const char* path = test_file_name_.c_str();
+  const char user_name[] = "user.test";
+  const char trusted_name[] = "trusted.test";
+
+  // See TrustedNamespaceWithCapSysAdmin.
+  if (removexattr(path, trusted_name) < 0) {
+    SKIP_IF(errno == EPERM);
+    FAIL() << "unexpected errno from removexattr: " << errno;
+  }
+
+  char val = 'a';
+  ASSERT_THAT(setxattr(path, user_name, &val, sizeof(val), /*flags=*/0),
+              SyscallSucceeds());
+  ASSERT_THAT(setxattr(path, trusted_name, &val, sizeof(val), /*flags=*/0),
+              SyscallSucceeds());
+
+  // A privileged caller sees both names.
+  EXPECT_THAT(
+      listxattr(path, nullptr, 0),
+      SyscallSucceedsWithValue(sizeof(user_name) + sizeof(trusted_name)));
+
+  AutoCapability cap(CAP_SYS_ADMIN, false);
+
+  // An unprivileged caller only sees user.test, and the size probe agrees
+  // with what is copied out, even though the buffer is too small for the
+  // unfiltered list.
+  EXPECT_THAT(listxattr(path, nullptr, 0),
+              SyscallSucceedsWithValue(sizeof(user_name)));
+  char list[sizeof(user_name)];
+  EXPECT_THAT(listxattr(path, list, sizeof(list)),
+              SyscallSucceedsWithValue(sizeof(user_name)));
+  EXPECT_STREQ(list, user_name);
+}
+
+TEST_F(XattrTest, SecurityCapability) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SETFCAP)));
+  // Only tmpfs in gVisor stores file capabilities.
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "security.capability";
+
+  // Equivalent to "setcap cap_net_raw+ep".
+  struct vfs_cap_data caps = {};
+  caps.magic_etc = VFS_CAP_REVISION_2 | VFS_CAP_FLAGS_EFFECTIVE;
+  caps.data[0].permitted = 1 << CAP_NET_RAW;
+  ASSERT_THAT(setxattr(path, name, &caps, XATTR_CAPS_SZ_2, /*flags=*/0),
+              SyscallSucceeds());
+
+  struct vfs_cap_data got = {};
+  EXPECT_THAT(getxattr(path, name, &got, sizeof(got)),
+              SyscallSucceedsWithValue(XATTR_CAPS_SZ_2));
+  EXPECT_EQ(memcmp(&got, &caps, XATTR_CAPS_SZ_2), 0);
+
+  EXPECT_THAT(removexattr(path, name), SyscallSucceeds());
+  EXPECT_THAT(getxattr(path, name, &got, sizeof(got)),
+              SyscallFailsWithErrno(ENODATA));
+}
+
+TEST_F(XattrTest, SecurityCapabilityInvalid) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SETFCAP)));
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "security.capability";
+
+  struct vfs_cap_data caps = {};
+  caps.magic_etc = VFS_CAP_REVISION_2;
+
+  // Truncated value.
+  EXPECT_THAT(setxattr(path, name, &caps, XATTR_CAPS_SZ_2 - 1, /*flags=*/0),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Revision 1 can't be set.
+  caps.magic_etc = VFS_CAP_REVISION_1;
+  EXPECT_THAT(setxattr(path, name, &caps, XATTR_CAPS_SZ_1, /*flags=*/0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_F(XattrTest, SecurityCapabilityWithoutSetfcap) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SETFCAP)));
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "security.capability";
+
+  struct vfs_cap_data caps = {};
+  caps.magic_etc = VFS_CAP_REVISION_2;
+  ASSERT_THAT(setxattr(path, name, &caps, XATTR_CAPS_SZ_2, /*flags=*/0),
+              SyscallSucceeds());
+
+  AutoCapability cap(CAP_SETFCAP, false);
+  EXPECT_THAT(setxattr(path, name, &caps, XATTR_CAPS_SZ_2, /*flags=*/0),
+              SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(removexattr(path, name), SyscallFailsWithErrno(EPERM));
+
+  // Reading file capabilities requires no privilege.
+  struct vfs_cap_data got = {};
+  EXPECT_THAT(getxattr(path, name, &got, sizeof(got)),
+              SyscallSucceedsWithValue(XATTR_CAPS_SZ_2));
+}
+
+// Do not allow save/restore cycles while the test file is inaccessible, as
+// the restore will fail to open it.
+TEST_F(XattrTest, SecurityCapabilityIgnoresMode) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SETFCAP)));
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+
+  // Drop capabilities that allow us to override file permissions.
+  AutoCapability cap1(CAP_DAC_OVERRIDE, false);
+  AutoCapability cap2(CAP_DAC_READ_SEARCH, false);
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "security.capability";
+
+  DisableSave ds;
+  ASSERT_NO_ERRNO(testing::Chmod(test_file_name_, 0));
+
+  // File capabilities are only subject to CAP_SETFCAP, not the file's mode.
+  struct vfs_cap_data caps = {};
+  caps.magic_etc = VFS_CAP_REVISION_2;
+  EXPECT_THAT(setxattr(path, name, &caps, XATTR_CAPS_SZ_2, /*flags=*/0),
+              SyscallSucceeds());
+  struct vfs_cap_data got = {};
+  EXPECT_THAT(getxattr(path, name, &got, sizeof(got)),
+              SyscallSucceedsWithValue(XATTR_CAPS_SZ_2));
+  EXPECT_THAT(removexattr(path, name), SyscallSucceeds());
+}
+
+// Revision 3 file capabilities are scoped by their rootid. They are shown as
+// revision 2 to tasks for which rootid is root, and unchanged otherwise.
+TEST_F(XattrTest, SecurityCapabilityV3) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SETFCAP)));
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "security.capability";
+
+  struct vfs_ns_cap_data caps = {};
+  caps.magic_etc = VFS_CAP_REVISION_3 | VFS_CAP_FLAGS_EFFECTIVE;
+  caps.data[0].permitted = 1 << CAP_NET_RAW;
+  caps.rootid = 0;
+  ASSERT_THAT(setxattr(path, name, &caps, XATTR_CAPS_SZ_3, /*flags=*/0),
+              SyscallSucceeds());
+
+  struct vfs_ns_cap_data got = {};
+  EXPECT_THAT(getxattr(path, name, nullptr, 0),
+              SyscallSucceedsWithValue(XATTR_CAPS_SZ_2));
+  EXPECT_THAT(getxattr(path, name, &got, sizeof(got)),
+              SyscallSucceedsWithValue(XATTR_CAPS_SZ_2));
+  EXPECT_EQ(got.magic_etc, VFS_CAP_REVISION_2 | VFS_CAP_FLAGS_EFFECTIVE);
+  EXPECT_EQ(got.data[0].permitted, caps.data[0].permitted);
+
+  caps.rootid = 1000;
+  ASSERT_THAT(setxattr(path, name, &caps, XATTR_CAPS_SZ_3, /*flags=*/0),
+              SyscallSucceeds());
+  got = {};
+  EXPECT_THAT(getxattr(path, name, nullptr, 0),
+              SyscallSucceedsWithValue(XATTR_CAPS_SZ_3));
+  EXPECT_THAT(getxattr(path, name, &got, sizeof(got)),
+              SyscallSucceedsWithValue(XATTR_CAPS_SZ_3));
+  EXPECT_EQ(memcmp(&got, &caps, XATTR_CAPS_SZ_3), 0);
+
+  // The size must match the revision.
+  EXPECT_THAT(setxattr(path, name, &caps, XATTR_CAPS_SZ_2, /*flags=*/0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+// Writes contents to the file at path. It TEST_PCHECK-fails on error, since it
+// is used after fork.
+void WriteProcFile(const char* path, const std::string& contents) {
+  int fd = open(path, O_WRONLY);
+  TEST_PCHECK(fd >= 0);
+  TEST_PCHECK(write(fd, contents.data(), contents.size()) ==
+              static_cast<ssize_t>(contents.size()));
+  TEST_PCHECK(close(fd) == 0);
+}
+
+// Runs fn in a child process, in a new user namespace in which the caller's
+// UID and GID are mapped to root.
+PosixErrorOr<int> InNewUserNamespaceAsRoot(const std::function<void()>& fn) {
+  const std::string uid_map = absl::StrCat("0 ", getuid(), " 1");
+  const std::string gid_map = absl::StrCat("0 ", getgid(), " 1");
+  return InForkedProcess([&] {
+    TEST_PCHECK(unshare(CLONE_NEWUSER) == 0);
+    WriteProcFile("/proc/self/uid_map", uid_map);
+    // Writing "deny" to setgroups is required to write gid_map, on kernels
+    // where the file exists.
+    int fd = open("/proc/self/setgroups", O_WRONLY);
+    TEST_PCHECK(fd >= 0 || errno == ENOENT);
+    if (fd >= 0) {
+      TEST_PCHECK(close(fd) == 0);
+      WriteProcFile("/proc/self/setgroups", "deny");
+    }
+    WriteProcFile("/proc/self/gid_map", gid_map);
+    fn();
+  });
+}
+
+TEST_F(XattrTest, SecurityCapabilityV3InUserNamespace) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SETFCAP)));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(CanCreateUserNamespace()));
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+  // The rootid of 0 below must be the caller's UID in the new namespace.
+  SKIP_IF(getuid() != 0);
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "security.capability";
+
+  // Capabilities scoped to a UID that isn't mapped in the reader's user
+  // namespace, and isn't root in any of its ancestors, can't be shown.
+  struct vfs_ns_cap_data caps = {};
+  caps.magic_etc = VFS_CAP_REVISION_3;
+  caps.rootid = 1000;
+  ASSERT_THAT(setxattr(path, name, &caps, XATTR_CAPS_SZ_3, /*flags=*/0),
+              SyscallSucceeds());
+  EXPECT_THAT(InNewUserNamespaceAsRoot([&] {
+                struct vfs_ns_cap_data got = {};
+                TEST_CHECK(getxattr(path, name, &got, sizeof(got)) == -1);
+                TEST_CHECK(errno == EOVERFLOW);
+              }),
+              IsPosixErrorOkAndHolds(0));
+
+  // Capabilities whose rootid is root in the reader's user namespace are shown
+  // as revision 2.
+  caps.rootid = 0;
+  ASSERT_THAT(setxattr(path, name, &caps, XATTR_CAPS_SZ_3, /*flags=*/0),
+              SyscallSucceeds());
+  EXPECT_THAT(InNewUserNamespaceAsRoot([&] {
+                struct vfs_ns_cap_data got = {};
+                TEST_CHECK(getxattr(path, name, &got, sizeof(got)) ==
+                           XATTR_CAPS_SZ_2);
+                TEST_CHECK(got.magic_etc == VFS_CAP_REVISION_2);
+              }),
+              IsPosixErrorOkAndHolds(0));
+
+  // A rootid that isn't mapped in the setter's user namespace is rejected.
+  EXPECT_THAT(InNewUserNamespaceAsRoot([&] {
+                struct vfs_ns_cap_data bad = {};
+                bad.magic_etc = VFS_CAP_REVISION_3;
+                bad.rootid = 5;
+                TEST_CHECK(setxattr(path, name, &bad, XATTR_CAPS_SZ_3,
+                                    /*flags=*/0) == -1);
+                TEST_CHECK(errno == EINVAL);
+              }),
+              IsPosixErrorOkAndHolds(0));
+}
+
+// procfs files don't support extended attributes.
+TEST(XattrProcTest, Unsupported) {
+  // Symlinks such as /proc/self/exe aren't included: reading user.* attributes
+  // of a symlink fails with ENODATA before the filesystem is consulted.
+  for (const char* path :
+       {"/proc/self", "/proc/self/status", "/proc/self/uid_map",
+        "/proc/self/cmdline", "/proc/self/fd", "/proc/sys/kernel",
+        "/proc/meminfo"}) {
+    SCOPED_TRACE(path);
+    char val = '-';
+    EXPECT_THAT(getxattr(path, "user.test", &val, sizeof(val)),
+                SyscallFailsWithErrno(EOPNOTSUPP));
+    EXPECT_THAT(getxattr(path, "user.test", nullptr, 0),
+                SyscallFailsWithErrno(EOPNOTSUPP));
+  }
+}
+
 }  // namespace
 
 }  // namespace testing